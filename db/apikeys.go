@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// LoadKeys returns every API key, including revoked ones, with when it was
+// last used
+func LoadKeys(ctx context.Context) ([]*structs.APIKey, error) {
+	rows, err := Conn.Query(ctx, fmt.Sprintf(`
+		SELECT k.id, k.name, k.prefix, k.hash, k.tenant, k.scopes, k.services, k.envs,
+			k.expires_at, k.created_at, k.updated_at, k.revoked_at, u.last_used_at
+		FROM (SELECT * FROM %[1]s.api_keys FINAL) AS k
+		LEFT JOIN (
+			SELECT id, max(last_used_at) AS last_used_at
+			FROM %[1]s.api_key_usage
+			GROUP BY id
+		) AS u ON u.id = k.id
+	`, Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*structs.APIKey
+	for rows.Next() {
+		var k structs.APIKey
+		var lastUsed time.Time
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &k.Tenant, &k.Scopes, &k.Services, &k.Envs,
+			&k.ExpiresAt, &k.CreatedAt, &k.UpdatedAt, &k.RevokedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		// Keys that were never used get the epoch from the join
+		if lastUsed.Unix() > 0 {
+			k.LastUsedAt = &lastUsed
+		}
+		keys = append(keys, &k)
+	}
+	return keys, rows.Err()
+}
+
+// SaveKey creates or replaces an API key. Rows are versioned by updated_at,
+// so the latest write wins.
+func SaveKey(ctx context.Context, k *structs.APIKey) error {
+	return Conn.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s.api_keys (id, name, prefix, hash, tenant, scopes, services, envs, expires_at, created_at, updated_at, revoked_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, Database), k.ID, k.Name, k.Prefix, k.Hash, k.Tenant, nonNil(k.Scopes), nonNil(k.Services), nonNil(k.Envs),
+		k.ExpiresAt, k.CreatedAt, k.UpdatedAt, k.RevokedAt)
+}
+
+// TouchKeys records when API keys were last used
+func TouchKeys(ctx context.Context, used map[string]time.Time) error {
+	batch, err := Conn.PrepareBatch(ctx, fmt.Sprintf(`
+		INSERT INTO %s.api_key_usage (id, last_used_at)
+	`, Database))
+	if err != nil {
+		return fmt.Errorf("failed to prepare batch: %w", err)
+	}
+	for id, t := range used {
+		if err := batch.Append(id, t); err != nil {
+			return fmt.Errorf("failed to append api key usage to batch: %w", err)
+		}
+	}
+	return batch.Send()
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// KeyStore wraps the API key functions to implement the services.KeyStore
+// interface
+type KeyStore struct{}
+
+func (s *KeyStore) LoadKeys(ctx context.Context) ([]*structs.APIKey, error) {
+	return LoadKeys(ctx)
+}
+
+func (s *KeyStore) SaveKey(ctx context.Context, key *structs.APIKey) error {
+	return SaveKey(ctx, key)
+}
+
+func (s *KeyStore) TouchKeys(ctx context.Context, used map[string]time.Time) error {
+	return TouchKeys(ctx, used)
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -9,14 +10,24 @@ import (
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/aidenappl/monitor-core/structs"
+	"github.com/google/uuid"
 )
 
+// ErrInvalidEvent marks an event that ClickHouse refused to accept into a batch
+var ErrInvalidEvent = errors.New("invalid event")
+
 // Conn is the global ClickHouse connection
 var Conn driver.Conn
 
 // Database is the current database name
 var Database string
 
+// ReplacingEvents reports whether the events table is a ReplacingMergeTree,
+// which merges copies of an event. Tables created by 001_schema.sql are a
+// plain MergeTree until migrations/upgrade/006_replacing_merge_tree.sql has
+// been run.
+var ReplacingEvents bool
+
 // Connect establishes a connection to ClickHouse with retry logic
 func Connect(ctx context.Context, addr, database, username, password string) error {
 	var conn driver.Conn
@@ -58,14 +69,32 @@ func Connect(ctx context.Context, addr, database, username, password string) err
 		log.Printf("connected to ClickHouse at %s", addr)
 		Conn = conn
 		Database = database
+		detectEventsEngine(ctx)
 		return nil
 	}
 
 	return fmt.Errorf("failed to connect to clickhouse after 10 attempts: %w", err)
 }
 
-// WriteBatch inserts a batch of events into ClickHouse
-func WriteBatch(ctx context.Context, events []*structs.Event) error {
+// detectEventsEngine sets ReplacingEvents from the engine of the events table
+func detectEventsEngine(ctx context.Context) {
+	var engine string
+	err := Conn.QueryRow(ctx, "SELECT engine FROM system.tables WHERE database = ? AND name = 'events'", Database).Scan(&engine)
+	if err != nil {
+		log.Printf("failed to read events table engine: %v", err)
+		return
+	}
+
+	ReplacingEvents = engine == "ReplacingMergeTree"
+	if !ReplacingEvents {
+		log.Printf("events table is a %s, so copies of retried events are not merged in storage; run migrations/upgrade/006_replacing_merge_tree.sql to convert it", engine)
+	}
+}
+
+// WriteBatch inserts a batch of events into ClickHouse. retentionDays
+// returns how long each tenant's events are kept, zero or nil meaning the
+// table default.
+func WriteBatch(ctx context.Context, events []*structs.Event, retentionDays func(tenant string) uint16) error {
 	if len(events) == 0 {
 		return nil
 	}
@@ -73,15 +102,23 @@ func WriteBatch(ctx context.Context, events []*structs.Event) error {
 	batch, err := Conn.PrepareBatch(ctx, fmt.Sprintf(`
 		INSERT INTO %s.events (
 			timestamp,
+			event_id,
+			received_at,
+			sample_rate,
 			service,
 			env,
 			job_id,
 			request_id,
 			trace_id,
+			span_id,
+			parent_span_id,
 			user_id,
 			name,
 			level,
-			data
+			severity,
+			data,
+			tenant,
+			retention_days
 		)
 	`, Database))
 	if err != nil {
@@ -89,20 +126,37 @@ func WriteBatch(ctx context.Context, events []*structs.Event) error {
 	}
 
 	for _, event := range events {
+		// Rows sharing a sort key and an empty ID would be merged into one.
+		// Events queued before IDs existed, such as old WAL entries, get one
+		// here.
+		if event.EventID == "" {
+			event.EventID = uuid.NewString()
+		}
+		if event.Tenant == "" {
+			event.Tenant = structs.DefaultTenant
+		}
 		err := batch.Append(
 			event.Timestamp,
+			event.EventID,
+			event.ReceivedAt,
+			max(event.SampleRate, 1),
 			event.Service,
 			event.Env,
 			event.JobID,
 			event.RequestID,
 			event.TraceID,
+			event.SpanID,
+			event.ParentSpanID,
 			event.UserID,
 			event.Name,
 			event.Level,
+			event.Severity,
 			event.DataJSON(),
+			event.Tenant,
+			retention(retentionDays, event.Tenant),
 		)
 		if err != nil {
-			return fmt.Errorf("failed to append event to batch: %w", err)
+			return fmt.Errorf("failed to append event to batch: %w: %w", ErrInvalidEvent, err)
 		}
 	}
 
@@ -113,6 +167,99 @@ func WriteBatch(ctx context.Context, events []*structs.Event) error {
 	return nil
 }
 
+// WriteMetrics inserts a batch of metric samples into ClickHouse, keeping
+// each tenant's samples as long as retentionDays returns
+func WriteMetrics(ctx context.Context, samples []*structs.Sample, retentionDays func(tenant string) uint16) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	batch, err := Conn.PrepareBatch(ctx, fmt.Sprintf(`
+		INSERT INTO %s.metrics (
+			timestamp,
+			name,
+			labels,
+			value,
+			tenant,
+			retention_days
+		)
+	`, Database))
+	if err != nil {
+		return fmt.Errorf("failed to prepare batch: %w", err)
+	}
+
+	for _, sample := range samples {
+		tenant := sample.Tenant
+		if tenant == "" {
+			tenant = structs.DefaultTenant
+		}
+		err := batch.Append(
+			sample.Timestamp,
+			sample.Name,
+			sample.Labels,
+			sample.Value,
+			tenant,
+			retention(retentionDays, tenant),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to append sample to batch: %w: %w", ErrInvalidEvent, err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to send batch: %w", err)
+	}
+
+	return nil
+}
+
+// retention returns the retention_days value stored with a tenant's rows
+func retention(retentionDays func(tenant string) uint16, tenant string) uint16 {
+	if retentionDays == nil {
+		return 0
+	}
+	return retentionDays(tenant)
+}
+
+// retryableExceptionCodes are ClickHouse server error codes caused by load or
+// availability rather than by the data being inserted
+var retryableExceptionCodes = map[int32]bool{
+	3:   true, // UNEXPECTED_END_OF_FILE
+	159: true, // TIMEOUT_EXCEEDED
+	164: true, // READONLY
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203: true, // NO_FREE_CONNECTION
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	241: true, // MEMORY_LIMIT_EXCEEDED
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	285: true, // TOO_FEW_LIVE_REPLICAS
+	319: true, // UNKNOWN_STATUS_OF_INSERT
+	425: true, // SYSTEM_ERROR
+	999: true, // KEEPER_EXCEPTION
+}
+
+// IsRetryable reports whether a failed write is worth retrying.
+// Connection problems and transient server errors are retryable; server
+// exceptions about the data or schema and rejected events are permanent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrInvalidEvent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		return retryableExceptionCodes[exception.Code]
+	}
+
+	// Anything else (dial errors, resets, timeouts) is a connection problem
+	return true
+}
+
 // Close closes the ClickHouse connection
 func Close() error {
 	if Conn != nil {
@@ -122,8 +269,19 @@ func Close() error {
 }
 
 // Writer wraps WriteBatch to implement the services.Writer interface
-type Writer struct{}
+type Writer struct {
+	RetentionDays func(tenant string) uint16
+}
 
 func (w *Writer) WriteBatch(ctx context.Context, events []*structs.Event) error {
-	return WriteBatch(ctx, events)
+	return WriteBatch(ctx, events, w.RetentionDays)
+}
+
+// MetricWriter wraps WriteMetrics to implement the services.MetricWriter interface
+type MetricWriter struct {
+	RetentionDays func(tenant string) uint16
+}
+
+func (w *MetricWriter) WriteMetrics(ctx context.Context, samples []*structs.Sample) error {
+	return WriteMetrics(ctx, samples, w.RetentionDays)
 }
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// LoadSchemas returns every registered event schema
+func LoadSchemas(ctx context.Context) ([]*structs.EventSchema, error) {
+	rows, err := Conn.Query(ctx, fmt.Sprintf(`
+		SELECT service, name, mode, schema, created_at, updated_at
+		FROM %s.schemas FINAL
+		WHERE deleted = 0
+	`, Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var schemas []*structs.EventSchema
+	for rows.Next() {
+		var s structs.EventSchema
+		var schema string
+		if err := rows.Scan(&s.Service, &s.Name, &s.Mode, &schema, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema: %w", err)
+		}
+		s.Schema = []byte(schema)
+		schemas = append(schemas, &s)
+	}
+	return schemas, rows.Err()
+}
+
+// SaveSchema registers or replaces an event schema. Rows are versioned by
+// updated_at, so the latest write wins.
+func SaveSchema(ctx context.Context, s *structs.EventSchema) error {
+	return Conn.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s.schemas (service, name, mode, schema, created_at, updated_at, deleted)
+		VALUES (?, ?, ?, ?, ?, ?, 0)
+	`, Database), s.Service, s.Name, s.Mode, string(s.Schema), s.CreatedAt, s.UpdatedAt)
+}
+
+// DeleteSchema removes an event schema by writing a newer, deleted version
+func DeleteSchema(ctx context.Context, service, name string) error {
+	now := time.Now().UTC()
+	return Conn.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s.schemas (service, name, mode, schema, created_at, updated_at, deleted)
+		VALUES (?, ?, '', '', ?, ?, 1)
+	`, Database), service, name, now, now)
+}
+
+// SchemaStore wraps the schema functions to implement the
+// services.SchemaStore interface
+type SchemaStore struct{}
+
+func (s *SchemaStore) LoadSchemas(ctx context.Context) ([]*structs.EventSchema, error) {
+	return LoadSchemas(ctx)
+}
+
+func (s *SchemaStore) SaveSchema(ctx context.Context, schema *structs.EventSchema) error {
+	return SaveSchema(ctx, schema)
+}
+
+func (s *SchemaStore) DeleteSchema(ctx context.Context, service, name string) error {
+	return DeleteSchema(ctx, service, name)
+}
@@ -13,9 +13,46 @@ var (
 	ClickHouseUsername = getEnv("CLICKHOUSE_USERNAME", "default")
 	ClickHousePassword = getEnv("CLICKHOUSE_PASSWORD", "")
 	APIKey             = getEnv("API_KEY", "")
+	TenantsFile        = getEnv("TENANTS_FILE", "")
+	KeyStore           = getEnv("API_KEY_STORE", "")
+	KeyStoreFile       = getEnv("API_KEY_FILE", "api_keys.json")
+	KeyRefresh         = getEnvDuration("API_KEY_REFRESH_INTERVAL", 30*time.Second)
 	BatchSize          = getEnvInt("BATCH_SIZE", 1000)
 	FlushInterval      = getEnvDuration("FLUSH_INTERVAL", 5*time.Second)
 	QueueSize          = getEnvInt("QUEUE_SIZE", 100000)
+	QueueHighWater     = getEnvInt("QUEUE_HIGH_WATER", 90)
+	QueueRetryAfter    = getEnvDuration("QUEUE_RETRY_AFTER", 5*time.Second)
+	WALDir             = getEnv("WAL_DIR", "")
+	WALSegmentSize     = getEnvInt("WAL_SEGMENT_SIZE", 64*1024*1024)
+	WriteMaxRetries    = getEnvInt("WRITE_MAX_RETRIES", 3)
+	WriteRetryBase     = getEnvDuration("WRITE_RETRY_BASE_DELAY", 500*time.Millisecond)
+	WriteRetryMax      = getEnvDuration("WRITE_RETRY_MAX_DELAY", 30*time.Second)
+	DeadLetterDir      = getEnv("DEAD_LETTER_DIR", "")
+	SyslogUDPAddr      = getEnv("SYSLOG_UDP_ADDR", "")
+	SyslogTCPAddr      = getEnv("SYSLOG_TCP_ADDR", "")
+	ESFieldMap         = getEnv("ELASTICSEARCH_FIELD_MAP", "")
+	ESVersion          = getEnv("ELASTICSEARCH_VERSION", "8.17.0")
+	MetricsQueueSize   = getEnvInt("METRICS_QUEUE_SIZE", 500000)
+	MetricsBatchSize   = getEnvInt("METRICS_BATCH_SIZE", 10000)
+	StatsDAddr         = getEnv("STATSD_ADDR", "")
+	StatsDFlush        = getEnvDuration("STATSD_FLUSH_INTERVAL", 10*time.Second)
+	StatsDGaugeTTL     = getEnvDuration("STATSD_GAUGE_TTL", time.Hour)
+	ForwardAddr        = getEnv("FORWARD_ADDR", "")
+	ForwardSharedKey   = getEnv("FORWARD_SHARED_KEY", "")
+	GRPCAddr           = getEnv("GRPC_ADDR", "")
+	MissingTimestamp   = getEnv("MISSING_TIMESTAMP", "reject")
+	EnrichClientIP     = getEnvBool("ENRICH_CLIENT_IP", false)
+	EnrichUserAgent    = getEnvBool("ENRICH_USER_AGENT", false)
+	GeoIPDBPaths       = getEnv("GEOIP_DB_PATHS", "")
+	RedactionRules     = getEnv("REDACTION_RULES_FILE", "")
+	RedactionHMACKey   = getEnv("REDACTION_HMAC_KEY", "")
+	SamplingRules      = getEnv("SAMPLING_RULES_FILE", "")
+	MaxSampleRate      = getEnvInt("MAX_CLIENT_SAMPLE_RATE", 1000)
+	DedupWindowSize    = getEnvInt("DEDUP_WINDOW_SIZE", 100000)
+	DedupWindow        = getEnvDuration("DEDUP_WINDOW", 10*time.Minute)
+	IdempotencyKeys    = getEnvInt("IDEMPOTENCY_CACHE_SIZE", 10000)
+	IdempotencyTTL     = getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	SchemaRefresh      = getEnvDuration("SCHEMA_REFRESH_INTERVAL", 30*time.Second)
 )
 
 func getEnv(key, defaultVal string) string {
@@ -34,6 +71,15 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
 	if val := os.Getenv(key); val != "" {
 		if d, err := time.ParseDuration(val); err == nil {
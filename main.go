@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,13 +17,15 @@ import (
 	"github.com/aidenappl/monitor-core/middleware"
 	"github.com/aidenappl/monitor-core/routes"
 	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"google.golang.org/grpc"
 )
 
 func main() {
 	// Validate configuration
-	if env.APIKey == "" {
+	if env.APIKey == "" && env.TenantsFile == "" && env.KeyStore == "" {
 		log.Println("WARNING: API_KEY is not set, authentication is disabled")
 	}
 
@@ -39,14 +43,173 @@ func main() {
 	}
 	defer db.Close()
 
-	// Create event queue
-	queue := services.NewQueue(env.QueueSize)
+	// Create event queue, backed by the write-ahead log when configured
+	var queue *services.Queue
+	var wal *services.WAL
+	if env.WALDir != "" {
+		// Batches that fail for good must be dead-lettered before the log
+		// can move past them
+		if env.DeadLetterDir == "" {
+			log.Fatalf("❌ WAL_DIR requires DEAD_LETTER_DIR")
+		}
+		var err error
+		wal, err = services.OpenWAL(env.WALDir, int64(env.WALSegmentSize))
+		if err != nil {
+			log.Fatalf("❌ failed to open write-ahead log: %v", err)
+		}
+		log.Printf("write-ahead log enabled at %s", env.WALDir)
+		queue = services.NewDurableQueue(env.QueueSize, wal)
+	} else {
+		queue = services.NewQueue(env.QueueSize)
+	}
+	queue.SetHighWaterMark(env.QueueSize * env.QueueHighWater / 100)
+	var tenants *services.Tenants
+	if env.TenantsFile != "" {
+		var err error
+		tenants, err = services.LoadTenants(env.TenantsFile)
+		if err != nil {
+			log.Fatalf("❌ invalid TENANTS_FILE: %v", err)
+		}
+		log.Printf("%d tenants loaded from %s", tenants.Len(), env.TenantsFile)
+		queue.SetTenants(tenants)
+	}
+	middleware.Tenants = tenants
+	if env.RedactionRules != "" {
+		redactor, err := services.LoadRedactor(env.RedactionRules, []byte(env.RedactionHMACKey))
+		if err != nil {
+			log.Fatalf("❌ invalid REDACTION_RULES_FILE: %v", err)
+		}
+		log.Printf("redaction rules loaded from %s", env.RedactionRules)
+		queue.SetRedactor(redactor)
+	}
+	if env.SamplingRules != "" {
+		sampler, err := services.LoadSampler(env.SamplingRules)
+		if err != nil {
+			log.Fatalf("❌ invalid SAMPLING_RULES_FILE: %v", err)
+		}
+		log.Printf("sampling rules loaded from %s", env.SamplingRules)
+		queue.SetSampler(sampler)
+	}
+	if env.MaxSampleRate > 0 {
+		queue.SetMaxClientSampleRate(uint32(env.MaxSampleRate))
+	}
+	if env.DedupWindowSize > 0 {
+		queue.SetDedupWindow(services.NewDedupWindow(env.DedupWindowSize, env.DedupWindow))
+	}
 	routes.Queue = queue
+	routes.RetryAfter = env.QueueRetryAfter
+	if env.IdempotencyKeys > 0 {
+		routes.Idempotency = services.NewIdempotencyCache(env.IdempotencyKeys, env.IdempotencyTTL)
+	}
+
+	switch env.MissingTimestamp {
+	case "reject":
+	case "receive_time":
+		routes.DefaultTimestamp = true
+	default:
+		log.Fatalf("❌ invalid MISSING_TIMESTAMP %q: use reject or receive_time", env.MissingTimestamp)
+	}
+
+	// Configure which request details are added to ingested events
+	enrichment := services.NewEnrichmentPipeline()
+	if env.EnrichClientIP {
+		enrichment.Add(services.ClientIPEnricher{})
+	}
+	if env.GeoIPDBPaths != "" {
+		geoIP, err := services.NewGeoIPEnricher(strings.Split(env.GeoIPDBPaths, ",")...)
+		if err != nil {
+			log.Fatalf("❌ failed to open GeoIP database: %v", err)
+		}
+		enrichment.Add(geoIP)
+		log.Printf("GeoIP enrichment enabled from %s", env.GeoIPDBPaths)
+	}
+	if env.EnrichUserAgent {
+		enrichment.Add(services.UserAgentEnricher{})
+	}
+	routes.Enrichment = enrichment
+
+	// Load event data schemas, reloading them to pick up changes made
+	// through other instances
+	schemas := services.NewSchemaRegistry(&db.SchemaStore{})
+	if err := schemas.Load(ctx); err != nil {
+		log.Printf("WARNING: failed to load event schemas: %v", err)
+	}
+	routes.Schemas = schemas
+	go schemas.Run(ctx, env.SchemaRefresh)
+
+	// Load managed API keys, reloading them to pick up keys created, rotated
+	// or revoked through other instances
+	var keys *services.APIKeys
+	switch env.KeyStore {
+	case "":
+	case "clickhouse":
+		keys = services.NewAPIKeys(&db.KeyStore{})
+	case "file":
+		keys = services.NewAPIKeys(services.NewFileKeyStore(env.KeyStoreFile))
+	default:
+		log.Fatalf("❌ invalid API_KEY_STORE %q: must be clickhouse or file", env.KeyStore)
+	}
+	if keys != nil {
+		if err := keys.Load(ctx); err != nil {
+			log.Fatalf("❌ failed to load api keys: %v", err)
+		}
+		log.Printf("%d api keys loaded from %s store", keys.Len(), env.KeyStore)
+		if keys.Len() == 0 && env.APIKey == "" && tenants.Len() == 0 {
+			log.Println("WARNING: no api keys exist yet and API_KEY is not set, so none can be created")
+		}
+		middleware.Keys = keys
+		routes.Keys = keys
+		go keys.Run(ctx, env.KeyRefresh)
+	}
+
+	// Configure how Elasticsearch bulk documents map onto events
+	if env.ESFieldMap != "" {
+		mapping, err := services.ParseESFieldMapping(env.ESFieldMap)
+		if err != nil {
+			log.Fatalf("❌ invalid ELASTICSEARCH_FIELD_MAP: %v", err)
+		}
+		routes.ESFieldMapping = mapping
+	}
+	routes.ESVersion = env.ESVersion
 
 	// Create and start batcher
-	writer := &db.Writer{}
+	writer := &db.Writer{RetentionDays: tenants.RetentionDays}
 	batcher := services.NewBatcher(queue, writer, env.BatchSize, env.FlushInterval)
-	go batcher.Run(ctx)
+	batcher.SetRetryPolicy(services.RetryPolicy{
+		MaxRetries: env.WriteMaxRetries,
+		BaseDelay:  env.WriteRetryBase,
+		MaxDelay:   env.WriteRetryMax,
+		Retryable:  db.IsRetryable,
+	})
+	if env.DeadLetterDir != "" {
+		deadLetter, err := services.NewDeadLetter(env.DeadLetterDir)
+		if err != nil {
+			log.Fatalf("❌ failed to open dead-letter directory: %v", err)
+		}
+		log.Printf("dead-letter sink enabled at %s", env.DeadLetterDir)
+		batcher.SetDeadLetter(deadLetter)
+	}
+	routes.Batcher = batcher
+	batcherDone := make(chan struct{})
+	go func() {
+		batcher.Run(ctx)
+		close(batcherDone)
+	}()
+
+	// Create and start the metrics batcher (Prometheus remote_write samples)
+	metricBatcher := services.NewMetricBatcher(&db.MetricWriter{RetentionDays: tenants.RetentionDays}, env.MetricsQueueSize, env.MetricsBatchSize, env.FlushInterval)
+	metricBatcher.SetRetryPolicy(services.RetryPolicy{
+		MaxRetries: env.WriteMaxRetries,
+		BaseDelay:  env.WriteRetryBase,
+		MaxDelay:   env.WriteRetryMax,
+		Retryable:  db.IsRetryable,
+	})
+	routes.MetricBatcher = metricBatcher
+	metricBatcherDone := make(chan struct{})
+	go func() {
+		metricBatcher.Run(ctx)
+		close(metricBatcherDone)
+	}()
 
 	// Setup router
 	r := mux.NewRouter()
@@ -56,24 +219,74 @@ func main() {
 
 	r.HandleFunc("/health", routes.HealthHandler).Methods(http.MethodGet)
 
+	// WebSocket ingest authenticates itself, since browsers cannot send
+	// X-Api-Key on the handshake
+	r.HandleFunc("/v1/events/ws", routes.EventsWebSocketHandler).Methods(http.MethodGet)
+
 	// V1 API routes (with auth middleware)
 	v1 := r.PathPrefix("/v1").Subrouter()
 	v1.Use(middleware.AuthMiddleware)
 
-	v1.HandleFunc("/events", routes.IngestEventsHandler).Methods(http.MethodPost)
-	v1.HandleFunc("/events", routes.QueryEventsHandler).Methods(http.MethodGet)
-	v1.HandleFunc("/labels/{label}/values", routes.GetLabelValuesHandler).Methods(http.MethodGet)
-	v1.HandleFunc("/data/keys", routes.GetDataKeysHandler).Methods(http.MethodGet)
-	v1.HandleFunc("/data/values", routes.GetDataValuesHandler).Methods(http.MethodGet)
+	// Each route requires the API key scope it is wrapped in
+	ingest := middleware.RequireScope(structs.ScopeIngest)
+	query := middleware.RequireScope(structs.ScopeQuery)
+	admin := middleware.RequireScope(structs.ScopeAdmin)
+
+	// State shared by all tenants is only open to the default tenant
+	shared := middleware.RequireDefaultTenant
+
+	v1.HandleFunc("/events", ingest(routes.IngestEventsHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/events", query(routes.QueryEventsHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/labels/{label}/values", query(routes.GetLabelValuesHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/data/keys", query(routes.GetDataKeysHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/data/values", query(routes.GetDataValuesHandler)).Methods(http.MethodGet)
+
+	// Event schema registry
+	v1.HandleFunc("/schemas", query(shared(routes.ListSchemasHandler))).Methods(http.MethodGet)
+	v1.HandleFunc("/schemas/{service}/{name}", query(shared(routes.GetSchemaHandler))).Methods(http.MethodGet)
+	v1.HandleFunc("/schemas/{service}/{name}", admin(shared(routes.PutSchemaHandler))).Methods(http.MethodPut)
+	v1.HandleFunc("/schemas/{service}/{name}", admin(shared(routes.DeleteSchemaHandler))).Methods(http.MethodDelete)
+
+	// OpenTelemetry (OTLP/HTTP) receivers
+	v1.HandleFunc("/otlp/logs", ingest(routes.OTLPLogsHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/otlp/traces", ingest(routes.OTLPTracesHandler)).Methods(http.MethodPost)
 
 	// Analytics routes (Grafana-compatible)
-	v1.HandleFunc("/analytics", routes.AnalyticsHandler).Methods(http.MethodPost)
-	v1.HandleFunc("/analytics", routes.AnalyticsQueryHandler).Methods(http.MethodGet)
-	v1.HandleFunc("/timeseries", routes.TimeSeriesHandler).Methods(http.MethodPost)
-	v1.HandleFunc("/timeseries", routes.TimeSeriesQueryHandler).Methods(http.MethodGet)
-	v1.HandleFunc("/topn", routes.TopNHandler).Methods(http.MethodPost)
-	v1.HandleFunc("/gauge", routes.GaugeHandler).Methods(http.MethodPost)
-	v1.HandleFunc("/compare", routes.CompareHandler).Methods(http.MethodPost)
+	v1.HandleFunc("/analytics", query(routes.AnalyticsHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/analytics", query(routes.AnalyticsQueryHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/timeseries", query(routes.TimeSeriesHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/timeseries", query(routes.TimeSeriesQueryHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/topn", query(routes.TopNHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/gauge", query(routes.GaugeHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/compare", query(routes.CompareHandler)).Methods(http.MethodPost)
+
+	// Admin routes
+	v1.HandleFunc("/admin/deadletter", admin(shared(routes.ListDeadLetterHandler))).Methods(http.MethodGet)
+	v1.HandleFunc("/admin/deadletter/redrive", admin(shared(routes.RedriveDeadLetterHandler))).Methods(http.MethodPost)
+	v1.HandleFunc("/admin/keys", admin(routes.ListKeysHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/admin/keys", admin(routes.CreateKeyHandler)).Methods(http.MethodPost)
+	v1.HandleFunc("/admin/keys/{id}", admin(routes.GetKeyHandler)).Methods(http.MethodGet)
+	v1.HandleFunc("/admin/keys/{id}", admin(routes.RevokeKeyHandler)).Methods(http.MethodDelete)
+	v1.HandleFunc("/admin/keys/{id}/rotate", admin(routes.RotateKeyHandler)).Methods(http.MethodPost)
+
+	// Loki push API (Promtail, Alloy and other Loki clients)
+	loki := r.PathPrefix("/loki/api/v1").Subrouter()
+	loki.Use(middleware.AuthMiddleware)
+	loki.HandleFunc("/push", ingest(routes.LokiPushHandler)).Methods(http.MethodPost)
+
+	// Prometheus remote_write
+	prom := r.PathPrefix("/api/v1").Subrouter()
+	prom.Use(middleware.BasicAuthAPIKeyMiddleware)
+	prom.Use(middleware.AuthMiddleware)
+	prom.HandleFunc("/write", ingest(routes.PrometheusWriteHandler)).Methods(http.MethodPost)
+
+	// Elasticsearch bulk API (Beats, Logstash, Fluent Bit and other Elasticsearch outputs)
+	es := r.NewRoute().Subrouter()
+	es.Use(middleware.BasicAuthAPIKeyMiddleware)
+	es.Use(middleware.AuthMiddleware)
+	es.HandleFunc("/", routes.ElasticsearchInfoHandler).Methods(http.MethodGet, http.MethodHead)
+	es.HandleFunc("/_bulk", ingest(routes.ElasticsearchBulkHandler)).Methods(http.MethodPost, http.MethodPut)
+	es.HandleFunc("/{index}/_bulk", ingest(routes.ElasticsearchBulkHandler)).Methods(http.MethodPost, http.MethodPut)
 
 	// CORS Middleware
 	corsMiddleware := cors.New(cors.Options{
@@ -101,6 +314,63 @@ func main() {
 		}
 	}()
 
+	// Start syslog listeners when configured
+	syslogServer := services.NewSyslogServer(queue)
+	syslogServer.SetSchemas(schemas)
+	if env.SyslogUDPAddr != "" {
+		if err := syslogServer.ListenUDP(env.SyslogUDPAddr); err != nil {
+			log.Fatalf("❌ failed to start syslog UDP listener: %v", err)
+		}
+		log.Printf("syslog listening on udp %s", env.SyslogUDPAddr)
+	}
+	if env.SyslogTCPAddr != "" {
+		if err := syslogServer.ListenTCP(env.SyslogTCPAddr); err != nil {
+			log.Fatalf("❌ failed to start syslog TCP listener: %v", err)
+		}
+		log.Printf("syslog listening on tcp %s", env.SyslogTCPAddr)
+	}
+
+	// Start Fluentd Forward protocol listener when configured
+	forwardServer := services.NewForwardServer(queue, routes.ESFieldMapping)
+	forwardServer.SetSharedKey(env.ForwardSharedKey)
+	forwardServer.SetSchemas(schemas)
+	if env.ForwardAddr != "" {
+		if err := forwardServer.ListenTCP(env.ForwardAddr); err != nil {
+			log.Fatalf("❌ failed to start forward listener: %v", err)
+		}
+		log.Printf("forward protocol listening on tcp %s", env.ForwardAddr)
+		if env.ForwardSharedKey == "" {
+			log.Println("WARNING: FORWARD_SHARED_KEY is not set, forward connections are not authenticated")
+		}
+	}
+
+	// Start StatsD listener when configured
+	statsdServer := services.NewStatsDServer(metricBatcher, env.StatsDFlush)
+	statsdServer.SetGaugeTTL(env.StatsDGaugeTTL)
+	if env.StatsDAddr != "" {
+		if err := statsdServer.ListenUDP(env.StatsDAddr); err != nil {
+			log.Fatalf("❌ failed to start statsd listener: %v", err)
+		}
+		log.Printf("statsd listening on udp %s", env.StatsDAddr)
+	}
+
+	// Start the gRPC ingestion server when configured (cleartext HTTP/2)
+	var grpcServer *grpc.Server
+	if env.GRPCAddr != "" {
+		listener, err := net.Listen("tcp", env.GRPCAddr)
+		if err != nil {
+			log.Fatalf("❌ failed to start grpc listener: %v", err)
+		}
+		grpcServer = routes.NewGRPCServer()
+
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("gRPC server error: %v", err)
+			}
+		}()
+		log.Printf("grpc listening on %s", env.GRPCAddr)
+	}
+
 	// Wait for shutdown signal
 	<-sigChan
 	log.Println("shutting down...")
@@ -112,10 +382,51 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	routes.CloseWebSockets(shutdownCtx)
+	if grpcServer != nil {
+		routes.CloseGRPCStreams()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			log.Printf("gRPC server shutdown error: %v", shutdownCtx.Err())
+			grpcServer.Stop()
+		}
+	}
+	syslogServer.Close()
+	forwardServer.Close()
+	statsdServer.Close()
 
-	cancel()
+	// Let the batchers drain their queues before cancelling them
 	queue.Close()
-	time.Sleep(2 * time.Second)
+	metricBatcher.Close()
+	select {
+	case <-batcherDone:
+	case <-shutdownCtx.Done():
+		log.Println("timed out waiting for batcher to drain queue")
+	}
+	select {
+	case <-metricBatcherDone:
+	case <-shutdownCtx.Done():
+		log.Println("timed out waiting for metrics batcher to drain queue")
+	}
+	cancel()
+
+	if keys != nil {
+		if err := keys.FlushUsage(shutdownCtx); err != nil {
+			log.Printf("failed to record api key usage: %v", err)
+		}
+	}
+
+	if wal != nil {
+		if err := wal.Close(); err != nil {
+			log.Printf("write-ahead log close error: %v", err)
+		}
+	}
 
 	log.Println("shutdown complete")
 }
@@ -1,25 +1,100 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 
 	"github.com/aidenappl/monitor-core/env"
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
 )
 
-// AuthMiddleware checks the X-Api-Key header
+// Tenants maps API keys onto tenants (set from main.go)
+var Tenants *services.Tenants
+
+// Keys holds the API keys managed through the admin API (set from main.go)
+var Keys *services.APIKeys
+
+// AuthMiddleware checks the X-Api-Key header and scopes the request to the
+// key's tenant
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// If no API key is configured, allow all requests (for development)
-		if env.APIKey == "" {
-			next.ServeHTTP(w, r)
+		key, ok := Authenticate(r.Header.Get("X-Api-Key"))
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		if r.Header.Get("X-Api-Key") != env.APIKey {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		next.ServeHTTP(w, r.WithContext(services.WithAPIKey(r.Context(), key)))
+	})
+}
+
+// RequireScope wraps handlers that only keys with scope may call. It must
+// run after AuthMiddleware.
+func RequireScope(scope string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if key := services.APIKeyFromContext(r.Context()); key == nil || !key.HasScope(scope) {
+				http.Error(w, "Forbidden: API key lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// Authenticate returns the key a secret belongs to, for handlers such as
+// gRPC that report auth failures in their own protocol. API_KEY may be used
+// for everything and belongs to the default tenant; the keys in TENANTS_FILE
+// have the scopes their tenant lists.
+func Authenticate(secret string) (*structs.APIKey, bool) {
+	if key, ok := Keys.Authenticate(secret); ok {
+		return key, true
+	}
+	if tenant, ok := Tenants.Lookup(secret); ok {
+		return &structs.APIKey{Name: "tenant " + tenant, Tenant: tenant, Scopes: Tenants.Scopes(tenant)}, true
+	}
+	// If no API key, tenant or key store is configured, allow all requests
+	// (for development)
+	if env.APIKey == "" && Tenants.Len() == 0 && Keys == nil {
+		return unrestrictedKey("", structs.DefaultTenant), true
+	}
+	if env.APIKey != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(env.APIKey)) == 1 {
+		return unrestrictedKey("API_KEY", structs.DefaultTenant), true
+	}
+	return nil, false
+}
+
+func unrestrictedKey(name, tenant string) *structs.APIKey {
+	return &structs.APIKey{Name: name, Tenant: tenant, Scopes: structs.Scopes}
+}
+
+// RequireDefaultTenant wraps handlers for state shared by all tenants and
+// services, such as event schemas and dead letters, which only keys of the
+// default tenant without service or env restrictions may use. It must run
+// after AuthMiddleware.
+func RequireDefaultTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if services.TenantFromContext(r.Context()) != structs.DefaultTenant || services.APIKeyFromContext(r.Context()).Restricted() {
+			http.Error(w, "Forbidden: only unrestricted keys of the default tenant may use this endpoint", http.StatusForbidden)
 			return
 		}
 
+		next(w, r)
+	}
+}
+
+// BasicAuthAPIKeyMiddleware lets clients that only support HTTP basic auth,
+// such as Elasticsearch outputs, send the API key as the password
+func BasicAuthAPIKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") == "" {
+			if _, password, ok := r.BasicAuth(); ok {
+				r.Header.Set("X-Api-Key", password)
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
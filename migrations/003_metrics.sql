@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS monitor.metrics
+(
+    timestamp DateTime64(3, 'UTC'),
+    name LowCardinality(String),
+    labels Map(LowCardinality(String), String),
+    value Float64,
+    _inserted_at DateTime64(3, 'UTC') DEFAULT now64(3),
+
+    INDEX idx_label_keys mapKeys(labels) TYPE bloom_filter(0.01) GRANULARITY 4,
+    INDEX idx_label_values mapValues(labels) TYPE bloom_filter(0.01) GRANULARITY 4
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMMDD(timestamp)
+ORDER BY (name, timestamp)
+TTL toDate(timestamp) + INTERVAL 30 DAY
+SETTINGS index_granularity = 8192;
@@ -0,0 +1 @@
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS received_at DateTime64(3, 'UTC') DEFAULT _inserted_at AFTER timestamp;
@@ -0,0 +1 @@
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS sample_rate UInt32 DEFAULT 1 AFTER received_at;
@@ -0,0 +1,2 @@
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS event_id String AFTER timestamp;
+ALTER TABLE monitor.events ADD INDEX IF NOT EXISTS idx_event_id event_id TYPE bloom_filter(0.01) GRANULARITY 4;
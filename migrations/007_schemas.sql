@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS monitor.schemas
+(
+    service LowCardinality(String),
+    name String,
+    mode LowCardinality(String),
+    schema String,
+    created_at DateTime64(3, 'UTC'),
+    updated_at DateTime64(3, 'UTC'),
+    deleted UInt8 DEFAULT 0
+)
+ENGINE = ReplacingMergeTree(updated_at, deleted)
+ORDER BY (service, name);
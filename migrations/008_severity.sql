@@ -0,0 +1,18 @@
+-- Rows written before levels were normalized get their severity from the
+-- level text; their level column keeps its original spelling
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS severity UInt8 DEFAULT multiIf(
+    lower(level) IN ('trace', 'trc', 'verbose', 'finest', 'finer', 'v'), 1,
+    lower(level) IN ('debug', 'dbg', 'fine', 'config', 'd'), 5,
+    lower(level) IN ('info', 'inf', 'information', 'informational', 'notice', 'i'), 9,
+    lower(level) IN ('warn', 'wrn', 'warning', 'w'), 13,
+    lower(level) IN ('error', 'err', 'eror', 'severe', 'e'), 17,
+    lower(level) IN ('fatal', 'ftl', 'critical', 'crit', 'emerg', 'emergency', 'alert', 'panic', 'dpanic', 'f'), 21,
+    toInt32OrZero(level) >= 50, 21,
+    toInt32OrZero(level) >= 40, 17,
+    toInt32OrZero(level) >= 30, 13,
+    toInt32OrZero(level) >= 20, 9,
+    toInt32OrZero(level) >= 10, 5,
+    toInt32OrZero(level) >= 1, 1,
+    0
+) AFTER level;
+ALTER TABLE monitor.events ADD INDEX IF NOT EXISTS idx_severity severity TYPE minmax GRANULARITY 4;
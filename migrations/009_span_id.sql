@@ -0,0 +1,4 @@
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS span_id String AFTER trace_id;
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS parent_span_id String AFTER span_id;
+ALTER TABLE monitor.events ADD INDEX IF NOT EXISTS idx_span_id span_id TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE monitor.events ADD INDEX IF NOT EXISTS idx_parent_span_id parent_span_id TYPE bloom_filter(0.01) GRANULARITY 4;
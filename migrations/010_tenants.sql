@@ -0,0 +1,21 @@
+-- Rows written before tenants existed belong to the default tenant. The
+-- sorting key is left alone, as a column can only be appended to it by the
+-- ALTER that adds the column; upgrade/006_replacing_merge_tree.sql sorts by
+-- tenant so events of different tenants that share an event ID are not
+-- merged into one.
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS tenant LowCardinality(String) DEFAULT 'default' AFTER event_id;
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS retention_days UInt16 DEFAULT 0 AFTER tenant;
+ALTER TABLE monitor.events ADD INDEX IF NOT EXISTS idx_tenant tenant TYPE set(100) GRANULARITY 4;
+
+-- retention_days is each tenant's retention, zero keeping the 30 day default.
+-- Existing rows keep the default, so there is nothing to rewrite.
+ALTER TABLE monitor.events
+    MODIFY TTL toDate(timestamp) + toIntervalDay(if(retention_days = 0, 30, retention_days))
+    SETTINGS materialize_ttl_after_modify = 0;
+
+ALTER TABLE monitor.metrics ADD COLUMN IF NOT EXISTS tenant LowCardinality(String) DEFAULT 'default';
+ALTER TABLE monitor.metrics ADD COLUMN IF NOT EXISTS retention_days UInt16 DEFAULT 0 AFTER tenant;
+ALTER TABLE monitor.metrics ADD INDEX IF NOT EXISTS idx_tenant tenant TYPE set(100) GRANULARITY 4;
+ALTER TABLE monitor.metrics
+    MODIFY TTL toDate(timestamp) + toIntervalDay(if(retention_days = 0, 30, retention_days))
+    SETTINGS materialize_ttl_after_modify = 0;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS monitor.api_keys
+(
+    id String,
+    name String,
+    prefix String,
+    hash String,
+    tenant LowCardinality(String),
+    scopes Array(LowCardinality(String)),
+    services Array(String),
+    envs Array(String),
+    expires_at Nullable(DateTime64(3, 'UTC')),
+    created_at DateTime64(3, 'UTC'),
+    updated_at DateTime64(3, 'UTC'),
+    revoked_at Nullable(DateTime64(3, 'UTC'))
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id;
+
+-- Kept apart from api_keys so recording a use never overwrites a change made
+-- to the key by another instance
+CREATE TABLE IF NOT EXISTS monitor.api_key_usage
+(
+    id String,
+    last_used_at DateTime64(3, 'UTC')
+)
+ENGINE = ReplacingMergeTree(last_used_at)
+ORDER BY id;
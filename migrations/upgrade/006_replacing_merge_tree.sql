@@ -0,0 +1,32 @@
+-- Rebuilds the events table created by 001_schema.sql as a
+-- ReplacingMergeTree keyed on event_id, so retried events are stored once.
+-- Run it once, with monitor-core stopped:
+--
+--   clickhouse-client --multiquery < migrations/upgrade/006_replacing_merge_tree.sql
+--
+-- Existing rows get random event IDs. The old table is kept as
+-- monitor.events_rebuild; drop it once the new one has been checked.
+
+DROP TABLE IF EXISTS monitor.events_rebuild;
+
+-- Columns the new sorting key and TTL use, as added by the numbered
+-- migrations, so the script works whether or not they have been run
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS event_id String AFTER timestamp;
+ALTER TABLE monitor.events ADD INDEX IF NOT EXISTS idx_event_id event_id TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS tenant LowCardinality(String) DEFAULT 'default' AFTER event_id;
+ALTER TABLE monitor.events ADD COLUMN IF NOT EXISTS retention_days UInt16 DEFAULT 0 AFTER tenant;
+
+-- Same columns and indexes as the current table, so columns added by later
+-- migrations carry over
+CREATE TABLE monitor.events_rebuild AS monitor.events
+ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMMDD(timestamp)
+ORDER BY (timestamp, service, trace_id, request_id, event_id, tenant)
+TTL toDate(timestamp) + toIntervalDay(if(retention_days = 0, 30, retention_days))
+SETTINGS index_granularity = 8192;
+
+INSERT INTO monitor.events_rebuild
+SELECT * REPLACE (if(event_id = '', toString(generateUUIDv4()), event_id) AS event_id)
+FROM monitor.events;
+
+EXCHANGE TABLES monitor.events AND monitor.events_rebuild;
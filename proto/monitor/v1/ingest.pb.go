@@ -0,0 +1,477 @@
+// gRPC ingestion API for monitor-core. Serve with GRPC_ADDR and generate
+// clients with protoc or buf; the server speaks cleartext HTTP/2 (h2c).
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: monitor/v1/ingest.proto
+
+package monitorv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// IngestRequest is also accepted as an application/x-protobuf body by
+// POST /v1/events
+type IngestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestRequest) Reset() {
+	*x = IngestRequest{}
+	mi := &file_monitor_v1_ingest_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRequest) ProtoMessage() {}
+
+func (x *IngestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_monitor_v1_ingest_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRequest.ProtoReflect.Descriptor instead.
+func (*IngestRequest) Descriptor() ([]byte, []int) {
+	return file_monitor_v1_ingest_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *IngestRequest) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+// Event has the same fields and validation rules as the JSON event format
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // required
+	Service       string                 `protobuf:"bytes,2,opt,name=service,proto3" json:"service,omitempty"`     // required
+	Env           string                 `protobuf:"bytes,3,opt,name=env,proto3" json:"env,omitempty"`
+	JobId         string                 `protobuf:"bytes,4,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`             // UUID
+	RequestId     string                 `protobuf:"bytes,5,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // UUID
+	TraceId       string                 `protobuf:"bytes,6,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`       // UUID, or 16 or 32 hex characters
+	UserId        string                 `protobuf:"bytes,7,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Name          string                 `protobuf:"bytes,8,opt,name=name,proto3" json:"name,omitempty"` // required
+	Level         string                 `protobuf:"bytes,9,opt,name=level,proto3" json:"level,omitempty"`
+	Data          *structpb.Struct       `protobuf:"bytes,10,opt,name=data,proto3" json:"data,omitempty"`
+	EventId       string                 `protobuf:"bytes,11,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"` // deduplicates retries; generated when empty
+	Severity      uint32                 `protobuf:"varint,12,opt,name=severity,proto3" json:"severity,omitempty"`             // OpenTelemetry severity number, 1-24
+	SpanId        string                 `protobuf:"bytes,13,opt,name=span_id,json=spanId,proto3" json:"span_id,omitempty"`    // 16 hex characters
+	ParentSpanId  string                 `protobuf:"bytes,14,opt,name=parent_span_id,json=parentSpanId,proto3" json:"parent_span_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_monitor_v1_ingest_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_monitor_v1_ingest_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_monitor_v1_ingest_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Event) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Event) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Event) GetEnv() string {
+	if x != nil {
+		return x.Env
+	}
+	return ""
+}
+
+func (x *Event) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *Event) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Event) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *Event) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Event) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Event) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *Event) GetData() *structpb.Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Event) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *Event) GetSeverity() uint32 {
+	if x != nil {
+		return x.Severity
+	}
+	return 0
+}
+
+func (x *Event) GetSpanId() string {
+	if x != nil {
+		return x.SpanId
+	}
+	return ""
+}
+
+func (x *Event) GetParentSpanId() string {
+	if x != nil {
+		return x.ParentSpanId
+	}
+	return ""
+}
+
+type IngestResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 1-based position of the acknowledged request in the stream
+	Sequence uint64 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// Counts for the acknowledged request
+	Accepted uint64        `protobuf:"varint,2,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Dropped  uint64        `protobuf:"varint,3,opt,name=dropped,proto3" json:"dropped,omitempty"`   // valid but refused because the queue was full; resend them
+	Rejected uint64        `protobuf:"varint,4,opt,name=rejected,proto3" json:"rejected,omitempty"` // failed validation; see errors
+	Errors   []*EventError `protobuf:"bytes,5,rep,name=errors,proto3" json:"errors,omitempty"`
+	// Counts for the whole stream so far
+	TotalAccepted uint64 `protobuf:"varint,6,opt,name=total_accepted,json=totalAccepted,proto3" json:"total_accepted,omitempty"`
+	TotalDropped  uint64 `protobuf:"varint,7,opt,name=total_dropped,json=totalDropped,proto3" json:"total_dropped,omitempty"`
+	TotalRejected uint64 `protobuf:"varint,8,opt,name=total_rejected,json=totalRejected,proto3" json:"total_rejected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResponse) Reset() {
+	*x = IngestResponse{}
+	mi := &file_monitor_v1_ingest_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResponse) ProtoMessage() {}
+
+func (x *IngestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_monitor_v1_ingest_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResponse.ProtoReflect.Descriptor instead.
+func (*IngestResponse) Descriptor() ([]byte, []int) {
+	return file_monitor_v1_ingest_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *IngestResponse) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetAccepted() uint64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetRejected() uint64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetErrors() []*EventError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *IngestResponse) GetTotalAccepted() uint64 {
+	if x != nil {
+		return x.TotalAccepted
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetTotalDropped() uint64 {
+	if x != nil {
+		return x.TotalDropped
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetTotalRejected() uint64 {
+	if x != nil {
+		return x.TotalRejected
+	}
+	return 0
+}
+
+type EventError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         uint32                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"` // 0-based position of the event in the request
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventError) Reset() {
+	*x = EventError{}
+	mi := &file_monitor_v1_ingest_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventError) ProtoMessage() {}
+
+func (x *EventError) ProtoReflect() protoreflect.Message {
+	mi := &file_monitor_v1_ingest_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventError.ProtoReflect.Descriptor instead.
+func (*EventError) Descriptor() ([]byte, []int) {
+	return file_monitor_v1_ingest_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EventError) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *EventError) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_monitor_v1_ingest_proto protoreflect.FileDescriptor
+
+const file_monitor_v1_ingest_proto_rawDesc = "" +
+	"\n" +
+	"\x17monitor/v1/ingest.proto\x12\n" +
+	"monitor.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\":\n" +
+	"\rIngestRequest\x12)\n" +
+	"\x06events\x18\x01 \x03(\v2\x11.monitor.v1.EventR\x06events\"\xa4\x03\n" +
+	"\x05Event\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x18\n" +
+	"\aservice\x18\x02 \x01(\tR\aservice\x12\x10\n" +
+	"\x03env\x18\x03 \x01(\tR\x03env\x12\x15\n" +
+	"\x06job_id\x18\x04 \x01(\tR\x05jobId\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x05 \x01(\tR\trequestId\x12\x19\n" +
+	"\btrace_id\x18\x06 \x01(\tR\atraceId\x12\x17\n" +
+	"\auser_id\x18\a \x01(\tR\x06userId\x12\x12\n" +
+	"\x04name\x18\b \x01(\tR\x04name\x12\x14\n" +
+	"\x05level\x18\t \x01(\tR\x05level\x12+\n" +
+	"\x04data\x18\n" +
+	" \x01(\v2\x17.google.protobuf.StructR\x04data\x12\x19\n" +
+	"\bevent_id\x18\v \x01(\tR\aeventId\x12\x1a\n" +
+	"\bseverity\x18\f \x01(\rR\bseverity\x12\x17\n" +
+	"\aspan_id\x18\r \x01(\tR\x06spanId\x12$\n" +
+	"\x0eparent_span_id\x18\x0e \x01(\tR\fparentSpanId\"\xa1\x02\n" +
+	"\x0eIngestResponse\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x12\x1a\n" +
+	"\baccepted\x18\x02 \x01(\x04R\baccepted\x12\x18\n" +
+	"\adropped\x18\x03 \x01(\x04R\adropped\x12\x1a\n" +
+	"\brejected\x18\x04 \x01(\x04R\brejected\x12.\n" +
+	"\x06errors\x18\x05 \x03(\v2\x16.monitor.v1.EventErrorR\x06errors\x12%\n" +
+	"\x0etotal_accepted\x18\x06 \x01(\x04R\rtotalAccepted\x12#\n" +
+	"\rtotal_dropped\x18\a \x01(\x04R\ftotalDropped\x12%\n" +
+	"\x0etotal_rejected\x18\b \x01(\x04R\rtotalRejected\"8\n" +
+	"\n" +
+	"EventError\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error2T\n" +
+	"\rIngestService\x12C\n" +
+	"\x06Ingest\x12\x19.monitor.v1.IngestRequest\x1a\x1a.monitor.v1.IngestResponse(\x010\x01B>Z<github.com/aidenappl/monitor-core/proto/monitor/v1;monitorv1b\x06proto3"
+
+var (
+	file_monitor_v1_ingest_proto_rawDescOnce sync.Once
+	file_monitor_v1_ingest_proto_rawDescData []byte
+)
+
+func file_monitor_v1_ingest_proto_rawDescGZIP() []byte {
+	file_monitor_v1_ingest_proto_rawDescOnce.Do(func() {
+		file_monitor_v1_ingest_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_monitor_v1_ingest_proto_rawDesc), len(file_monitor_v1_ingest_proto_rawDesc)))
+	})
+	return file_monitor_v1_ingest_proto_rawDescData
+}
+
+var file_monitor_v1_ingest_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_monitor_v1_ingest_proto_goTypes = []any{
+	(*IngestRequest)(nil),         // 0: monitor.v1.IngestRequest
+	(*Event)(nil),                 // 1: monitor.v1.Event
+	(*IngestResponse)(nil),        // 2: monitor.v1.IngestResponse
+	(*EventError)(nil),            // 3: monitor.v1.EventError
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),       // 5: google.protobuf.Struct
+}
+var file_monitor_v1_ingest_proto_depIdxs = []int32{
+	1, // 0: monitor.v1.IngestRequest.events:type_name -> monitor.v1.Event
+	4, // 1: monitor.v1.Event.timestamp:type_name -> google.protobuf.Timestamp
+	5, // 2: monitor.v1.Event.data:type_name -> google.protobuf.Struct
+	3, // 3: monitor.v1.IngestResponse.errors:type_name -> monitor.v1.EventError
+	0, // 4: monitor.v1.IngestService.Ingest:input_type -> monitor.v1.IngestRequest
+	2, // 5: monitor.v1.IngestService.Ingest:output_type -> monitor.v1.IngestResponse
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_monitor_v1_ingest_proto_init() }
+func file_monitor_v1_ingest_proto_init() {
+	if File_monitor_v1_ingest_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_monitor_v1_ingest_proto_rawDesc), len(file_monitor_v1_ingest_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_monitor_v1_ingest_proto_goTypes,
+		DependencyIndexes: file_monitor_v1_ingest_proto_depIdxs,
+		MessageInfos:      file_monitor_v1_ingest_proto_msgTypes,
+	}.Build()
+	File_monitor_v1_ingest_proto = out.File
+	file_monitor_v1_ingest_proto_goTypes = nil
+	file_monitor_v1_ingest_proto_depIdxs = nil
+}
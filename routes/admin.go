@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aidenappl/monitor-core/responder"
+	"github.com/aidenappl/monitor-core/services"
+)
+
+// Batcher is the global event batcher (set from main.go)
+var Batcher *services.Batcher
+
+// ListDeadLetterHandler handles GET /v1/admin/deadletter requests
+// Lists dead-letter files waiting to be re-driven
+func ListDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter := Batcher.DeadLetter()
+	if deadLetter == nil {
+		responder.Error(w, http.StatusNotFound, "dead-letter sink is not configured")
+		return
+	}
+
+	files, err := deadLetter.List()
+	if err != nil {
+		responder.ErrorWithCause(w, http.StatusInternalServerError, "failed to list dead-letter files", err)
+		return
+	}
+
+	responder.New(w, files)
+}
+
+// RedriveDeadLetterHandler handles POST /v1/admin/deadletter/redrive requests
+// Writes dead-lettered events back to ClickHouse; ?file= limits it to one file
+func RedriveDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if Batcher.DeadLetter() == nil {
+		responder.Error(w, http.StatusNotFound, "dead-letter sink is not configured")
+		return
+	}
+
+	result, err := Batcher.Redrive(r.Context(), r.URL.Query().Get("file"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidDeadLetterName):
+			responder.Error(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrDeadLetterNotFound):
+			responder.Error(w, http.StatusNotFound, err.Error())
+		default:
+			responder.ErrorWithCause(w, http.StatusInternalServerError, "failed to redrive dead-letter files", err)
+		}
+		return
+	}
+
+	responder.New(w, result)
+}
@@ -19,6 +19,7 @@ const maxRequestBodySize = 1 << 20
 // validAggregations defines allowed aggregation types
 var validAggregations = map[structs.AggregationType]bool{
 	structs.AggCount:       true,
+	structs.AggCountStored: true,
 	structs.AggSum:         true,
 	structs.AggAvg:         true,
 	structs.AggMin:         true,
@@ -293,6 +294,7 @@ func TimeSeriesQueryHandler(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 
 	query := structs.TimeSeriesQuery{
+		Source:      q.Get("source"),
 		Aggregation: structs.AggregationType(q.Get("aggregation")),
 		Field:       q.Get("field"),
 		Interval:    structs.IntervalType(q.Get("interval")),
@@ -348,6 +350,7 @@ var analyticsReservedParams = map[string]bool{
 	"order":       true,
 	"interval":    true,
 	"fill_zeros":  true,
+	"source":      true,
 }
 
 // parseTimeRange parses from/to time values
@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ESFieldMapping maps _bulk document fields onto event columns
+var ESFieldMapping = services.DefaultESFieldMapping()
+
+// ESVersion is the Elasticsearch version reported to clients
+var ESVersion = "8.17.0"
+
+// ElasticsearchInfoHandler handles GET / requests
+// Beats and Logstash check the cluster version before sending bulk requests
+func ElasticsearchInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":         "monitor-core",
+		"cluster_name": "monitor-core",
+		"version": map[string]interface{}{
+			"number":                              ESVersion,
+			"build_flavor":                        "default",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// ElasticsearchBulkHandler handles POST /_bulk and POST /{index}/_bulk requests
+// Accepts Elasticsearch bulk index/create actions and returns a per-item response
+func ElasticsearchBulkHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	if Queue.SaturatedFor(services.TenantFromContext(r.Context())) {
+		Queue.Reject()
+		setRetryAfter(w)
+		writeESError(w, http.StatusTooManyRequests, "es_rejected_execution_exception", "event queue is saturated, retry later")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+
+	bodyReader, err := getBodyReader(r)
+	if err != nil {
+		log.Printf("failed to get body reader: %v", err)
+		writeESError(w, http.StatusBadRequest, "parse_exception", "failed to read request body")
+		return
+	}
+	defer bodyReader.Close()
+
+	actions, err := services.ParseESBulk(bodyReader, mux.Vars(r)["index"])
+	if err != nil {
+		log.Printf("failed to parse bulk request: %v", err)
+		writeESError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+	if len(actions) == 0 {
+		writeESError(w, http.StatusBadRequest, "action_request_validation_exception", "Validation Failed: 1: no requests added;")
+		return
+	}
+
+	stamp := newRelayStamp(r)
+	resp := structs.ESBulkResponse{Items: make([]structs.ESBulkResult, 0, len(actions))}
+	for i, action := range actions {
+		item := &structs.ESBulkItem{Index: action.Index, ID: action.ID}
+		if item.ID == "" {
+			item.ID = uuid.NewString()
+		}
+		resp.Items = append(resp.Items, structs.ESBulkResult{action.Action: item})
+
+		if action.Action == "update" || action.Action == "delete" {
+			setESItemError(item, http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf("%s actions are not supported", action.Action))
+			resp.Errors = true
+			continue
+		}
+
+		err := action.Err
+		var event *structs.Event
+		if err == nil {
+			event, err = ESFieldMapping.ToEvent(action.Doc, action.Index)
+		}
+		if err == nil {
+			// The document _id identifies the event, so resent documents
+			// are deduplicated
+			event.EventID = item.ID
+			err = stamp.apply(event, i+1)
+		}
+		if err != nil {
+			setESItemError(item, http.StatusBadRequest, "document_parsing_exception", err.Error())
+			resp.Errors = true
+			continue
+		}
+
+		// 429 items are retried individually by Elasticsearch clients
+		if !Queue.Enqueue(event) {
+			setESItemError(item, http.StatusTooManyRequests, "es_rejected_execution_exception", "event queue is full")
+			resp.Errors = true
+			continue
+		}
+
+		item.Status = http.StatusCreated
+		item.Result = "created"
+		item.Version = 1
+		item.Shards = &structs.ESShards{Total: 1, Successful: 1}
+	}
+
+	if err := Queue.Sync(); err != nil {
+		log.Printf("failed to sync wal: %v", err)
+		writeESError(w, http.StatusInternalServerError, "exception", "failed to persist events")
+		return
+	}
+
+	resp.Took = time.Since(start).Milliseconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func setESItemError(item *structs.ESBulkItem, status int, errType, reason string) {
+	item.Status = status
+	item.Error = &structs.ESError{Type: errType, Reason: reason}
+}
+
+func writeESError(w http.ResponseWriter, status int, errType, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(structs.ESErrorResponse{
+		Error:  structs.ESError{Type: errType, Reason: reason},
+		Status: status,
+	})
+}
@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MaxDecodedBodySize caps the decompressed size of a compressed request body
+const MaxDecodedBodySize = 64 * 1024 * 1024
+
+// errUnsupportedEncoding is returned for a Content-Encoding we cannot decode
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// errDecodedBodyTooLarge is returned when a compressed body expands past
+// MaxDecodedBodySize
+var errDecodedBodyTooLarge = fmt.Errorf("decompressed body exceeds %d bytes", MaxDecodedBodySize)
+
+// snappyStreamHeader starts every body in the snappy framing format; bodies
+// without it are treated as a single snappy block
+var snappyStreamHeader = []byte("\xff\x06\x00\x00sNaPpY")
+
+// getBodyReader returns a reader over the request body with its
+// Content-Encoding (gzip, zstd, deflate, br or snappy) removed
+func getBodyReader(r *http.Request) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var reader io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		return r.Body, nil
+
+	case "gzip", "x-gzip":
+		gzReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		reader = gzReader
+
+	case "zstd":
+		decoder, err := zstd.NewReader(r.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(MaxDecodedBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		reader = decoder.IOReadCloser()
+
+	case "deflate":
+		// HTTP deflate is zlib-wrapped, but some clients send raw deflate
+		br := bufio.NewReader(r.Body)
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zlibReader, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create zlib reader: %w", err)
+			}
+			reader = zlibReader
+		} else {
+			reader = flate.NewReader(br)
+		}
+
+	case "br":
+		reader = io.NopCloser(brotli.NewReader(r.Body))
+
+	case "snappy":
+		br := bufio.NewReader(r.Body)
+		header, _ := br.Peek(len(snappyStreamHeader))
+		if bytes.Equal(header, snappyStreamHeader) {
+			reader = io.NopCloser(snappy.NewReader(br))
+			break
+		}
+		decoded, err := decodeSnappyBlock(br)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(decoded)), nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+
+	return &decodedBodyReader{ReadCloser: reader, remaining: MaxDecodedBodySize}, nil
+}
+
+// decodeSnappyBlock reads and decompresses a snappy block-encoded body
+func decodeSnappyBlock(r io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+	if size > MaxDecodedBodySize {
+		return nil, errDecodedBodyTooLarge
+	}
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+	return decoded, nil
+}
+
+// decodedBodyReader fails once a decompressed body passes its size limit, so
+// a small compressed request cannot expand without bound
+type decodedBodyReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *decodedBodyReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// Only fail if there is actually more data
+		var b [1]byte
+		if n, _ := r.ReadCloser.Read(b[:]); n > 0 {
+			return 0, errDecodedBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// writeBodyReaderError responds to a request whose body could not be decoded
+func writeBodyReaderError(w http.ResponseWriter, err error) {
+	log.Printf("failed to get body reader: %v", err)
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		http.Error(w, "Unsupported content encoding: use gzip, zstd, deflate, br or snappy", http.StatusUnsupportedMediaType)
+	case errors.Is(err, errDecodedBodyTooLarge):
+		http.Error(w, "Decompressed body is too large", http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	}
+}
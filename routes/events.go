@@ -2,14 +2,18 @@ package routes
 
 import (
 	"bufio"
-	"compress/gzip"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/aidenappl/monitor-core/middleware"
 	"github.com/aidenappl/monitor-core/services"
 	"github.com/aidenappl/monitor-core/structs"
 )
@@ -20,68 +24,364 @@ const MaxRequestBodySize = 10 * 1024 * 1024
 // Queue is the global event queue (set from main.go)
 var Queue *services.Queue
 
+// RetryAfter is sent to clients when the queue is saturated (set from main.go)
+var RetryAfter = 5 * time.Second
+
+// DefaultTimestamp gives events without a timestamp the time they were
+// received instead of rejecting them (set from main.go)
+var DefaultTimestamp bool
+
+// Enrichment adds fields derived from the request, such as GeoIP and
+// user-agent details, to ingested events (set from main.go)
+var Enrichment *services.EnrichmentPipeline
+
+// MaxReportedErrors caps the number of rejected lines listed in an ingest response
+const MaxReportedErrors = 100
+
+// ingestMode controls how invalid lines in an ingest request are handled
+type ingestMode string
+
+const (
+	// ingestModePartial enqueues every valid line and reports the invalid ones
+	ingestModePartial ingestMode = "partial"
+	// ingestModeAtomic validates the whole body and enqueues nothing if any line is invalid
+	ingestModeAtomic ingestMode = "atomic"
+)
+
+// lineError describes why a single line of an ingest request was rejected
+type lineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ingestResult reports what happened to the events in one ingest request
+type ingestResult struct {
+	Accepted int         `json:"accepted"`
+	Dropped  int         `json:"dropped"`
+	Rejected int         `json:"rejected"`
+	Errors   []lineError `json:"errors"`
+	Error    string      `json:"error,omitempty"`
+}
+
+func (res *ingestResult) reject(lineNum int, err error) {
+	res.Rejected++
+	if len(res.Errors) < MaxReportedErrors {
+		res.Errors = append(res.Errors, lineError{Line: lineNum, Error: err.Error()})
+	}
+}
+
+func (res *ingestResult) enqueue(event *structs.Event) {
+	if Queue.Enqueue(event) {
+		res.Accepted++
+	} else {
+		res.Dropped++
+	}
+}
+
+// enqueueAll enqueues events all or nothing, so they are either all accepted
+// or all dropped
+func (res *ingestResult) enqueueAll(events []*structs.Event) {
+	if Queue.EnqueueAll(events) {
+		res.Accepted += len(events)
+	} else {
+		res.Dropped += len(events)
+	}
+}
+
+// summary describes rejected and dropped events in one line for protocols
+// that only carry an error message; item names what the lines are
+func (res *ingestResult) summary(item string) string {
+	switch {
+	case len(res.Errors) > 0:
+		msg := fmt.Sprintf("%s %d: %s", item, res.Errors[0].Line, res.Errors[0].Error)
+		if res.Rejected > 1 {
+			msg += fmt.Sprintf(" (and %d more)", res.Rejected-1)
+		}
+		if res.Dropped > 0 {
+			msg += fmt.Sprintf("; %d dropped because the queue is full", res.Dropped)
+		}
+		return msg
+	case res.Dropped > 0:
+		return fmt.Sprintf("%d dropped because the queue is full", res.Dropped)
+	default:
+		return ""
+	}
+}
+
 // HealthHandler returns queue stats
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	enqueued, dropped, pending := Queue.Stats()
+	metricsEnqueued, metricsRejected, metricsPending := MetricBatcher.Stats()
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":   "ok",
-		"enqueued": enqueued,
-		"dropped":  dropped,
-		"pending":  pending,
-	})
+	health := map[string]interface{}{
+		"status":             "ok",
+		"enqueued":           enqueued,
+		"dropped":            dropped,
+		"pending":            pending,
+		"rejected_requests":  Queue.Rejected(),
+		"dropped_by_service": Queue.DroppedByService(),
+		"metrics": map[string]interface{}{
+			"enqueued": metricsEnqueued,
+			"rejected": metricsRejected,
+			"pending":  metricsPending,
+		},
+	}
+	if sampler := Queue.Sampler(); sampler != nil {
+		health["sampled_out"] = Queue.SampledOut()
+		health["sampling_rules"] = sampler.Stats()
+	}
+	if redactor := Queue.Redactor(); redactor != nil {
+		health["redaction_rules"] = redactor.Stats()
+	}
+	if dedup := Queue.DedupWindow(); dedup != nil {
+		health["duplicates"] = Queue.Duplicates()
+		health["dedup_window"] = dedup.Len()
+	}
+	if Queue.Tenants() != nil {
+		health["tenants"] = Queue.TenantStats()
+	}
+	if Schemas != nil {
+		registered, warned, rejected := Schemas.Stats()
+		health["schemas"] = map[string]interface{}{
+			"registered": registered,
+			"warned":     warned,
+			"rejected":   rejected,
+		}
+	}
+	if Idempotency != nil {
+		keys, replayed := Idempotency.Stats()
+		health["idempotency"] = map[string]interface{}{
+			"keys":     keys,
+			"replayed": replayed,
+		}
+	}
+	json.NewEncoder(w).Encode(health)
 }
 
-// IngestEventsHandler processes incoming NDJSON events
+// IngestEventsHandler processes incoming events. The body may be NDJSON, a
+// JSON array or object, msgpack or protobuf (see ingestFormats), compressed
+// with any encoding getBodyReader supports.
+// ?mode=partial (default) accepts valid lines and reports invalid ones;
+// ?mode=atomic rejects the whole request if any line is invalid.
+// A request sent again with the same Idempotency-Key header gets the first
+// response back without its events being queued twice.
 func IngestEventsHandler(w http.ResponseWriter, r *http.Request) {
+	idempotencyScope, ok := beginIdempotent(w, r)
+	if !ok {
+		return
+	}
+	defer releaseIdempotent(idempotencyScope)
+
+	// Turn the request away before reading it if the queue is backed up
+	if Queue.SaturatedFor(services.TenantFromContext(r.Context())) {
+		Queue.Reject()
+		setRetryAfter(w)
+		http.Error(w, "Event queue is saturated, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format, ok := ingestFormatFor(mediaType)
+	if !ok {
+		http.Error(w, "Unsupported content type: use application/x-ndjson, application/json, application/msgpack or application/x-protobuf", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	mode := ingestMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = ingestModePartial
+	} else if mode != ingestModePartial && mode != ingestModeAtomic {
+		http.Error(w, "Invalid mode: must be partial or atomic", http.StatusBadRequest)
+		return
+	}
+
 	// Limit request body size
 	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
 
 	bodyReader, err := getBodyReader(r)
 	if err != nil {
-		log.Printf("failed to get body reader: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyReaderError(w, err)
 		return
 	}
 	defer bodyReader.Close()
 
-	count, err := parseAndEnqueue(bodyReader)
+	stamp := newIngestStamp(r).withTraceparent(r)
+	stamp.idempotencyScope = idempotencyScope
+
+	var result ingestResult
+	if format == formatNDJSON {
+		result, err = parseAndEnqueue(bodyReader, mode, stamp)
+	} else {
+		result, err = decodeAndEnqueue(bodyReader, format, mode, stamp)
+	}
 	if err != nil {
 		log.Printf("failed to parse events: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid event: %v", err), http.StatusBadRequest)
+		result.Error = err.Error()
+	}
+
+	// Make sure accepted events are on disk before acknowledging them
+	if err := Queue.Sync(); err != nil {
+		log.Printf("failed to sync wal: %v", err)
+		http.Error(w, "Failed to persist events", http.StatusInternalServerError)
 		return
 	}
 
+	status := http.StatusOK
+	switch {
+	case result.Accepted == 0 && result.Dropped == 0 && (result.Error != "" || result.Rejected > 0):
+		// The body was unreadable or nothing in it was valid. Once events
+		// have been accepted the report is a 200, so retries only resend the
+		// events it does not count as accepted.
+		status = http.StatusBadRequest
+	case result.Dropped > 0 && result.Accepted == 0:
+		// Nothing made it into the queue: tell the client to back off
+		setRetryAfter(w)
+		status = http.StatusServiceUnavailable
+	}
+
+	body, _ := json.Marshal(result)
+	body = append(body, '\n')
+	completeIdempotent(idempotencyScope, status, body)
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"accepted": count,
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// enqueueEvents validates events decoded from a non-NDJSON payload and
+// enqueues the valid ones all or nothing, so a sender that retries a payload
+// after a full queue never sends an event twice; "line" numbers in the
+// result are 1-based record positions
+func enqueueEvents(events []*structs.Event, stamp *ingestStamp) ingestResult {
+	result := ingestResult{Errors: []lineError{}}
+	valid := make([]*structs.Event, 0, len(events))
+	for i, event := range events {
+		if err := stamp.apply(event, i+1); err != nil {
+			result.reject(i+1, err)
+			continue
+		}
+		valid = append(valid, event)
+	}
+	result.enqueueAll(valid)
+	return result
+}
+
+func setRetryAfter(w http.ResponseWriter) {
+	seconds := int(RetryAfter.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// ingestStamp is what the server adds to every event of one request,
+// WebSocket frame or gRPC message
+type ingestStamp struct {
+	received time.Time
+	fields   map[string]interface{}
+
+	// idempotencyScope is the request's scoped Idempotency-Key, if any
+	idempotencyScope string
+
+	// traceID and spanID come from the request's traceparent header
+	traceID string
+	spanID  string
+
+	// tenant is the tenant of the API key r was sent with, and key the key
+	tenant string
+	key    *structs.APIKey
+}
+
+// newIngestStamp captures the receive time, tenant and enrichment fields for
+// events sent in r
+func newIngestStamp(r *http.Request) *ingestStamp {
+	stamp := newRelayStamp(r)
+	stamp.fields = Enrichment.Fields(&services.RequestInfo{
+		ClientIP:  middleware.GetClientIP(r),
+		UserAgent: r.UserAgent(),
 	})
+	return stamp
 }
 
-func getBodyReader(r *http.Request) (io.ReadCloser, error) {
-	contentEncoding := r.Header.Get("Content-Encoding")
-	if strings.Contains(strings.ToLower(contentEncoding), "gzip") {
-		gzReader, err := gzip.NewReader(r.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+// newRelayStamp is newIngestStamp for events relayed by an agent, whose
+// request says nothing about where the events came from, so they are not
+// enriched
+func newRelayStamp(r *http.Request) *ingestStamp {
+	return &ingestStamp{
+		received: time.Now().UTC(),
+		tenant:   services.TenantFromContext(r.Context()),
+		key:      services.APIKeyFromContext(r.Context()),
+	}
+}
+
+// withTraceparent reads the W3C traceparent header of r, whose trace and span
+// are given to events that carry no trace ID of their own. Malformed headers
+// are ignored, as the W3C spec requires.
+func (s *ingestStamp) withTraceparent(r *http.Request) *ingestStamp {
+	if traceID, spanID, ok := structs.ParseTraceparent(r.Header.Get("traceparent")); ok {
+		s.traceID, s.spanID = traceID, spanID
+	}
+	return s
+}
+
+// apply records when an event arrived and its tenant, overriding any
+// received_at or tenant the client sent, fills in a missing timestamp if
+// DefaultTimestamp is set and a missing trace from the request's traceparent
+// header. It then validates the event, that the API key may send it and its
+// data schema, returning why the event must be rejected, and adds the
+// enrichment fields to valid events. n is the event's 1-based position in
+// the request, from which events of an idempotent request without an ID get
+// a stable one.
+func (s *ingestStamp) apply(event *structs.Event, n int) error {
+	if event.EventID == "" && s.idempotencyScope != "" {
+		event.EventID = idempotentEventID(s.idempotencyScope, n)
+	}
+	event.ReceivedAt = s.received
+	event.Tenant = s.tenant
+	if DefaultTimestamp && event.Timestamp.IsZero() {
+		event.Timestamp = s.received
+	}
+	if event.TraceID == "" && s.traceID != "" {
+		event.TraceID = s.traceID
+		if event.SpanID == "" {
+			event.SpanID = s.spanID
 		}
-		return gzReader, nil
 	}
-	return r.Body, nil
+
+	return services.PrepareEvent(event, s.key, Schemas, s.fields)
 }
 
-func parseAndEnqueue(reader io.Reader) (int, error) {
-	scanner := bufio.NewScanner(reader)
-	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+// maxLineSize bounds one NDJSON line; longer lines are rejected
+const maxLineSize = 1024 * 1024
+
+var errLineTooLong = errors.New("line exceeds 1 MB")
 
-	count := 0
+// parseAndEnqueue reads NDJSON events from reader. In partial mode each valid
+// line is enqueued as it is read; in atomic mode events are held back until the
+// whole body has validated. The error is only set if the body could not be read.
+func parseAndEnqueue(reader io.Reader, mode ingestMode, stamp *ingestStamp) (ingestResult, error) {
+	lines := bufio.NewReaderSize(reader, 64*1024)
+
+	result := ingestResult{Errors: []lineError{}}
+	var pending []*structs.Event
+	var line []byte
 	lineNum := 0
 
-	for scanner.Scan() {
+	for {
+		var err error
+		line, err = readLine(lines, line)
+		if err == io.EOF {
+			break
+		}
 		lineNum++
-		line := scanner.Bytes()
+		if errors.Is(err, errLineTooLong) {
+			result.reject(lineNum, err)
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("line %d: error reading body: %w", lineNum, err)
+		}
 
 		if len(line) == 0 {
 			continue
@@ -89,20 +389,57 @@ func parseAndEnqueue(reader io.Reader) (int, error) {
 
 		var event structs.Event
 		if err := json.Unmarshal(line, &event); err != nil {
-			return count, fmt.Errorf("line %d: invalid JSON: %w", lineNum, err)
+			result.reject(lineNum, fmt.Errorf("invalid JSON: %w", err))
+			continue
 		}
 
-		if err := event.Validate(); err != nil {
-			return count, fmt.Errorf("line %d: %w", lineNum, err)
+		if err := stamp.apply(&event, lineNum); err != nil {
+			result.reject(lineNum, err)
+			continue
 		}
 
-		Queue.Enqueue(&event)
-		count++
+		if mode == ingestModeAtomic {
+			pending = append(pending, &event)
+			continue
+		}
+		result.enqueue(&event)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return count, fmt.Errorf("error reading body: %w", err)
+	if mode == ingestModeAtomic && result.Rejected == 0 {
+		result.enqueueAll(pending)
 	}
 
-	return count, nil
+	return result, nil
+}
+
+// readLine returns the next line of r without its line ending, reusing buf.
+// A line longer than maxLineSize is skipped and reported as errLineTooLong,
+// so the lines after it can still be read.
+func readLine(r *bufio.Reader, buf []byte) ([]byte, error) {
+	line := buf[:0]
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) > maxLineSize {
+			tooLong = true
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && (len(line) > 0 || tooLong) {
+			// The last line has no line ending
+			err = nil
+		}
+		if err != nil {
+			return line, err
+		}
+		if tooLong {
+			return line[:0], errLineTooLong
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		return bytes.TrimSuffix(line, []byte("\r")), nil
+	}
 }
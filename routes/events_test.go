@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenappl/monitor-core/services"
+)
+
+const validLine = `{"timestamp":"2024-01-01T00:00:00Z","service":"api","name":"request"}`
+
+func TestParseAndEnqueue(t *testing.T) {
+	long := `{"timestamp":"2024-01-01T00:00:00Z","service":"api","name":"` + strings.Repeat("x", maxLineSize) + `"}`
+
+	tests := []struct {
+		name         string
+		body         string
+		mode         ingestMode
+		wantAccepted int
+		wantRejected []int
+	}{
+		{"valid lines", validLine + "\n" + validLine + "\n", ingestModePartial, 2, nil},
+		{"no trailing newline", validLine + "\n" + validLine, ingestModePartial, 2, nil},
+		{"crlf and blank lines", validLine + "\r\n\r\n" + validLine + "\r\n", ingestModePartial, 2, nil},
+		{"invalid line", validLine + "\n{\"service\":\"api\"}\n" + validLine, ingestModePartial, 2, []int{2}},
+		{"oversized line", validLine + "\n" + long + "\n" + validLine + "\n", ingestModePartial, 2, []int{2}},
+		{"oversized last line", validLine + "\n" + long, ingestModePartial, 1, []int{2}},
+		{"atomic oversized line", validLine + "\n" + long + "\n" + validLine, ingestModeAtomic, 0, []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Queue = services.NewQueue(10)
+			stamp := &ingestStamp{received: time.Now()}
+
+			result, err := parseAndEnqueue(strings.NewReader(tt.body), tt.mode, stamp)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Accepted != tt.wantAccepted {
+				t.Errorf("accepted = %d, want %d", result.Accepted, tt.wantAccepted)
+			}
+			if result.Rejected != len(tt.wantRejected) {
+				t.Fatalf("rejected = %d, want %d", result.Rejected, len(tt.wantRejected))
+			}
+			for i, line := range tt.wantRejected {
+				if result.Errors[i].Line != line {
+					t.Errorf("rejected line = %d, want %d", result.Errors[i].Line, line)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAndEnqueueQueueFull(t *testing.T) {
+	body := strings.Repeat(validLine+"\n", 3)
+
+	tests := []struct {
+		name         string
+		mode         ingestMode
+		wantAccepted int
+		wantDropped  int
+	}{
+		{"partial", ingestModePartial, 2, 1},
+		{"atomic", ingestModeAtomic, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Queue = services.NewQueue(2)
+
+			result, err := parseAndEnqueue(strings.NewReader(body), tt.mode, &ingestStamp{received: time.Now()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Accepted != tt.wantAccepted || result.Dropped != tt.wantDropped {
+				t.Fatalf("accepted %d and dropped %d, want %d and %d", result.Accepted, result.Dropped, tt.wantAccepted, tt.wantDropped)
+			}
+			if _, _, pending := Queue.Stats(); pending != tt.wantAccepted {
+				t.Fatalf("pending = %d, want %d", pending, tt.wantAccepted)
+			}
+		})
+	}
+}
+
+// failingReader returns body and then err
+type failingReader struct {
+	body string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.body == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.body)
+	r.body = r.body[n:]
+	return n, nil
+}
+
+func TestParseAndEnqueueReadError(t *testing.T) {
+	Queue = services.NewQueue(10)
+	errBroken := errors.New("connection reset")
+
+	result, err := parseAndEnqueue(&failingReader{body: validLine + "\n" + validLine + "\n", err: errBroken}, ingestModePartial, &ingestStamp{received: time.Now()})
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("err = %v, want %v", err, errBroken)
+	}
+	if result.Accepted != 2 {
+		t.Fatalf("accepted = %d, want 2", result.Accepted)
+	}
+}
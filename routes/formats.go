@@ -0,0 +1,186 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// ingestFormat is a body format accepted by POST /v1/events
+type ingestFormat string
+
+const (
+	formatNDJSON   ingestFormat = "ndjson"
+	formatJSON     ingestFormat = "json"
+	formatMsgpack  ingestFormat = "msgpack"
+	formatProtobuf ingestFormat = "protobuf"
+)
+
+// ingestFormats maps Content-Type media types onto body formats. Requests
+// without a Content-Type are read as NDJSON, as they always have been.
+var ingestFormats = map[string]ingestFormat{
+	"":                        formatNDJSON,
+	"application/x-ndjson":    formatNDJSON,
+	"application/ndjson":      formatNDJSON,
+	"application/jsonl":       formatNDJSON,
+	"application/x-jsonlines": formatNDJSON,
+	"text/plain":              formatNDJSON,
+	contentTypeJSON:           formatJSON,
+	"application/msgpack":     formatMsgpack,
+	"application/x-msgpack":   formatMsgpack,
+	"application/vnd.msgpack": formatMsgpack,
+	contentTypeProtobuf:       formatProtobuf,
+	"application/protobuf":    formatProtobuf,
+}
+
+// nonEventTypes are media type prefixes whose bodies can never be events
+var nonEventTypes = []string{"image/", "audio/", "video/", "font/", "multipart/", "application/x-www-form-urlencoded"}
+
+// ingestFormatFor returns the body format for a media type. Types that are
+// not listed in ingestFormats are read as NDJSON, as every type was before
+// other formats were supported, unless they are clearly not events.
+func ingestFormatFor(mediaType string) (ingestFormat, bool) {
+	if format, ok := ingestFormats[mediaType]; ok {
+		return format, true
+	}
+	for _, prefix := range nonEventTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return "", false
+		}
+	}
+	return formatNDJSON, true
+}
+
+// eventRecord is one record of a decoded body; err is set if the record
+// could not be mapped onto an event
+type eventRecord struct {
+	event *structs.Event
+	err   error
+}
+
+// decodeAndEnqueue reads a JSON, msgpack or protobuf body and enqueues its
+// events like parseAndEnqueue does NDJSON lines, numbering records from 1 in
+// place of lines. If the body is malformed, records decoded before the error
+// are still enqueued in partial mode.
+func decodeAndEnqueue(reader io.Reader, format ingestFormat, mode ingestMode, stamp *ingestStamp) (ingestResult, error) {
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return ingestResult{Errors: []lineError{}}, fmt.Errorf("error reading body: %w", err)
+	}
+
+	var records []eventRecord
+	switch format {
+	case formatJSON:
+		// application/json bodies may be an array of events, a single event
+		// (pretty-printed or not), or NDJSON from older clients
+		trimmed := bytes.TrimSpace(body)
+		switch {
+		case len(trimmed) == 0:
+		case trimmed[0] == '[':
+			records, err = decodeJSONArray(trimmed)
+		case json.Valid(trimmed):
+			records = []eventRecord{decodeJSONEvent(trimmed)}
+		default:
+			return parseAndEnqueue(bytes.NewReader(body), mode, stamp)
+		}
+	case formatMsgpack:
+		records, err = decodeMsgpackEvents(body)
+	case formatProtobuf:
+		var events []*structs.Event
+		if events, err = services.DecodeIngestRequest(body); err != nil {
+			err = fmt.Errorf("invalid IngestRequest: %w", err)
+		}
+		for _, event := range events {
+			records = append(records, eventRecord{event: event})
+		}
+	}
+
+	if err != nil && mode == ingestModeAtomic {
+		return ingestResult{Errors: []lineError{}}, err
+	}
+	return enqueueRecords(records, mode, stamp), err
+}
+
+// enqueueRecords validates and enqueues decoded records, holding them all
+// back in atomic mode unless every one is valid
+func enqueueRecords(records []eventRecord, mode ingestMode, stamp *ingestStamp) ingestResult {
+	result := ingestResult{Errors: []lineError{}}
+	var pending []*structs.Event
+
+	for i, record := range records {
+		err := record.err
+		if err == nil {
+			err = stamp.apply(record.event, i+1)
+		}
+		if err != nil {
+			result.reject(i+1, err)
+			continue
+		}
+
+		if mode == ingestModeAtomic {
+			pending = append(pending, record.event)
+			continue
+		}
+		result.enqueue(record.event)
+	}
+
+	if mode == ingestModeAtomic && result.Rejected == 0 {
+		result.enqueueAll(pending)
+	}
+
+	return result
+}
+
+func decodeJSONArray(body []byte) ([]eventRecord, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %w", err)
+	}
+	records := make([]eventRecord, len(items))
+	for i, item := range items {
+		records[i] = decodeJSONEvent(item)
+	}
+	return records, nil
+}
+
+func decodeJSONEvent(b []byte) eventRecord {
+	var event structs.Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return eventRecord{err: fmt.Errorf("invalid JSON: %w", err)}
+	}
+	return eventRecord{event: &event}
+}
+
+// decodeMsgpackEvents reads a stream of msgpack maps, or arrays of maps,
+// with the same keys as JSON events
+func decodeMsgpackEvents(body []byte) ([]eventRecord, error) {
+	var records []eventRecord
+	add := func(v interface{}) {
+		event, err := services.MsgpackToEvent(v)
+		records = append(records, eventRecord{event: event, err: err})
+	}
+
+	decoder := services.NewMsgpackDecoder(bytes.NewReader(body), MaxDecodedBodySize)
+	for {
+		v, err := decoder.Decode()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("record %d: invalid msgpack: %w", len(records)+1, err)
+		}
+
+		if items, ok := v.([]interface{}); ok {
+			for _, item := range items {
+				add(item)
+			}
+		} else {
+			add(v)
+		}
+	}
+}
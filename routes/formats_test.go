@@ -0,0 +1,30 @@
+package routes
+
+import "testing"
+
+func TestIngestFormatFor(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		want      ingestFormat
+		wantOK    bool
+	}{
+		{"", formatNDJSON, true},
+		{"application/json", formatJSON, true},
+		{"application/vnd.msgpack", formatMsgpack, true},
+		{"application/x-protobuf", formatProtobuf, true},
+		{"application/octet-stream", formatNDJSON, true},
+		{"text/x-log", formatNDJSON, true},
+		{"image/png", "", false},
+		{"multipart/form-data", "", false},
+		{"application/x-www-form-urlencoded", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			got, ok := ingestFormatFor(tt.mediaType)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("got %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
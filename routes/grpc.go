@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aidenappl/monitor-core/middleware"
+	monitorv1 "github.com/aidenappl/monitor-core/proto/monitor/v1"
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip-compressed messages
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcClosing is cancelled when the gRPC server shuts down
+var grpcClosing, closeGRPC = context.WithCancel(context.Background())
+
+// CloseGRPCStreams ends open Ingest streams with UNAVAILABLE once their
+// current request is acked. Call it before the server's GracefulStop, which
+// otherwise waits for clients to hang up.
+func CloseGRPCStreams() {
+	closeGRPC()
+}
+
+// NewGRPCServer returns a gRPC server for the IngestService defined in
+// proto/monitor/v1/ingest.proto
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(MaxRequestBodySize),
+		grpc.ConnectionTimeout(30*time.Second),
+		grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: 60 * time.Second}),
+	)
+	monitorv1.RegisterIngestServiceServer(server, ingestService{})
+	return server
+}
+
+type ingestService struct {
+	monitorv1.UnimplementedIngestServiceServer
+}
+
+// grpcReceived is one message read from an Ingest stream
+type grpcReceived struct {
+	req *monitorv1.IngestRequest
+	err error
+}
+
+// Ingest handles the bidirectional streaming Ingest RPC. Each IngestRequest
+// on the stream is validated and enqueued like a POST /v1/events body, then
+// acked with its accepted, dropped and rejected counts and running totals
+// for the stream.
+func (ingestService) Ingest(stream monitorv1.IngestService_IngestServer) error {
+	// gRPC metadata travels as HTTP/2 headers, so the key is checked the same
+	// way as X-Api-Key on the HTTP API
+	r := grpcRequest(stream.Context())
+	key, ok := middleware.Authenticate(r.Header.Get("X-Api-Key"))
+	if !ok {
+		return status.Error(codes.Unauthenticated, "invalid or missing x-api-key")
+	}
+	if !key.HasScope(structs.ScopeIngest) {
+		return status.Error(codes.PermissionDenied, "api key lacks the ingest scope")
+	}
+
+	// End the stream on shutdown, even while the client is idle
+	ctx, cancel := context.WithCancel(services.WithAPIKey(stream.Context(), key))
+	defer cancel()
+	defer context.AfterFunc(grpcClosing, cancel)()
+	r = r.WithContext(ctx)
+
+	received := make(chan grpcReceived)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case received <- grpcReceived{req: req, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var ack monitorv1.IngestResponse
+	for {
+		var msg grpcReceived
+		select {
+		case msg = <-received:
+		case <-ctx.Done():
+			return grpcStreamEnded(ctx)
+		}
+
+		if msg.err == io.EOF {
+			return nil
+		}
+		if msg.err != nil {
+			return msg.err
+		}
+
+		events, err := services.IngestRequestToEvents(msg.req)
+		if err != nil {
+			log.Printf("failed to decode grpc ingest request: %v", err)
+			return status.Errorf(codes.InvalidArgument, "invalid IngestRequest: %v", err)
+		}
+
+		// Hold the stream while the queue is saturated
+		if Queue.WaitFor(ctx, key.Tenant) != nil {
+			return grpcStreamEnded(ctx)
+		}
+
+		result := enqueueEvents(events, newIngestStamp(r).withTraceparent(r))
+
+		// Events must be durable before they are acked
+		if err := Queue.Sync(); err != nil {
+			log.Printf("failed to sync wal: %v", err)
+			return status.Error(codes.Internal, "failed to persist events")
+		}
+
+		ack.Sequence++
+		ack.Accepted = uint64(result.Accepted)
+		ack.Dropped = uint64(result.Dropped)
+		ack.Rejected = uint64(result.Rejected)
+		ack.Errors = ack.Errors[:0]
+		for _, e := range result.Errors {
+			ack.Errors = append(ack.Errors, &monitorv1.EventError{Index: uint32(e.Line - 1), Error: e.Error})
+		}
+		ack.TotalAccepted += ack.Accepted
+		ack.TotalDropped += ack.Dropped
+		ack.TotalRejected += ack.Rejected
+
+		if err := stream.Send(&ack); err != nil {
+			return err
+		}
+	}
+}
+
+// grpcStreamEnded returns the status of a stream ended by the client going
+// away or by the server shutting down
+func grpcStreamEnded(ctx context.Context) error {
+	if grpcClosing.Err() != nil {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	return status.FromContextError(ctx.Err()).Err()
+}
+
+// grpcRequest returns an HTTP request with a stream's metadata as headers
+// and its peer as the remote address, so events sent on the stream are
+// stamped and enriched like those sent over HTTP
+func grpcRequest(ctx context.Context) *http.Request {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &http.Request{Header: make(http.Header, len(md))}
+	for name, values := range md {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	return r.WithContext(ctx)
+}
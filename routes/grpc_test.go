@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	monitorv1 "github.com/aidenappl/monitor-core/proto/monitor/v1"
+	"github.com/aidenappl/monitor-core/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGRPCIngest(t *testing.T) {
+	Queue = services.NewQueue(10)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewGRPCServer()
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := monitorv1.NewIngestServiceClient(conn).Ingest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := &monitorv1.Event{Timestamp: timestamppb.Now(), Service: "api", Name: "request"}
+	requests := []*monitorv1.IngestRequest{
+		{Events: []*monitorv1.Event{valid, valid}},
+		{Events: []*monitorv1.Event{valid, {Service: "api"}}},
+	}
+	want := []*monitorv1.IngestResponse{
+		{Sequence: 1, Accepted: 2, TotalAccepted: 2},
+		{Sequence: 2, Accepted: 1, Rejected: 1, TotalAccepted: 3, TotalRejected: 1},
+	}
+
+	for i, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack.Sequence != want[i].Sequence || ack.Accepted != want[i].Accepted || ack.Rejected != want[i].Rejected ||
+			ack.TotalAccepted != want[i].TotalAccepted || ack.TotalRejected != want[i].TotalRejected {
+			t.Fatalf("ack %d = %v, want %v", i+1, ack, want[i])
+		}
+		if len(ack.Errors) != int(ack.Rejected) {
+			t.Fatalf("ack %d has %d errors, want %d", i+1, len(ack.Errors), ack.Rejected)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/google/uuid"
+)
+
+// Idempotency records responses to ingest requests sent with an
+// Idempotency-Key header; nil disables the header (set from main.go)
+var Idempotency *services.IdempotencyCache
+
+// MaxIdempotencyKeyLength limits the length of an Idempotency-Key header
+const MaxIdempotencyKeyLength = 255
+
+// idempotencyNamespace derives event IDs from idempotency keys
+var idempotencyNamespace = uuid.MustParse("6f1c9b52-3d0e-4a57-9a8e-2c4b7d1e5f30")
+
+// beginIdempotent claims the request's Idempotency-Key, returning the scoped
+// key to complete once the response is known. If the key has been used
+// before, or the header is invalid, it writes the response itself and
+// returns ok false. Without the header it returns "" and true.
+func beginIdempotent(w http.ResponseWriter, r *http.Request) (scope string, ok bool) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || Idempotency == nil {
+		return "", true
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key must be at most "+strconv.Itoa(MaxIdempotencyKeyLength)+" characters", http.StatusBadRequest)
+		return "", false
+	}
+
+	// Keys are scoped to the API key, so clients cannot see each other's
+	// responses
+	sum := sha256.Sum256([]byte(r.Header.Get("X-Api-Key") + "\x00" + key))
+	scope = hex.EncodeToString(sum[:])
+
+	response, inFlight := Idempotency.Begin(scope)
+	switch {
+	case response != nil:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(response.Status)
+		w.Write(response.Body)
+		return "", false
+	case inFlight:
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return "", false
+	}
+	return scope, true
+}
+
+// completeIdempotent records the response to a request that claimed scope.
+// Responses asking the client to retry later are not recorded, and the key is
+// released for the retry.
+func completeIdempotent(scope string, status int, body []byte) {
+	if scope == "" {
+		return
+	}
+	if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests || status >= 500 {
+		Idempotency.Release(scope)
+		return
+	}
+	Idempotency.Complete(scope, &services.IdempotentResponse{Status: status, Body: body})
+}
+
+// releaseIdempotent frees a claimed key whose request ended without a
+// recorded response
+func releaseIdempotent(scope string) {
+	if scope != "" {
+		Idempotency.Release(scope)
+	}
+}
+
+// idempotentEventID derives the ID of the nth event of a request from its
+// scoped Idempotency-Key, so a retried request produces the same IDs
+func idempotentEventID(scope string, n int) string {
+	return uuid.NewSHA1(idempotencyNamespace, []byte(scope+":"+strconv.Itoa(n))).String()
+}
@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aidenappl/monitor-core/responder"
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/gorilla/mux"
+)
+
+// Keys is the API key registry managed through the admin API (set from
+// main.go)
+var Keys *services.APIKeys
+
+// ListKeysHandler handles GET /v1/admin/keys requests
+// Lists the keys the caller may manage; ?tenant= limits it to one tenant
+func ListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := managedTenant(w, r)
+	if !ok {
+		return
+	}
+
+	if tenant == "" {
+		tenant = r.URL.Query().Get("tenant")
+	}
+	responder.New(w, Keys.List(tenant))
+}
+
+// GetKeyHandler handles GET /v1/admin/keys/{id} requests
+func GetKeyHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := managedTenant(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := Keys.Get(tenant, mux.Vars(r)["id"])
+	if err != nil {
+		responder.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	responder.New(w, key)
+}
+
+// CreateKeyHandler handles POST /v1/admin/keys requests
+// Creates a key and returns its secret, which is not shown again
+func CreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := managedTenant(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+	var req structs.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			responder.Error(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		responder.Error(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if tenant != "" {
+		if req.Tenant != "" && req.Tenant != tenant {
+			responder.Error(w, http.StatusForbidden, "keys may only be created for tenant "+tenant)
+			return
+		}
+		req.Tenant = tenant
+	}
+
+	key, err := Keys.Create(r.Context(), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidKey) {
+			responder.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		responder.ErrorWithCause(w, http.StatusInternalServerError, "failed to create api key", err)
+		return
+	}
+
+	responder.New(w, key)
+}
+
+// RotateKeyHandler handles POST /v1/admin/keys/{id}/rotate requests
+// Gives the key a new secret; the old one stops working at once
+func RotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := managedTenant(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := Keys.Rotate(r.Context(), tenant, mux.Vars(r)["id"])
+	if err != nil {
+		writeKeyError(w, err, "failed to rotate api key")
+		return
+	}
+	responder.New(w, key)
+}
+
+// RevokeKeyHandler handles DELETE /v1/admin/keys/{id} requests
+func RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := managedTenant(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := Keys.Revoke(r.Context(), tenant, mux.Vars(r)["id"])
+	if err != nil {
+		writeKeyError(w, err, "failed to revoke api key")
+		return
+	}
+	responder.New(w, key, "api key revoked")
+}
+
+// managedTenant returns the tenant whose keys the caller may manage, or ""
+// for callers in the default tenant, who may manage the keys of all tenants.
+// Keys restricted to services or envs may not manage keys, as they could
+// create keys without their restrictions. It writes the error response and
+// returns false when keys cannot be managed.
+func managedTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if Keys == nil {
+		responder.Error(w, http.StatusNotFound, "key store is not configured")
+		return "", false
+	}
+	if services.APIKeyFromContext(r.Context()).Restricted() {
+		responder.Error(w, http.StatusForbidden, "api keys restricted to services or envs may not manage keys")
+		return "", false
+	}
+	if tenant := services.TenantFromContext(r.Context()); tenant != structs.DefaultTenant {
+		return tenant, true
+	}
+	return "", true
+}
+
+func writeKeyError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrKeyNotFound):
+		responder.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidKey):
+		responder.Error(w, http.StatusBadRequest, err.Error())
+	default:
+		responder.ErrorWithCause(w, http.StatusInternalServerError, message, err)
+	}
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// LokiPushHandler handles POST /loki/api/v1/push requests
+// Accepts Loki push requests as snappy-compressed protobuf (as sent by
+// Promtail and Alloy) or JSON
+func LokiPushHandler(w http.ResponseWriter, r *http.Request) {
+	if Queue.SaturatedFor(services.TenantFromContext(r.Context())) {
+		Queue.Reject()
+		setRetryAfter(w)
+		http.Error(w, "Event queue is saturated, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+
+	var req *structs.LokiPushRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case contentTypeProtobuf, "":
+		decoded, ok := readSnappyBody(w, r)
+		if !ok {
+			return
+		}
+		var err error
+		req, err = services.DecodeLokiPush(decoded)
+		if err != nil {
+			log.Printf("failed to decode loki push: %v", err)
+			http.Error(w, fmt.Sprintf("Invalid Loki push payload: %v", err), http.StatusBadRequest)
+			return
+		}
+
+	case contentTypeJSON:
+		bodyReader, err := getBodyReader(r)
+		if err != nil {
+			writeBodyReaderError(w, err)
+			return
+		}
+		defer bodyReader.Close()
+
+		req = &structs.LokiPushRequest{}
+		if err := json.NewDecoder(bodyReader).Decode(req); err != nil {
+			log.Printf("failed to decode loki push: %v", err)
+			http.Error(w, fmt.Sprintf("Invalid Loki push payload: %v", err), http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "Unsupported content type: use application/x-protobuf or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	result := enqueueEvents(services.LokiPushToEvents(req), newRelayStamp(r))
+
+	if err := Queue.Sync(); err != nil {
+		log.Printf("failed to sync wal: %v", err)
+		http.Error(w, "Failed to persist events", http.StatusInternalServerError)
+		return
+	}
+
+	// Like Loki, report invalid entries with a 400 (which clients do not
+	// retry) and a full queue with a retryable 5xx. Valid entries are queued
+	// all or nothing, so a retried push never duplicates any of them.
+	switch {
+	case result.Dropped > 0:
+		setRetryAfter(w)
+		http.Error(w, "Event queue is full, retry later", http.StatusServiceUnavailable)
+	case result.Rejected > 0:
+		http.Error(w, result.summary("entry"), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readSnappyBody reads and decompresses a snappy block-encoded body, writing
+// an error response and returning false when it cannot
+func readSnappyBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	decoded, err := decodeSnappyBlock(r.Body)
+	switch {
+	case errors.Is(err, errDecodedBodyTooLarge):
+		http.Error(w, "Decompressed body is too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	case err != nil:
+		log.Printf("failed to read snappy body: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return decoded, true
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aidenappl/monitor-core/services"
+)
+
+func TestLokiPushHandlerQueueFull(t *testing.T) {
+	const body = `{"streams": [{"stream": {"service": "api"}, "values": [["1700000000000000000", "one"], ["1700000000000000001", "two"]]}]}`
+
+	tests := []struct {
+		name        string
+		queueSize   int
+		wantStatus  int
+		wantPending int
+	}{
+		{"all queued", 2, http.StatusNoContent, 2},
+		{"queue too small", 1, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Queue = services.NewQueue(tt.queueSize)
+			r := httptest.NewRequest(http.MethodPost, "/loki/api/v1/push", strings.NewReader(body))
+			r.Header.Set("Content-Type", contentTypeJSON)
+			w := httptest.NewRecorder()
+
+			LokiPushHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if _, _, pending := Queue.Stats(); pending != tt.wantPending {
+				t.Fatalf("pending = %d, want %d", pending, tt.wantPending)
+			}
+		})
+	}
+}
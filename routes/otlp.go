@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// OTLPLogsHandler handles POST /v1/otlp/logs requests
+// Accepts OTLP/HTTP ExportLogsServiceRequest payloads in protobuf or JSON
+func OTLPLogsHandler(w http.ResponseWriter, r *http.Request) {
+	if Queue.SaturatedFor(services.TenantFromContext(r.Context())) {
+		Queue.Reject()
+		setRetryAfter(w)
+		http.Error(w, "Event queue is saturated, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	isProto, body, ok := readOTLPBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req *structs.OTLPLogsRequest
+	var err error
+	if isProto {
+		req, err = services.DecodeOTLPLogs(body)
+	} else {
+		req = &structs.OTLPLogsRequest{}
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil {
+		log.Printf("failed to decode otlp logs: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid OTLP logs payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result := enqueueEvents(services.OTLPLogsToEvents(req), newIngestStamp(r))
+
+	resp := &structs.OTLPExportResponse{}
+	if result.Rejected > 0 {
+		resp.PartialSuccess = &structs.OTLPPartialSuccess{
+			RejectedLogRecords: int64(result.Rejected),
+			ErrorMessage:       result.summary("record"),
+		}
+	}
+
+	writeOTLPResponse(w, isProto, result, resp)
+}
+
+// OTLPTracesHandler handles POST /v1/otlp/traces requests
+// Accepts OTLP/HTTP ExportTraceServiceRequest payloads and stores each span as an event
+func OTLPTracesHandler(w http.ResponseWriter, r *http.Request) {
+	if Queue.SaturatedFor(services.TenantFromContext(r.Context())) {
+		Queue.Reject()
+		setRetryAfter(w)
+		http.Error(w, "Event queue is saturated, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	isProto, body, ok := readOTLPBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req *structs.OTLPTracesRequest
+	var err error
+	if isProto {
+		req, err = services.DecodeOTLPTraces(body)
+	} else {
+		req = &structs.OTLPTracesRequest{}
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil {
+		log.Printf("failed to decode otlp traces: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid OTLP traces payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result := enqueueEvents(services.OTLPTracesToEvents(req), newIngestStamp(r))
+
+	resp := &structs.OTLPExportResponse{}
+	if result.Rejected > 0 {
+		resp.PartialSuccess = &structs.OTLPPartialSuccess{
+			RejectedSpans: int64(result.Rejected),
+			ErrorMessage:  result.summary("span"),
+		}
+	}
+
+	writeOTLPResponse(w, isProto, result, resp)
+}
+
+// readOTLPBody reads and decompresses an OTLP/HTTP body, reporting whether it
+// is protobuf. It writes the error response itself and returns ok=false on failure.
+func readOTLPBody(w http.ResponseWriter, r *http.Request) (isProto bool, body []byte, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case contentTypeProtobuf, "application/protobuf":
+		isProto = true
+	case contentTypeJSON:
+		isProto = false
+	default:
+		http.Error(w, "Unsupported content type: use application/x-protobuf or application/json", http.StatusUnsupportedMediaType)
+		return false, nil, false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+
+	bodyReader, err := getBodyReader(r)
+	if err != nil {
+		writeBodyReaderError(w, err)
+		return false, nil, false
+	}
+	defer bodyReader.Close()
+
+	body, err = io.ReadAll(bodyReader)
+	if err != nil {
+		log.Printf("failed to read otlp body: %v", err)
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return false, nil, false
+	}
+
+	return isProto, body, true
+}
+
+// writeOTLPResponse syncs the queue and writes an export response in the
+// request's encoding
+func writeOTLPResponse(w http.ResponseWriter, isProto bool, result ingestResult, resp *structs.OTLPExportResponse) {
+	if err := Queue.Sync(); err != nil {
+		log.Printf("failed to sync wal: %v", err)
+		http.Error(w, "Failed to persist events", http.StatusInternalServerError)
+		return
+	}
+
+	// The valid records are queued all or nothing, so when any were dropped
+	// none were queued: tell the exporter to back off and resend the request.
+	// Partial success is only for records that would be rejected again.
+	if result.Dropped > 0 {
+		setRetryAfter(w)
+		http.Error(w, "Event queue is full, retry later", http.StatusServiceUnavailable)
+		return
+	}
+
+	if isProto {
+		w.Header().Set("Content-Type", contentTypeProtobuf)
+		w.WriteHeader(http.StatusOK)
+		w.Write(services.EncodeOTLPExportResponse(resp))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aidenappl/monitor-core/services"
+)
+
+func TestOTLPLogsHandlerQueueFull(t *testing.T) {
+	const body = `{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"body": {"stringValue": "one"}}, {"body": {"stringValue": "two"}}]}]}]}`
+
+	tests := []struct {
+		name        string
+		queueSize   int
+		wantStatus  int
+		wantPending int
+	}{
+		{"all queued", 2, http.StatusOK, 2},
+		{"queue too small", 1, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Queue = services.NewQueue(tt.queueSize)
+			r := httptest.NewRequest(http.MethodPost, "/v1/otlp/logs", strings.NewReader(body))
+			r.Header.Set("Content-Type", contentTypeJSON)
+			w := httptest.NewRecorder()
+
+			OTLPLogsHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if _, _, pending := Queue.Stats(); pending != tt.wantPending {
+				t.Fatalf("pending = %d, want %d", pending, tt.wantPending)
+			}
+			if tt.wantStatus != http.StatusOK && w.Header().Get("Retry-After") == "" {
+				t.Fatal("missing Retry-After")
+			}
+			if tt.wantStatus == http.StatusOK && strings.Contains(w.Body.String(), "partialSuccess") {
+				t.Fatalf("unexpected partial success: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestOTLPTracesHandlerQueueFull(t *testing.T) {
+	Queue = services.NewQueue(1)
+	body := `{"resourceSpans": [{"scopeSpans": [{"spans": [{"name": "one"}, {"name": "two"}]}]}]}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/otlp/traces", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentTypeJSON)
+	w := httptest.NewRecorder()
+
+	OTLPTracesHandler(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusServiceUnavailable, w.Body)
+	}
+	if _, _, pending := Queue.Stats(); pending != 0 {
+		t.Fatalf("pending = %d, want 0", pending)
+	}
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// promWriteV1Proto is the only remote_write message accepted; 2.0 senders
+// fall back to it when their request is refused with 415
+const promWriteV1Proto = "prometheus.WriteRequest"
+
+// MetricBatcher is the global metric batcher (set from main.go)
+var MetricBatcher *services.MetricBatcher
+
+// PrometheusWriteHandler handles POST /api/v1/write requests
+// Accepts Prometheus remote_write 1.0 requests (snappy-compressed protobuf)
+// and stores their samples in the metrics table
+func PrometheusWriteHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != contentTypeProtobuf && mediaType != "" {
+		http.Error(w, "Unsupported content type: use application/x-protobuf", http.StatusUnsupportedMediaType)
+		return
+	}
+	if proto := params["proto"]; proto != "" && proto != promWriteV1Proto {
+		http.Error(w, fmt.Sprintf("Unsupported remote write message %s: use %s", proto, promWriteV1Proto), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+
+	body, ok := readSnappyBody(w, r)
+	if !ok {
+		return
+	}
+
+	samples, err := services.DecodePromWrite(body)
+	if err != nil {
+		log.Printf("failed to decode remote write: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid remote write payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tenant := services.TenantFromContext(r.Context())
+	valid := make([]*structs.Sample, 0, len(samples))
+	var rejected int
+	var firstErr error
+	for _, sample := range samples {
+		sample.Tenant = tenant
+		if err := sample.Validate(); err != nil {
+			rejected++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, sample)
+	}
+
+	// Prometheus retries 5xx responses, so the batcher refuses the whole
+	// request rather than store part of it, unless it is larger than the queue
+	accepted := MetricBatcher.Enqueue(valid)
+	if accepted == 0 && len(valid) > 0 {
+		setRetryAfter(w)
+		http.Error(w, "Metric queue is full, retry later", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Dropped and invalid samples are reported with a 400, which Prometheus
+	// does not retry
+	if dropped := len(valid) - accepted; dropped > 0 {
+		http.Error(w, fmt.Sprintf("%d of %d samples dropped: the request is larger than the metric queue (METRICS_QUEUE_SIZE)", dropped, len(samples)), http.StatusBadRequest)
+		return
+	}
+	if rejected > 0 {
+		http.Error(w, fmt.Sprintf("%d of %d samples rejected, first error: %v", rejected, len(samples), firstErr), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/aidenappl/monitor-core/responder"
 	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
 	"github.com/gorilla/mux"
 )
 
@@ -184,6 +186,11 @@ func parseQueryParams(r *http.Request) (services.QueryParams, error) {
 		}
 
 		field, op, isData := parseFilterKey(key)
+		if field == "level" && !isData && services.IsOrderedOperator(string(op)) {
+			if _, ok := structs.ParseLevel(values[0]); !ok {
+				return params, fmt.Errorf("invalid level %q for %s: expected one of %s", values[0], key, strings.Join(structs.Levels, ", "))
+			}
+		}
 
 		var value interface{}
 		if op == services.OpIn {
@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aidenappl/monitor-core/responder"
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/gorilla/mux"
+)
+
+// Schemas is the event schema registry checked on ingest (set from main.go)
+var Schemas *services.SchemaRegistry
+
+// ListSchemasHandler handles GET /v1/schemas requests
+// Lists registered schemas; ?service= limits it to one service
+func ListSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	responder.New(w, Schemas.List(r.URL.Query().Get("service")))
+}
+
+// GetSchemaHandler handles GET /v1/schemas/{service}/{name} requests
+func GetSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	schema, err := Schemas.Get(vars["service"], vars["name"])
+	if err != nil {
+		responder.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	responder.New(w, schema)
+}
+
+// PutSchemaHandler handles PUT /v1/schemas/{service}/{name} requests
+// Registers or replaces the schema for events with that service and name
+func PutSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+	var req structs.SchemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			responder.Error(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		responder.Error(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	schema, err := Schemas.Put(r.Context(), vars["service"], vars["name"], &req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSchema) {
+			responder.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		responder.ErrorWithCause(w, http.StatusInternalServerError, "failed to save schema", err)
+		return
+	}
+
+	responder.New(w, schema)
+}
+
+// DeleteSchemaHandler handles DELETE /v1/schemas/{service}/{name} requests
+func DeleteSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := Schemas.Delete(r.Context(), vars["service"], vars["name"]); err != nil {
+		if errors.Is(err, services.ErrSchemaNotFound) {
+			responder.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		responder.ErrorWithCause(w, http.StatusInternalServerError, "failed to delete schema", err)
+		return
+	}
+
+	responder.New(w, nil, "schema deleted")
+}
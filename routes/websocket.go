@@ -0,0 +1,260 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aidenappl/monitor-core/middleware"
+	"github.com/aidenappl/monitor-core/services"
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsAuthTimeout is how long a client has to send its auth message
+	wsAuthTimeout = 10 * time.Second
+	// wsPongWait is how long a connection may go without any message or pong
+	wsPongWait = 60 * time.Second
+	// wsPingInterval must be shorter than wsPongWait
+	wsPingInterval = 30 * time.Second
+	// wsWriteWait limits how long an ack or control message may take to send
+	wsWriteWait = 10 * time.Second
+)
+
+// wsUpgrader accepts connections from any origin, like the CORS policy of the
+// HTTP API; clients are authenticated by API key rather than by cookies
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsAuth is the first message a client sends when it could not set the
+// X-Api-Key header on the handshake (browsers cannot)
+type wsAuth struct {
+	APIKey string `json:"api_key"`
+}
+
+// wsAck acknowledges every frame received so far on a WebSocket connection
+type wsAck struct {
+	Ack      int64       `json:"ack"`      // number of frames processed
+	Accepted int64       `json:"accepted"` // totals for the connection
+	Dropped  int64       `json:"dropped"`
+	Rejected int64       `json:"rejected"`
+	Errors   []lineError `json:"errors"`          // lines rejected in the latest frame
+	Error    string      `json:"error,omitempty"` // the latest frame could not be read
+}
+
+// wsConnections tracks open WebSocket connections, which http.Server.Shutdown
+// does not wait for once they are hijacked
+type wsConnections struct {
+	mu     sync.Mutex
+	closed bool
+	ctx    context.Context // cancelled by CloseWebSockets
+	cancel context.CancelFunc
+	conns  map[*websocket.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+var websockets = newWSConnections()
+
+func newWSConnections() *wsConnections {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsConnections{ctx: ctx, cancel: cancel, conns: make(map[*websocket.Conn]struct{})}
+}
+
+func (c *wsConnections) add(conn *websocket.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.conns[conn] = struct{}{}
+	c.wg.Add(1)
+	return true
+}
+
+func (c *wsConnections) remove(conn *websocket.Conn) {
+	c.mu.Lock()
+	delete(c.conns, conn)
+	c.mu.Unlock()
+	c.wg.Done()
+}
+
+func (c *wsConnections) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// CloseWebSockets asks WebSocket clients to go away and waits for their
+// current frames to be acked, closing any connection still open when ctx ends.
+// Call it before closing the queue.
+func CloseWebSockets(ctx context.Context) {
+	c := websockets
+	c.cancel()
+	c.mu.Lock()
+	c.closed = true
+	for conn := range c.conns {
+		writeWSClose(conn, websocket.CloseGoingAway, "server is shutting down")
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.mu.Lock()
+		for conn := range c.conns {
+			conn.Close()
+		}
+		c.mu.Unlock()
+		<-done
+	}
+}
+
+// EventsWebSocketHandler handles GET /v1/events/ws. Clients authenticate once,
+// either with the X-Api-Key header on the handshake or with an
+// {"api_key": "..."} first message, then send NDJSON frames of events. Each
+// frame is validated and enqueued like a POST /v1/events body in partial mode
+// and answered with a cumulative ack, so after a reconnect a client resends
+// only the frames that were never acked.
+func EventsWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if Queue.Saturated() {
+		Queue.Reject()
+		setRetryAfter(w)
+		http.Error(w, "Event queue is saturated, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	// A header that is present must be valid; otherwise the key may follow
+	// in the first message
+	secret := r.Header.Get("X-Api-Key")
+	key, authenticated := middleware.Authenticate(secret)
+	if !authenticated && secret != "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if authenticated && !key.HasScope(structs.ScopeIngest) {
+		http.Error(w, "Forbidden: API key lacks the ingest scope", http.StatusForbidden)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		log.Printf("websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if !websockets.add(conn) {
+		writeWSClose(conn, websocket.CloseGoingAway, "server is shutting down")
+		return
+	}
+	defer websockets.remove(conn)
+
+	conn.SetReadLimit(MaxRequestBodySize)
+
+	if !authenticated {
+		if key, authenticated = authenticateWebSocket(conn); !authenticated {
+			writeWSClose(conn, websocket.ClosePolicyViolation, "unauthorized")
+			return
+		}
+		if !key.HasScope(structs.ScopeIngest) {
+			writeWSClose(conn, websocket.ClosePolicyViolation, "api key lacks the ingest scope")
+			return
+		}
+	}
+	r = r.WithContext(services.WithAPIKey(r.Context(), key))
+
+	// Keep idle connections alive through proxies and detect dead clients
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	stopPings := make(chan struct{})
+	defer close(stopPings)
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					return
+				}
+			case <-stopPings:
+				return
+			}
+		}
+	}()
+
+	var ack wsAck
+	for {
+		Queue.WaitFor(websockets.ctx, key.Tenant)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		_, reader, err := conn.NextReader()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				writeWSClose(conn, websocket.CloseMessageTooBig, "frame exceeds 10 MB")
+			} else if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !websockets.isClosed() {
+				log.Printf("websocket read failed: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		result, err := parseAndEnqueue(reader, ingestModePartial, newIngestStamp(r).withTraceparent(r))
+		if errors.Is(err, websocket.ErrReadLimit) {
+			writeWSClose(conn, websocket.CloseMessageTooBig, "frame exceeds 10 MB")
+			return
+		}
+
+		// Make accepted events durable before acknowledging them
+		if err := Queue.Sync(); err != nil {
+			log.Printf("failed to sync wal: %v", err)
+			writeWSClose(conn, websocket.CloseInternalServerErr, "failed to persist events")
+			return
+		}
+
+		ack.Ack++
+		ack.Accepted += int64(result.Accepted)
+		ack.Dropped += int64(result.Dropped)
+		ack.Rejected += int64(result.Rejected)
+		ack.Errors = result.Errors
+		ack.Error = ""
+		if err != nil {
+			ack.Error = err.Error()
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(ack); err != nil {
+			log.Printf("websocket write failed: %v", err)
+			return
+		}
+	}
+}
+
+// authenticateWebSocket reads the client's auth message, returning its key
+func authenticateWebSocket(conn *websocket.Conn) (*structs.APIKey, bool) {
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+
+	var auth wsAuth
+	if err := conn.ReadJSON(&auth); err != nil || auth.APIKey == "" {
+		return nil, false
+	}
+	return middleware.Authenticate(auth.APIKey)
+}
+
+func writeWSClose(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+}
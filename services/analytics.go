@@ -32,17 +32,76 @@ var validGroupByColumns = map[string]bool{
 	"level":      true,
 }
 
+// clockSkewField is a numeric events field: how far an event's timestamp is
+// ahead of (positive) or behind (negative) the time the server received it
+const clockSkewField = "clock_skew_ms"
+
+const clockSkewExpr = "toFloat64(toUnixTimestamp64Milli(timestamp) - toUnixTimestamp64Milli(received_at))"
+
+// querySchema resolves query fields against the columns of one table
+type querySchema struct {
+	table        func() string
+	field        func(field string) (string, error)
+	numericField func(field string) (string, error)
+	filterField  func(field, operator string) (string, error)
+
+	// weight is the column holding how many rows each stored row stands for
+	// after sampling; aggregations scale by it when set
+	weight string
+
+	// keyScoped is set when rows have the service and env columns that API
+	// keys can be restricted to
+	keyScoped bool
+}
+
+// eventsSchema queries events: their columns and data.* JSON fields
+var eventsSchema = querySchema{
+	table:        eventsTable,
+	field:        buildFieldExpr,
+	numericField: buildNumericFieldExpr,
+	filterField:  buildFilterFieldExpr,
+	weight:       "sample_rate",
+	keyScoped:    true,
+}
+
+// metricsSchema queries metric samples: name, value and labels.* entries
+var metricsSchema = querySchema{
+	table:        metricsTable,
+	field:        buildMetricFieldExpr,
+	numericField: buildMetricNumericFieldExpr,
+	filterField:  buildMetricFilterFieldExpr,
+}
+
+// schemaForSource returns the schema for a query source, "events" by default
+func schemaForSource(source string) (querySchema, error) {
+	switch source {
+	case "", "events":
+		return eventsSchema, nil
+	case "metrics":
+		return metricsSchema, nil
+	default:
+		return querySchema{}, fmt.Errorf("invalid source: %s", source)
+	}
+}
+
 // buildAggregationExpr builds the SQL aggregation expression
-// All expressions are wrapped in toFloat64() for consistent Go scanning
-func buildAggregationExpr(agg structs.AggregationType, field string) (string, error) {
+// All expressions are wrapped in toFloat64() for consistent Go scanning.
+// Counts, sums, averages and percentiles are weighted by the schema's sample
+// rate column so they estimate the totals before sampling.
+func buildAggregationExpr(schema querySchema, agg structs.AggregationType, field string) (string, error) {
 	switch agg {
 	case structs.AggCount:
+		if schema.weight != "" {
+			return fmt.Sprintf("toFloat64(sum(%s))", schema.weight), nil
+		}
+		return "toFloat64(count())", nil
+	case structs.AggCountStored:
 		return "toFloat64(count())", nil
 	case structs.AggCountUnique:
 		if field == "" {
 			return "", fmt.Errorf("field is required for count_unique aggregation")
 		}
-		col, err := buildFieldExpr(field)
+		col, err := schema.field(field)
 		if err != nil {
 			return "", err
 		}
@@ -51,25 +110,31 @@ func buildAggregationExpr(agg structs.AggregationType, field string) (string, er
 		if field == "" {
 			return "", fmt.Errorf("field is required for sum aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
+		if schema.weight != "" {
+			return fmt.Sprintf("toFloat64(sum(%s * %s))", col, schema.weight), nil
+		}
 		return fmt.Sprintf("toFloat64(sum(%s))", col), nil
 	case structs.AggAvg:
 		if field == "" {
 			return "", fmt.Errorf("field is required for avg aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
+		if schema.weight != "" {
+			return fmt.Sprintf("toFloat64(avgWeighted(%s, %s))", col, schema.weight), nil
+		}
 		return fmt.Sprintf("toFloat64(avg(%s))", col), nil
 	case structs.AggMin:
 		if field == "" {
 			return "", fmt.Errorf("field is required for min aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
@@ -78,7 +143,7 @@ func buildAggregationExpr(agg structs.AggregationType, field string) (string, er
 		if field == "" {
 			return "", fmt.Errorf("field is required for max aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
@@ -87,43 +152,52 @@ func buildAggregationExpr(agg structs.AggregationType, field string) (string, er
 		if field == "" {
 			return "", fmt.Errorf("field is required for p50 aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("toFloat64(quantile(0.5)(%s))", col), nil
+		return quantileExpr(schema, 0.5, col), nil
 	case structs.AggP90:
 		if field == "" {
 			return "", fmt.Errorf("field is required for p90 aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("toFloat64(quantile(0.9)(%s))", col), nil
+		return quantileExpr(schema, 0.9, col), nil
 	case structs.AggP95:
 		if field == "" {
 			return "", fmt.Errorf("field is required for p95 aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("toFloat64(quantile(0.95)(%s))", col), nil
+		return quantileExpr(schema, 0.95, col), nil
 	case structs.AggP99:
 		if field == "" {
 			return "", fmt.Errorf("field is required for p99 aggregation")
 		}
-		col, err := buildNumericFieldExpr(field)
+		col, err := schema.numericField(field)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("toFloat64(quantile(0.99)(%s))", col), nil
+		return quantileExpr(schema, 0.99, col), nil
 	default:
 		return "", fmt.Errorf("unsupported aggregation type: %s", agg)
 	}
 }
 
+// quantileExpr builds a percentile expression, weighted by sample rate when
+// the schema has one
+func quantileExpr(schema querySchema, level float64, col string) string {
+	if schema.weight != "" {
+		return fmt.Sprintf("toFloat64(quantileTDigestWeighted(%g)(%s, %s))", level, col, schema.weight)
+	}
+	return fmt.Sprintf("toFloat64(quantile(%g)(%s))", level, col)
+}
+
 // buildFieldExpr builds a SQL expression for a field (column or JSON path)
 func buildFieldExpr(field string) (string, error) {
 	if strings.HasPrefix(field, "data.") {
@@ -141,6 +215,9 @@ func buildFieldExpr(field string) (string, error) {
 
 // buildNumericFieldExpr builds a SQL expression for a numeric field
 func buildNumericFieldExpr(field string) (string, error) {
+	if field == clockSkewField {
+		return clockSkewExpr, nil
+	}
 	if strings.HasPrefix(field, "data.") {
 		key := strings.TrimPrefix(field, "data.")
 		if !safeIdentifierRegex.MatchString(key) {
@@ -148,11 +225,11 @@ func buildNumericFieldExpr(field string) (string, error) {
 		}
 		return fmt.Sprintf("toFloat64OrNull(JSONExtractRaw(data, '%s'))", key), nil
 	}
-	return "", fmt.Errorf("numeric aggregation only supported on data.* fields")
+	return "", fmt.Errorf("numeric aggregation only supported on data.* fields and %s", clockSkewField)
 }
 
 // buildGroupByExprs builds GROUP BY expressions
-func buildGroupByExprs(groupBy []string) ([]string, []string, error) {
+func buildGroupByExprs(schema querySchema, groupBy []string) ([]string, []string, error) {
 	if len(groupBy) > 10 {
 		return nil, nil, fmt.Errorf("too many group by fields (max 10)")
 	}
@@ -162,24 +239,18 @@ func buildGroupByExprs(groupBy []string) ([]string, []string, error) {
 
 	for i, g := range groupBy {
 		alias := fmt.Sprintf("group_%d", i)
-		if strings.HasPrefix(g, "data.") {
-			key := strings.TrimPrefix(g, "data.")
-			if !safeIdentifierRegex.MatchString(key) {
-				return nil, nil, fmt.Errorf("invalid data field name: %s", key)
-			}
-			exprs = append(exprs, fmt.Sprintf("JSONExtractString(data, '%s') AS %s", key, alias))
-		} else if validGroupByColumns[g] {
-			exprs = append(exprs, fmt.Sprintf("%s AS %s", g, alias))
-		} else {
-			return nil, nil, fmt.Errorf("invalid group by field: %s", g)
+		expr, err := schema.field(g)
+		if err != nil {
+			return nil, nil, err
 		}
+		exprs = append(exprs, fmt.Sprintf("%s AS %s", expr, alias))
 		aliases = append(aliases, alias)
 	}
 	return exprs, aliases, nil
 }
 
 // buildFilterClause builds WHERE clause from filters
-func buildFilterClause(filters []structs.QueryFilter) (string, []interface{}, error) {
+func buildFilterClause(schema querySchema, filters []structs.QueryFilter) (string, []interface{}, error) {
 	if len(filters) == 0 {
 		return "", nil, nil
 	}
@@ -188,7 +259,7 @@ func buildFilterClause(filters []structs.QueryFilter) (string, []interface{}, er
 	var args []interface{}
 
 	for _, f := range filters {
-		cond, condArgs, err := buildSingleFilter(f)
+		cond, condArgs, err := buildSingleFilter(schema, f)
 		if err != nil {
 			return "", nil, err
 		}
@@ -199,27 +270,72 @@ func buildFilterClause(filters []structs.QueryFilter) (string, []interface{}, er
 	return strings.Join(conditions, " AND "), args, nil
 }
 
-// buildSingleFilter builds a single filter condition
-func buildSingleFilter(f structs.QueryFilter) (string, []interface{}, error) {
-	var fieldExpr string
-
-	if strings.HasPrefix(f.Field, "data.") {
-		key := strings.TrimPrefix(f.Field, "data.")
+// buildFilterFieldExpr builds the SQL expression an event filter compares against
+func buildFilterFieldExpr(field, operator string) (string, error) {
+	if field == clockSkewField {
+		return clockSkewExpr, nil
+	}
+	if strings.HasPrefix(field, "data.") {
+		key := strings.TrimPrefix(field, "data.")
 		if !safeIdentifierRegex.MatchString(key) {
-			return "", nil, fmt.Errorf("invalid data field name: %s", key)
+			return "", fmt.Errorf("invalid data field name: %s", key)
 		}
 		// Check if operator suggests numeric comparison
-		switch f.Operator {
+		switch operator {
 		case "lt", "gt", "lte", "gte":
-			fieldExpr = fmt.Sprintf("toFloat64OrNull(JSONExtractRaw(data, '%s'))", key)
+			return fmt.Sprintf("toFloat64OrNull(JSONExtractRaw(data, '%s'))", key), nil
 		default:
-			fieldExpr = fmt.Sprintf("JSONExtractString(data, '%s')", key)
+			return fmt.Sprintf("JSONExtractString(data, '%s')", key), nil
 		}
-	} else if validColumns[f.Field] {
-		fieldExpr = f.Field
-	} else {
-		return "", nil, fmt.Errorf("invalid filter field: %s", f.Field)
 	}
+	if !validColumns[field] {
+		return "", fmt.Errorf("invalid filter field: %s", field)
+	}
+	return field, nil
+}
+
+// buildMetricFieldExpr builds a SQL expression for a metric name or labels.* entry
+func buildMetricFieldExpr(field string) (string, error) {
+	if strings.HasPrefix(field, "labels.") {
+		key := strings.TrimPrefix(field, "labels.")
+		if !safeIdentifierRegex.MatchString(key) {
+			return "", fmt.Errorf("invalid label name: %s", key)
+		}
+		return fmt.Sprintf("labels['%s']", key), nil
+	}
+	if field != "name" {
+		return "", fmt.Errorf("invalid metrics field: %s", field)
+	}
+	return field, nil
+}
+
+// buildMetricNumericFieldExpr builds a SQL expression for a numeric metric field
+func buildMetricNumericFieldExpr(field string) (string, error) {
+	if field != "value" {
+		return "", fmt.Errorf("numeric aggregation only supported on value for metrics")
+	}
+	return field, nil
+}
+
+// buildMetricFilterFieldExpr builds the SQL expression a metric filter compares against
+func buildMetricFilterFieldExpr(field, operator string) (string, error) {
+	if field == "value" {
+		return field, nil
+	}
+	return buildMetricFieldExpr(field)
+}
+
+// buildSingleFilter builds a single filter condition
+func buildSingleFilter(schema querySchema, f structs.QueryFilter) (string, []interface{}, error) {
+	fieldExpr, err := schema.filterField(f.Field, f.Operator)
+	if err != nil {
+		return "", nil, err
+	}
+	// Only events have these columns; other schemas rejected them above
+	if f.Field == "level" && IsOrderedOperator(f.Operator) {
+		return severityCondition(f.Operator, f.Value)
+	}
+	f.Value = normalizeFilterValue(f.Field, f.Operator, f.Value)
 
 	switch f.Operator {
 	case "eq", "":
@@ -263,6 +379,37 @@ func buildSingleFilter(f structs.QueryFilter) (string, []interface{}, error) {
 	}
 }
 
+// callerWhere returns the conditions that limit a query to the rows the
+// caller may read: those of its tenant and, if its API key is restricted, of
+// the key's services and envs
+func callerWhere(ctx context.Context, schema querySchema) ([]string, []interface{}, error) {
+	whereParts := []string{"tenant = ?"}
+	args := []interface{}{TenantFromContext(ctx)}
+
+	key := APIKeyFromContext(ctx)
+	if !key.Restricted() {
+		return whereParts, args, nil
+	}
+	if !schema.keyScoped {
+		return nil, nil, fmt.Errorf("invalid source: API keys restricted to services or envs can only query events")
+	}
+	for _, f := range []structs.QueryFilter{
+		{Field: "service", Operator: "in", Value: key.Services},
+		{Field: "env", Operator: "in", Value: key.Envs},
+	} {
+		if len(f.Value.([]string)) == 0 {
+			continue
+		}
+		clause, clauseArgs, err := buildSingleFilter(schema, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		whereParts = append(whereParts, clause)
+		args = append(args, clauseArgs...)
+	}
+	return whereParts, args, nil
+}
+
 // buildIntervalExpr builds the time bucket expression
 func buildIntervalExpr(interval structs.IntervalType) (string, error) {
 	switch interval {
@@ -284,7 +431,7 @@ func buildIntervalExpr(interval structs.IntervalType) (string, error) {
 // QueryAnalytics executes an analytics query
 func QueryAnalytics(ctx context.Context, query *structs.AnalyticsQuery) (*structs.AnalyticsResult, error) {
 	// Build aggregation expression
-	aggExpr, err := buildAggregationExpr(query.Aggregation, query.Field)
+	aggExpr, err := buildAggregationExpr(eventsSchema, query.Aggregation, query.Field)
 	if err != nil {
 		return nil, err
 	}
@@ -295,7 +442,7 @@ func QueryAnalytics(ctx context.Context, query *structs.AnalyticsQuery) (*struct
 	// Build GROUP BY
 	var groupByAliases []string
 	if len(query.GroupBy) > 0 {
-		groupByExprs, aliases, err := buildGroupByExprs(query.GroupBy)
+		groupByExprs, aliases, err := buildGroupByExprs(eventsSchema, query.GroupBy)
 		if err != nil {
 			return nil, err
 		}
@@ -303,9 +450,11 @@ func QueryAnalytics(ctx context.Context, query *structs.AnalyticsQuery) (*struct
 		groupByAliases = aliases
 	}
 
-	// Build WHERE clause
-	var whereParts []string
-	var args []interface{}
+	// Build WHERE clause, scoped to what the caller may read
+	whereParts, args, err := callerWhere(ctx, eventsSchema)
+	if err != nil {
+		return nil, err
+	}
 
 	// Time range
 	if !query.From.IsZero() {
@@ -319,7 +468,7 @@ func QueryAnalytics(ctx context.Context, query *structs.AnalyticsQuery) (*struct
 
 	// Filters
 	if len(query.Filters) > 0 {
-		filterClause, filterArgs, err := buildFilterClause(query.Filters)
+		filterClause, filterArgs, err := buildFilterClause(eventsSchema, query.Filters)
 		if err != nil {
 			return nil, err
 		}
@@ -448,8 +597,13 @@ func QueryTimeSeries(ctx context.Context, query *structs.TimeSeriesQuery) (*stru
 		}
 	}
 
+	schema, err := schemaForSource(query.Source)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build aggregation expression
-	aggExpr, err := buildAggregationExpr(query.Aggregation, query.Field)
+	aggExpr, err := buildAggregationExpr(schema, query.Aggregation, query.Field)
 	if err != nil {
 		return nil, err
 	}
@@ -471,7 +625,7 @@ func QueryTimeSeries(ctx context.Context, query *structs.TimeSeriesQuery) (*stru
 	var groupByAliases []string
 
 	if len(query.GroupBy) > 0 {
-		groupByExprs, aliases, err := buildGroupByExprs(query.GroupBy)
+		groupByExprs, aliases, err := buildGroupByExprs(schema, query.GroupBy)
 		if err != nil {
 			return nil, err
 		}
@@ -480,9 +634,11 @@ func QueryTimeSeries(ctx context.Context, query *structs.TimeSeriesQuery) (*stru
 		groupByParts = append(groupByParts, aliases...)
 	}
 
-	// Build WHERE clause
-	var whereParts []string
-	var args []interface{}
+	// Build WHERE clause, scoped to what the caller may read
+	whereParts, args, err := callerWhere(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
 
 	// Time range
 	if !query.From.IsZero() {
@@ -496,7 +652,7 @@ func QueryTimeSeries(ctx context.Context, query *structs.TimeSeriesQuery) (*stru
 
 	// Filters
 	if len(query.Filters) > 0 {
-		filterClause, filterArgs, err := buildFilterClause(query.Filters)
+		filterClause, filterArgs, err := buildFilterClause(schema, query.Filters)
 		if err != nil {
 			return nil, err
 		}
@@ -507,7 +663,7 @@ func QueryTimeSeries(ctx context.Context, query *structs.TimeSeriesQuery) (*stru
 	}
 
 	// Build query
-	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectParts, ", "), eventsTable())
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectParts, ", "), schema.table())
 
 	if len(whereParts) > 0 {
 		sql += " WHERE " + strings.Join(whereParts, " AND ")
@@ -689,7 +845,7 @@ func advanceTime(t time.Time, interval structs.IntervalType) time.Time {
 // QueryTopN executes a top N query
 func QueryTopN(ctx context.Context, query *structs.TopNQuery) (*structs.TopNResult, error) {
 	// Build aggregation expression
-	aggExpr, err := buildAggregationExpr(query.Aggregation, query.Field)
+	aggExpr, err := buildAggregationExpr(eventsSchema, query.Aggregation, query.Field)
 	if err != nil {
 		return nil, err
 	}
@@ -708,9 +864,11 @@ func QueryTopN(ctx context.Context, query *structs.TopNQuery) (*structs.TopNResu
 		return nil, fmt.Errorf("invalid group by field: %s", query.GroupBy)
 	}
 
-	// Build WHERE clause
-	var whereParts []string
-	var args []interface{}
+	// Build WHERE clause, scoped to what the caller may read
+	whereParts, args, err := callerWhere(ctx, eventsSchema)
+	if err != nil {
+		return nil, err
+	}
 
 	// Time range
 	if !query.From.IsZero() {
@@ -724,7 +882,7 @@ func QueryTopN(ctx context.Context, query *structs.TopNQuery) (*structs.TopNResu
 
 	// Filters
 	if len(query.Filters) > 0 {
-		filterClause, filterArgs, err := buildFilterClause(query.Filters)
+		filterClause, filterArgs, err := buildFilterClause(eventsSchema, query.Filters)
 		if err != nil {
 			return nil, err
 		}
@@ -789,14 +947,16 @@ func QueryTopN(ctx context.Context, query *structs.TopNQuery) (*structs.TopNResu
 // QueryGauge executes a gauge query (single value)
 func QueryGauge(ctx context.Context, query *structs.GaugeQuery) (*structs.GaugeResult, error) {
 	// Build aggregation expression
-	aggExpr, err := buildAggregationExpr(query.Aggregation, query.Field)
+	aggExpr, err := buildAggregationExpr(eventsSchema, query.Aggregation, query.Field)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build WHERE clause
-	var whereParts []string
-	var args []interface{}
+	// Build WHERE clause, scoped to what the caller may read
+	whereParts, args, err := callerWhere(ctx, eventsSchema)
+	if err != nil {
+		return nil, err
+	}
 
 	// Time range
 	if !query.From.IsZero() {
@@ -810,7 +970,7 @@ func QueryGauge(ctx context.Context, query *structs.GaugeQuery) (*structs.GaugeR
 
 	// Filters
 	if len(query.Filters) > 0 {
-		filterClause, filterArgs, err := buildFilterClause(query.Filters)
+		filterClause, filterArgs, err := buildFilterClause(eventsSchema, query.Filters)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix starts every generated secret, so leaked keys are easy to
+// recognize
+const apiKeyPrefix = "mck_"
+
+// ErrKeyNotFound is returned for an API key ID that does not exist
+var ErrKeyNotFound = errors.New("api key not found")
+
+// ErrInvalidKey marks an API key request that cannot be fulfilled
+var ErrInvalidKey = errors.New("invalid api key")
+
+// KeyStore persists API keys
+type KeyStore interface {
+	LoadKeys(ctx context.Context) ([]*structs.APIKey, error)
+	SaveKey(ctx context.Context, key *structs.APIKey) error
+
+	// TouchKeys records when keys were last used
+	TouchKeys(ctx context.Context, used map[string]time.Time) error
+}
+
+// APIKeys holds the API keys in a store and authenticates requests against
+// them. Changes are written to the store and picked up by other instances
+// when they reload it. It is safe for concurrent use; a nil registry has no
+// keys.
+type APIKeys struct {
+	store   KeyStore
+	writeMu sync.Mutex // serializes changes, held across store calls
+	mu      sync.RWMutex
+	byID    map[string]*managedKey
+	byHash  map[string]*managedKey
+}
+
+type managedKey struct {
+	key      structs.APIKey
+	lastUsed atomic.Int64 // unix nanoseconds, zero if never used
+	flushed  atomic.Int64 // lastUsed as last written to the store
+}
+
+type apiKeyContextKey struct{}
+
+// NewAPIKeys creates an empty registry backed by store
+func NewAPIKeys(store KeyStore) *APIKeys {
+	return &APIKeys{
+		store:  store,
+		byID:   make(map[string]*managedKey),
+		byHash: make(map[string]*managedKey),
+	}
+}
+
+// Load replaces the keys with those in the store. Uses not yet written to
+// the store carry over.
+func (k *APIKeys) Load(ctx context.Context) error {
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+
+	stored, err := k.store.LoadKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	byID := make(map[string]*managedKey, len(stored))
+	byHash := make(map[string]*managedKey, len(stored))
+	for _, s := range stored {
+		entry := &managedKey{key: *s}
+		if s.LastUsedAt != nil {
+			entry.lastUsed.Store(s.LastUsedAt.UnixNano())
+			entry.flushed.Store(s.LastUsedAt.UnixNano())
+		}
+		if old, ok := k.byID[s.ID]; ok {
+			if used := old.lastUsed.Load(); used > entry.lastUsed.Load() {
+				entry.lastUsed.Store(used)
+			}
+			entry.flushed.Store(max(entry.flushed.Load(), old.flushed.Load()))
+		}
+		byID[s.ID] = entry
+		byHash[s.Hash] = entry
+	}
+	k.byID, k.byHash = byID, byHash
+	return nil
+}
+
+// Run records when keys were last used and reloads them every interval until
+// ctx is cancelled, so changes made through other instances take effect. A
+// zero interval never reloads.
+func (k *APIKeys) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.FlushUsage(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("failed to record api key usage: %v", err)
+			}
+			if err := k.Load(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("failed to reload api keys: %v", err)
+			}
+		}
+	}
+}
+
+// FlushUsage writes when keys were last used to the store
+func (k *APIKeys) FlushUsage(ctx context.Context) error {
+	k.mu.RLock()
+	used := make(map[string]time.Time)
+	var entries []*managedKey
+	for id, entry := range k.byID {
+		if last := entry.lastUsed.Load(); last > entry.flushed.Load() {
+			used[id] = time.Unix(0, last).UTC()
+			entries = append(entries, entry)
+		}
+	}
+	k.mu.RUnlock()
+	if len(used) == 0 {
+		return nil
+	}
+
+	if err := k.store.TouchKeys(ctx, used); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entry.flushed.Store(used[entry.key.ID].UnixNano())
+	}
+	return nil
+}
+
+// Len returns the number of keys, including revoked and expired ones
+func (k *APIKeys) Len() int {
+	if k == nil {
+		return 0
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.byID)
+}
+
+// Authenticate returns the active key whose secret is secret, recording
+// that it was used
+func (k *APIKeys) Authenticate(secret string) (*structs.APIKey, bool) {
+	if k == nil || secret == "" {
+		return nil, false
+	}
+	k.mu.RLock()
+	entry, ok := k.byHash[hashAPIKey(secret)]
+	k.mu.RUnlock()
+
+	now := time.Now()
+	if !ok || !entry.key.Active(now) {
+		return nil, false
+	}
+	entry.lastUsed.Store(now.UnixNano())
+	return entry.snapshot(), true
+}
+
+// List returns the keys of a tenant, or of all tenants if tenant is empty,
+// sorted by tenant and name
+func (k *APIKeys) List(tenant string) []*structs.APIKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	list := []*structs.APIKey{}
+	for _, entry := range k.byID {
+		if tenant == "" || entry.key.Tenant == tenant {
+			list = append(list, entry.snapshot())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Tenant != list[j].Tenant {
+			return list[i].Tenant < list[j].Tenant
+		}
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Get returns a key of a tenant, or of any tenant if tenant is empty
+func (k *APIKeys) Get(tenant, id string) (*structs.APIKey, error) {
+	entry, err := k.lookup(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return entry.snapshot(), nil
+}
+
+// Create adds a key and returns it with its secret. The tenant defaults to
+// the default tenant.
+func (k *APIKeys) Create(ctx context.Context, req *structs.APIKeyRequest) (*structs.APIKeySecret, error) {
+	key, err := newAPIKey(req)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key.Prefix, key.Hash = secretPrefix(secret), hashAPIKey(secret)
+
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+
+	if err := k.store.SaveKey(ctx, key); err != nil {
+		return nil, err
+	}
+	entry := &managedKey{key: *key}
+	k.publish(nil, entry)
+	return &structs.APIKeySecret{APIKey: entry.snapshot(), Key: secret}, nil
+}
+
+// Rotate gives a key a new secret, returned with the key. The old secret
+// stops working at once.
+func (k *APIKeys) Rotate(ctx context.Context, tenant, id string) (*structs.APIKeySecret, error) {
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+
+	old, err := k.lookup(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if old.key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: key is revoked", ErrInvalidKey)
+	}
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &managedKey{key: old.key}
+	entry.key.Prefix, entry.key.Hash = secretPrefix(secret), hashAPIKey(secret)
+	entry.key.UpdatedAt = time.Now().UTC()
+	if err := k.store.SaveKey(ctx, &entry.key); err != nil {
+		return nil, err
+	}
+	entry.lastUsed.Store(old.lastUsed.Load())
+	entry.flushed.Store(old.flushed.Load())
+	k.publish(old, entry)
+	return &structs.APIKeySecret{APIKey: entry.snapshot(), Key: secret}, nil
+}
+
+// Revoke disables a key for good. Revoked keys stay listed.
+func (k *APIKeys) Revoke(ctx context.Context, tenant, id string) (*structs.APIKey, error) {
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+
+	old, err := k.lookup(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if old.key.RevokedAt != nil {
+		return old.snapshot(), nil
+	}
+
+	now := time.Now().UTC()
+	entry := &managedKey{key: old.key}
+	entry.key.RevokedAt = &now
+	entry.key.UpdatedAt = now
+	if err := k.store.SaveKey(ctx, &entry.key); err != nil {
+		return nil, err
+	}
+	entry.lastUsed.Store(old.lastUsed.Load())
+	entry.flushed.Store(old.flushed.Load())
+	k.publish(old, entry)
+	return entry.snapshot(), nil
+}
+
+func (k *APIKeys) lookup(tenant, id string) (*managedKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entry, ok := k.byID[id]
+	if !ok || (tenant != "" && entry.key.Tenant != tenant) {
+		return nil, ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+// publish replaces old, which may be nil, with entry
+func (k *APIKeys) publish(old, entry *managedKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if old != nil {
+		delete(k.byHash, old.key.Hash)
+	}
+	k.byID[entry.key.ID] = entry
+	k.byHash[entry.key.Hash] = entry
+}
+
+// snapshot returns a copy of the key without its hash and with its last use
+func (entry *managedKey) snapshot() *structs.APIKey {
+	key := entry.key
+	key.Hash = ""
+	if last := entry.lastUsed.Load(); last > 0 {
+		t := time.Unix(0, last).UTC()
+		key.LastUsedAt = &t
+	}
+	return &key
+}
+
+// newAPIKey validates a key request
+func newAPIKey(req *structs.APIKeyRequest) (*structs.APIKey, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidKey)
+	}
+	tenant := req.Tenant
+	if tenant == "" {
+		tenant = structs.DefaultTenant
+	}
+	if !tenantNameRegex.MatchString(tenant) {
+		return nil, fmt.Errorf("%w: tenant must be lowercase letters, digits, '-' or '_'", ErrInvalidKey)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: scopes are required", ErrInvalidKey)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(structs.Scopes, scope) {
+			return nil, fmt.Errorf("%w: scope %q must be one of %v", ErrInvalidKey, scope, structs.Scopes)
+		}
+	}
+	if slices.Contains(req.Services, "") || slices.Contains(req.Envs, "") {
+		return nil, fmt.Errorf("%w: services and envs must not be empty strings", ErrInvalidKey)
+	}
+	now := time.Now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidKey)
+	}
+
+	key := &structs.APIKey{
+		ID:        uuid.NewString(),
+		Name:      req.Name,
+		Tenant:    tenant,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		Services:  req.Services,
+		Envs:      req.Envs,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if req.ExpiresAt != nil {
+		expires := req.ExpiresAt.UTC()
+		key.ExpiresAt = &expires
+	}
+	return key, nil
+}
+
+// generateAPIKey returns a new random secret
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIKey returns the hex SHA-256 of a secret. Secrets are random, so a
+// fast hash is enough to make the stored hashes useless to an attacker.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func secretPrefix(secret string) string {
+	return secret[:len(apiKeyPrefix)+6]
+}
+
+// WithAPIKey returns a context carrying the API key a request was sent with
+// and its tenant
+func WithAPIKey(ctx context.Context, key *structs.APIKey) context.Context {
+	return context.WithValue(WithTenant(ctx, key.Tenant), apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the API key a request was sent with, or nil
+func APIKeyFromContext(ctx context.Context) *structs.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*structs.APIKey)
+	return key
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"log"
+	"math/rand/v2"
 	"time"
 
 	"github.com/aidenappl/monitor-core/structs"
@@ -13,13 +14,68 @@ type Writer interface {
 	WriteBatch(ctx context.Context, events []*structs.Event) error
 }
 
+// RetryPolicy controls how failed batch writes are retried
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Retryable  func(error) bool // nil treats every error as retryable
+}
+
+// backoff returns the delay before retry number attempt (0-based):
+// exponential growth capped at MaxDelay, with jitter over the upper half
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half+1)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return true
+	}
+	return p.Retryable(err)
+}
+
+// do calls write until it succeeds, retrying retryable errors with backoff
+func (p RetryPolicy) do(ctx context.Context, write func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.MaxRetries || !p.retryable(err) {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		log.Printf("write attempt %d/%d failed, retrying in %v: %v", attempt+1, p.MaxRetries+1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
 // Batcher collects events and flushes them in batches
 type Batcher struct {
 	queue         *Queue
 	writer        Writer
+	wal           *WAL
+	deadLetter    *DeadLetter
+	retry         RetryPolicy
 	batchSize     int
 	flushInterval time.Duration
 	batch         []*structs.Event
+	batchPos      WALPosition
 }
 
 // NewBatcher creates a new batcher
@@ -27,18 +83,54 @@ func NewBatcher(queue *Queue, writer Writer, batchSize int, flushInterval time.D
 	return &Batcher{
 		queue:         queue,
 		writer:        writer,
+		wal:           queue.WAL(),
 		batchSize:     batchSize,
 		flushInterval: flushInterval,
 		batch:         make([]*structs.Event, 0, batchSize),
 	}
 }
 
+// SetRetryPolicy configures retries for failed writes (default: no retries)
+func (b *Batcher) SetRetryPolicy(policy RetryPolicy) {
+	b.retry = policy
+}
+
+// SetDeadLetter configures where batches go once retries are exhausted
+func (b *Batcher) SetDeadLetter(deadLetter *DeadLetter) {
+	b.deadLetter = deadLetter
+}
+
+// DeadLetter returns the configured dead-letter sink, or nil
+func (b *Batcher) DeadLetter() *DeadLetter {
+	return b.deadLetter
+}
+
+// Redrive writes dead-lettered events back through the writer, using the
+// same batch size and retry policy as regular flushes
+func (b *Batcher) Redrive(ctx context.Context, name string) (*RedriveResult, error) {
+	return b.deadLetter.Redrive(ctx, name, b.batchSize, b.write)
+}
+
 // Run starts the batcher loop
 func (b *Batcher) Run(ctx context.Context) {
+	if b.wal != nil {
+		if err := b.replay(ctx); err != nil {
+			log.Printf("wal replay stopped: %v", err)
+			return
+		}
+	}
+
 	ticker := time.NewTicker(b.flushInterval)
 	defer ticker.Stop()
 
 	for {
+		// While a failed batch is retained for the WAL, stop consuming so the
+		// queue fills up and ingest starts rejecting instead of losing events
+		events := b.queue.Events()
+		if b.wal != nil && len(b.batch) >= b.batchSize {
+			events = nil
+		}
+
 		select {
 		case <-ctx.Done():
 			if len(b.batch) > 0 {
@@ -46,14 +138,16 @@ func (b *Batcher) Run(ctx context.Context) {
 			}
 			return
 
-		case event, ok := <-b.queue.Events():
+		case qe, ok := <-events:
 			if !ok {
 				if len(b.batch) > 0 {
 					b.flush(ctx)
 				}
 				return
 			}
-			b.batch = append(b.batch, event)
+			b.queue.dequeued(qe.Event)
+			b.batch = append(b.batch, qe.Event)
+			b.batchPos = qe.Pos
 			if len(b.batch) >= b.batchSize {
 				b.flush(ctx)
 			}
@@ -66,20 +160,98 @@ func (b *Batcher) Run(ctx context.Context) {
 	}
 }
 
-func (b *Batcher) flush(ctx context.Context) {
+func (b *Batcher) flush(ctx context.Context) error {
 	if len(b.batch) == 0 {
-		return
+		return nil
 	}
 
 	start := time.Now()
-	err := b.writer.WriteBatch(ctx, b.batch)
+	err := b.write(ctx, b.batch)
 	duration := time.Since(start)
 
 	if err != nil {
 		log.Printf("failed to write batch of %d events: %v", len(b.batch), err)
+
+		if b.deadLetter != nil {
+			name, dlErr := b.deadLetter.Write(b.batch)
+			if dlErr == nil {
+				log.Printf("dead-lettered %d events to %s", len(b.batch), name)
+				b.commit(b.batchPos)
+				b.batch = b.batch[:0]
+				return nil
+			}
+			log.Printf("failed to dead-letter batch of %d events: %v", len(b.batch), dlErr)
+		}
+
+		if b.wal != nil {
+			// Keep the batch; it is retried on the next tick and still in the WAL
+			return err
+		}
 	} else {
 		log.Printf("flushed %d events in %v", len(b.batch), duration)
+		b.commit(b.batchPos)
 	}
 
 	b.batch = b.batch[:0]
+	return err
+}
+
+// write sends events to the writer, retrying retryable errors with backoff
+func (b *Batcher) write(ctx context.Context, events []*structs.Event) error {
+	return b.retry.do(ctx, func() error {
+		return b.writer.WriteBatch(ctx, events)
+	})
+}
+
+// commit truncates the WAL up to pos once its events are stored
+func (b *Batcher) commit(pos WALPosition) {
+	if b.wal == nil {
+		return
+	}
+	if err := b.wal.Commit(pos); err != nil {
+		log.Printf("failed to commit wal position %d:%d: %v", pos.Segment, pos.Offset, err)
+	}
+}
+
+// replay writes events left in the WAL by a previous run before any new
+// events are consumed, retrying every flush interval until ClickHouse accepts them
+func (b *Batcher) replay(ctx context.Context) error {
+	replayed := 0
+
+	err := b.wal.Replay(func(event *structs.Event, pos WALPosition) error {
+		b.batch = append(b.batch, event)
+		b.batchPos = pos
+		if len(b.batch) < b.batchSize {
+			return nil
+		}
+		replayed += len(b.batch)
+		return b.flushUntilDone(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	replayed += len(b.batch)
+	if err := b.flushUntilDone(ctx); err != nil {
+		return err
+	}
+
+	if replayed > 0 {
+		log.Printf("replayed %d events from wal", replayed)
+	}
+	return nil
+}
+
+func (b *Batcher) flushUntilDone(ctx context.Context) error {
+	for {
+		if err := b.flush(ctx); err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.flushInterval):
+		}
+	}
 }
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+var errPermanent = errors.New("permanent")
+
+// failingWriter fails writes of batches holding an event named "bad"
+type failingWriter struct {
+	mu      sync.Mutex
+	written []string
+}
+
+func (w *failingWriter) WriteBatch(ctx context.Context, events []*structs.Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, e := range events {
+		if e.Name == "bad" {
+			return errPermanent
+		}
+	}
+	for _, e := range events {
+		w.written = append(w.written, e.Name)
+	}
+	return nil
+}
+
+func (w *failingWriter) names() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.written...)
+}
+
+func TestBatcherPermanentFailuresWithWAL(t *testing.T) {
+	tests := []struct {
+		name         string
+		deadLetter   bool
+		wantWritten  []string
+		wantReplayed int
+	}{
+		// The failed batch is dead-lettered and the log moves past it
+		{"dead letter", true, []string{"good"}, 0},
+		// Without a dead-letter sink the failed batch is kept, and the log
+		// holds it and everything after it
+		{"no dead letter", false, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			wal, err := OpenWAL(dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			queue := NewDurableQueue(10, wal)
+			writer := &failingWriter{}
+			batcher := NewBatcher(queue, writer, 1, 10*time.Millisecond)
+			batcher.SetRetryPolicy(RetryPolicy{Retryable: func(err error) bool { return !errors.Is(err, errPermanent) }})
+			var deadLetter *DeadLetter
+			if tt.deadLetter {
+				if deadLetter, err = NewDeadLetter(t.TempDir()); err != nil {
+					t.Fatal(err)
+				}
+				batcher.SetDeadLetter(deadLetter)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				batcher.Run(ctx)
+				close(done)
+			}()
+
+			for _, name := range []string{"bad", "good"} {
+				if !queue.Enqueue(&structs.Event{Service: "api", Name: name}) {
+					t.Fatalf("enqueue %s failed", name)
+				}
+			}
+
+			deadline := time.Now().Add(200 * time.Millisecond)
+			for len(writer.names()) < len(tt.wantWritten) || time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			cancel()
+			<-done
+			wal.Close()
+
+			if names := writer.names(); !reflect.DeepEqual(names, tt.wantWritten) {
+				t.Fatalf("written = %v, want %v", names, tt.wantWritten)
+			}
+			if deadLetter != nil {
+				files, err := deadLetter.List()
+				if err != nil || len(files) != 1 {
+					t.Fatalf("dead-letter files = %v, %v, want 1", files, err)
+				}
+			}
+
+			// Only events that were neither stored nor dead-lettered are replayed
+			reopened, err := OpenWAL(dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			replayed := 0
+			if err := reopened.Replay(func(*structs.Event, WALPosition) error {
+				replayed++
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if replayed != tt.wantReplayed {
+				t.Fatalf("replayed %d events, want %d", replayed, tt.wantReplayed)
+			}
+		})
+	}
+}
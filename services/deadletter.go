@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+const deadLetterSuffix = ".ndjson"
+
+// ErrDeadLetterNotFound is returned for a dead-letter file that does not exist
+var ErrDeadLetterNotFound = errors.New("dead-letter file not found")
+
+// ErrInvalidDeadLetterName is returned for a name that cannot be a dead-letter
+// file
+var ErrInvalidDeadLetterName = errors.New("invalid dead-letter file name")
+
+// DeadLetter stores batches that could not be written as NDJSON files on disk.
+// Each line is a plain event, so files can also be re-posted to /v1/events.
+type DeadLetter struct {
+	dir string
+	seq atomic.Uint64
+
+	// mu serializes redrives so a file is never re-driven twice at once
+	mu sync.Mutex
+}
+
+// DeadLetterFile describes a dead-letter file waiting to be re-driven
+type DeadLetterFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RedriveResult summarizes a redrive of one or more dead-letter files
+type RedriveResult struct {
+	Files   int      `json:"files"`
+	Written int      `json:"written"`
+	Failed  []string `json:"failed"`
+}
+
+// NewDeadLetter creates a dead-letter sink writing into dir
+func NewDeadLetter(dir string) (*DeadLetter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter directory: %w", err)
+	}
+	return &DeadLetter{dir: dir}, nil
+}
+
+// Write stores events in a new dead-letter file and returns its name
+func (d *DeadLetter) Write(events []*structs.Event) (string, error) {
+	name := fmt.Sprintf("dlq-%d-%d%s", time.Now().UnixNano(), d.seq.Add(1), deadLetterSuffix)
+	if err := d.writeFile(name, events); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// List returns the dead-letter files in the order they were written
+func (d *DeadLetter) List() ([]DeadLetterFile, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-letter directory: %w", err)
+	}
+
+	files := []DeadLetterFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), deadLetterSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, DeadLetterFile{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime().UTC(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].CreatedAt.Before(files[j].CreatedAt) })
+	return files, nil
+}
+
+// Read loads every event stored in a dead-letter file
+func (d *DeadLetter) Read(name string) ([]*structs.Event, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), walMaxEntrySize)
+
+	var events []*structs.Event
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var event structs.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("invalid dead-letter entry in %s: %w", name, err)
+		}
+		events = append(events, &event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+
+	return events, nil
+}
+
+// Replace rewrites a dead-letter file with the given events, removing it when empty
+func (d *DeadLetter) Replace(name string, events []*structs.Event) error {
+	if len(events) == 0 {
+		return d.Remove(name)
+	}
+	return d.writeFile(name, events)
+}
+
+// Remove deletes a dead-letter file
+func (d *DeadLetter) Remove(name string) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove dead-letter file: %w", err)
+	}
+	return nil
+}
+
+// writeFile writes events to a temp file and renames it into place so that
+// List never sees a partially written file
+func (d *DeadLetter) writeFile(name string, events []*structs.Event) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-letter file: %w", err)
+	}
+
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to encode dead-letter entry: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync dead-letter file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close dead-letter file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move dead-letter file into place: %w", err)
+	}
+	return nil
+}
+
+// path resolves a file name inside the dead-letter directory, rejecting
+// anything that could escape it
+func (d *DeadLetter) path(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || !strings.HasSuffix(name, deadLetterSuffix) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDeadLetterName, name)
+	}
+	return filepath.Join(d.dir, name), nil
+}
+
+// Redrive writes the events in the named file (or every file when name is
+// empty) in chunks of batchSize. Chunks that fail are kept on disk so a later
+// redrive only resends what is still missing.
+func (d *DeadLetter) Redrive(ctx context.Context, name string, batchSize int, write func(ctx context.Context, events []*structs.Event) error) (*RedriveResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var names []string
+	if name != "" {
+		if _, err := d.path(name); err != nil {
+			return nil, err
+		}
+		names = []string{name}
+	} else {
+		files, err := d.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+	}
+
+	result := &RedriveResult{Failed: []string{}}
+	for _, n := range names {
+		events, err := d.Read(n)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && name != "" {
+				return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, n)
+			}
+			log.Printf("redrive %s: %v", n, err)
+			result.Failed = append(result.Failed, n)
+			continue
+		}
+		result.Files++
+
+		var remaining []*structs.Event
+		for start := 0; start < len(events); start += batchSize {
+			end := min(start+batchSize, len(events))
+			if err := write(ctx, events[start:end]); err != nil {
+				log.Printf("redrive %s: failed to write %d events: %v", n, end-start, err)
+				remaining = append(remaining, events[start:end]...)
+				continue
+			}
+			result.Written += end - start
+		}
+
+		if err := d.Replace(n, remaining); err != nil {
+			log.Printf("redrive %s: %v", n, err)
+		}
+		if len(remaining) > 0 {
+			result.Failed = append(result.Failed, n)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestDeadLetterRedriveErrors(t *testing.T) {
+	d, err := NewDeadLetter(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(context.Context, []*structs.Event) error { return nil }
+
+	tests := []struct {
+		name string
+		file string
+		want error
+	}{
+		{"path traversal", "../events.ndjson", ErrInvalidDeadLetterName},
+		{"wrong suffix", "events.json", ErrInvalidDeadLetterName},
+		{"missing file", "missing.ndjson", ErrDeadLetterNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := d.Redrive(context.Background(), tt.file, 10, write); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
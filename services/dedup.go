@@ -0,0 +1,98 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DedupWindow remembers recently seen event IDs so retried events can be
+// dropped at ingest. It holds at most size IDs, each for at most ttl; the
+// oldest are forgotten first. It is safe for concurrent use; a nil window
+// remembers nothing.
+type DedupWindow struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	seen  map[string]*list.Element
+	order *list.List // of *dedupEntry, oldest first
+}
+
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// NewDedupWindow creates a window of size IDs kept for ttl; a ttl of zero
+// keeps IDs until the window is full
+func NewDedupWindow(size int, ttl time.Duration) *DedupWindow {
+	return &DedupWindow{
+		size:  max(size, 1),
+		ttl:   ttl,
+		seen:  make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Add records id and reports whether it is new, i.e. not already in the window
+func (w *DedupWindow) Add(id string) bool {
+	if w == nil {
+		return true
+	}
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.expire(now)
+	if _, ok := w.seen[id]; ok {
+		return false
+	}
+	for w.order.Len() >= w.size {
+		w.evict(w.order.Front())
+	}
+	w.seen[id] = w.order.PushBack(&dedupEntry{id: id, seen: now})
+	return true
+}
+
+// Remove forgets id, so an event that was not accepted after all can be sent
+// again
+func (w *DedupWindow) Remove(id string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if elem, ok := w.seen[id]; ok {
+		w.evict(elem)
+	}
+}
+
+// Len returns the number of IDs in the window
+func (w *DedupWindow) Len() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.order.Len()
+}
+
+// expire forgets IDs older than the ttl
+func (w *DedupWindow) expire(now time.Time) {
+	if w.ttl <= 0 {
+		return
+	}
+	for elem := w.order.Front(); elem != nil; elem = w.order.Front() {
+		if now.Sub(elem.Value.(*dedupEntry).seen) < w.ttl {
+			return
+		}
+		w.evict(elem)
+	}
+}
+
+func (w *DedupWindow) evict(elem *list.Element) {
+	delete(w.seen, elem.Value.(*dedupEntry).id)
+	w.order.Remove(elem)
+}
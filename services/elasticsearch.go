@@ -0,0 +1,306 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// ESFieldMapping lists, for each event column, the document fields to read
+// it from in order of preference. Dotted paths match both nested objects
+// ({"log":{"level":"info"}}) and flattened keys ({"log.level":"info"}).
+type ESFieldMapping map[string][]string
+
+// esColumns are the event columns a mapping can fill
+var esColumns = []string{"timestamp", "service", "env", "job_id", "request_id", "trace_id", "span_id", "parent_span_id", "user_id", "name", "level"}
+
+// esTimestampLayouts are the date formats accepted for the timestamp field
+// in addition to epoch milliseconds
+var esTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// DefaultESFieldMapping returns the mapping used unless configured otherwise,
+// based on Elastic Common Schema field names
+func DefaultESFieldMapping() ESFieldMapping {
+	return ESFieldMapping{
+		"timestamp":      {"@timestamp", "timestamp"},
+		"service":        {"service.name", "service", "fields.service", "app"},
+		"env":            {"service.environment", "environment", "env", "fields.env"},
+		"job_id":         {"job_id"},
+		"request_id":     {"http.request.id", "request_id"},
+		"trace_id":       {"trace.id", "trace_id"},
+		"span_id":        {"span.id", "span_id"},
+		"parent_span_id": {"parent.id", "parent_span_id"},
+		"user_id":        {"user.id", "user_id"},
+		"name":           {"event.action", "event.name", "name"},
+		"level":          {"log.level", "level", "severity"},
+	}
+}
+
+// ParseESFieldMapping overrides the default mapping with a spec such as
+// "service=kubernetes.labels.app|service.name,level=log.level"
+func ParseESFieldMapping(spec string) (ESFieldMapping, error) {
+	mapping := DefaultESFieldMapping()
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		column, fields, ok := strings.Cut(entry, "=")
+		column = strings.TrimSpace(column)
+		if !ok || fields == "" {
+			return nil, fmt.Errorf("invalid field mapping %q: expected column=field[|field...]", entry)
+		}
+		if _, known := mapping[column]; !known {
+			return nil, fmt.Errorf("invalid field mapping %q: unknown column %s", entry, column)
+		}
+
+		var paths []string
+		for _, field := range strings.Split(fields, "|") {
+			if field = strings.TrimSpace(field); field != "" {
+				paths = append(paths, field)
+			}
+		}
+		mapping[column] = paths
+	}
+
+	return mapping, nil
+}
+
+// ToEvent maps a bulk document onto an event. Mapped fields are removed from
+// the document; everything left is flattened into Event.Data with nested keys
+// joined by "_". Documents without a service fall back to the index name.
+func (m ESFieldMapping) ToEvent(doc map[string]interface{}, index string) (*structs.Event, error) {
+	values := make(map[string]interface{}, len(esColumns))
+	for _, column := range esColumns {
+		for _, path := range m[column] {
+			if v, ok := takeDocField(doc, path); ok {
+				values[column] = v
+				break
+			}
+		}
+	}
+
+	event := &structs.Event{
+		Service:      esString(values["service"]),
+		Env:          esString(values["env"]),
+		JobID:        esString(values["job_id"]),
+		RequestID:    esString(values["request_id"]),
+		TraceID:      esString(values["trace_id"]),
+		SpanID:       esString(values["span_id"]),
+		ParentSpanID: esString(values["parent_span_id"]),
+		UserID:       esString(values["user_id"]),
+		Name:         esString(values["name"]),
+		Level:        strings.ToLower(esString(values["level"])),
+		Data:         make(map[string]interface{}, len(doc)),
+	}
+
+	if ts, ok := values["timestamp"]; ok {
+		t, err := parseESTimestamp(ts)
+		if err != nil {
+			return nil, err
+		}
+		event.Timestamp = t
+	} else {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Service == "" {
+		event.Service = index
+	}
+	if event.Service == "" {
+		event.Service = otelUnknownService
+	}
+	if event.Name == "" {
+		event.Name = "log"
+	}
+
+	flattenDocument(event.Data, "", doc)
+
+	return event, nil
+}
+
+// takeDocField finds a scalar at path and removes it from doc
+func takeDocField(doc map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := doc[path]; ok {
+		if !isScalar(v) {
+			return nil, false
+		}
+		delete(doc, path)
+		return v, true
+	}
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := doc[path[:i]].(map[string]interface{}); ok {
+			if v, ok := takeDocField(nested, path[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, json.Number, float64, int64, uint64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+func esString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseESTimestamp accepts ISO 8601 dates and epoch milliseconds, the
+// formats Elasticsearch accepts for date fields by default
+func parseESTimestamp(v interface{}) (time.Time, error) {
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = v.String()
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = v
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %v", v)
+	}
+
+	if millis, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.UnixMilli(int64(millis)).UTC(), nil
+	}
+	for _, layout := range esTimestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// flattenDocument copies doc into data, joining nested object keys with "_"
+// so every value can be filtered on as a top-level data key
+func flattenDocument(data map[string]interface{}, prefix string, doc map[string]interface{}) {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if nested, ok := doc[k].(map[string]interface{}); ok {
+			flattenDocument(data, prefix+k+"_", nested)
+			continue
+		}
+		data[dataKey(prefix+k)] = doc[k]
+	}
+}
+
+// ESBulkAction is one action parsed from a _bulk request body
+type ESBulkAction struct {
+	Action string // index, create, update or delete
+	Index  string
+	ID     string
+	Doc    map[string]interface{}
+	Err    error // set when the document could not be parsed
+}
+
+type esActionMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// ParseESBulk parses a _bulk body of action lines, each followed by a
+// document line for index, create and update actions. A malformed action
+// line fails the whole request; a malformed document only fails its action.
+func ParseESBulk(r io.Reader, defaultIndex string) ([]ESBulkAction, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNum := 0
+	next := func() ([]byte, bool) {
+		for scanner.Scan() {
+			lineNum++
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				return line, true
+			}
+		}
+		return nil, false
+	}
+
+	var actions []ESBulkAction
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+
+		var meta map[string]esActionMeta
+		if err := json.Unmarshal(line, &meta); err != nil || len(meta) != 1 {
+			return nil, fmt.Errorf("malformed action/metadata line [%d], expected a single action object", lineNum)
+		}
+
+		var action ESBulkAction
+		for name, m := range meta {
+			action = ESBulkAction{Action: name, Index: m.Index, ID: m.ID}
+		}
+		if action.Index == "" {
+			action.Index = defaultIndex
+		}
+
+		switch action.Action {
+		case "index", "create", "update":
+			source, ok := next()
+			if !ok {
+				return nil, fmt.Errorf("action on line [%d] is missing its document", lineNum)
+			}
+			if action.Action == "update" {
+				break
+			}
+
+			decoder := json.NewDecoder(bytes.NewReader(source))
+			decoder.UseNumber()
+			if err := decoder.Decode(&action.Doc); err != nil {
+				action.Err = fmt.Errorf("failed to parse document on line [%d]: %w", lineNum, err)
+			} else if action.Doc == nil {
+				action.Err = fmt.Errorf("document on line [%d] must be an object", lineNum)
+			}
+		case "delete":
+		default:
+			return nil, fmt.Errorf("malformed action/metadata line [%d], unknown action [%s]", lineNum, action.Action)
+		}
+
+		actions = append(actions, action)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: error reading body: %w", lineNum+1, err)
+	}
+
+	return actions, nil
+}
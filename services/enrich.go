@@ -0,0 +1,196 @@
+package services
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// RequestInfo is what enrichers know about the request events arrived in
+type RequestInfo struct {
+	ClientIP  string
+	UserAgent string
+}
+
+// Enricher derives data fields from the request events arrived in
+type Enricher interface {
+	Enrich(req *RequestInfo, fields map[string]interface{})
+}
+
+// EnrichmentPipeline runs enrichers in order to build the fields added to
+// every event of a request. A nil pipeline adds nothing.
+type EnrichmentPipeline struct {
+	enrichers []Enricher
+}
+
+// NewEnrichmentPipeline creates a pipeline from enrichers
+func NewEnrichmentPipeline(enrichers ...Enricher) *EnrichmentPipeline {
+	return &EnrichmentPipeline{enrichers: enrichers}
+}
+
+// Add appends an enricher to the pipeline
+func (p *EnrichmentPipeline) Add(e Enricher) {
+	p.enrichers = append(p.enrichers, e)
+}
+
+// Len returns the number of enrichers
+func (p *EnrichmentPipeline) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.enrichers)
+}
+
+// Fields returns the fields to add to the events of a request, or nil if the
+// enrichers found nothing
+func (p *EnrichmentPipeline) Fields(req *RequestInfo) map[string]interface{} {
+	if p.Len() == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	for _, e := range p.enrichers {
+		e.Enrich(req, fields)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// ApplyEnrichment adds fields to an event's data, keeping any key the
+// producer already set
+func ApplyEnrichment(event *structs.Event, fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	if event.Data == nil {
+		event.Data = make(map[string]interface{}, len(fields))
+	}
+	for k, v := range fields {
+		if _, ok := event.Data[k]; !ok {
+			event.Data[k] = v
+		}
+	}
+}
+
+// ClientIPEnricher adds the client's IP address as data.client_ip
+type ClientIPEnricher struct{}
+
+// Enrich implements Enricher
+func (ClientIPEnricher) Enrich(req *RequestInfo, fields map[string]interface{}) {
+	if req.ClientIP != "" {
+		fields["client_ip"] = req.ClientIP
+	}
+}
+
+// UserAgentEnricher adds the browser, OS and device type parsed from the
+// User-Agent header as data.ua_* fields
+type UserAgentEnricher struct{}
+
+// Enrich implements Enricher
+func (UserAgentEnricher) Enrich(req *RequestInfo, fields map[string]interface{}) {
+	if req.UserAgent == "" {
+		return
+	}
+	ua := ParseUserAgent(req.UserAgent)
+	setField(fields, "ua_browser", ua.Browser)
+	setField(fields, "ua_browser_version", ua.BrowserVersion)
+	setField(fields, "ua_os", ua.OS)
+	setField(fields, "ua_os_version", ua.OSVersion)
+	setField(fields, "ua_device", ua.Device)
+}
+
+// GeoIPEnricher adds the country, region, city and autonomous system of the
+// client's IP address as data.geo_* fields, looked up in MaxMind DB files
+type GeoIPEnricher struct {
+	dbs []*maxminddb.Reader
+}
+
+// mmdbRecord holds the fields read from GeoIP2 and GeoLite2 City, Country
+// and ASN databases
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint64 `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// NewGeoIPEnricher opens MaxMind DB files such as GeoLite2-City.mmdb and
+// GeoLite2-ASN.mmdb; each address is looked up in all of them
+func NewGeoIPEnricher(paths ...string) (*GeoIPEnricher, error) {
+	g := &GeoIPEnricher{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		db, err := maxminddb.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		g.dbs = append(g.dbs, db)
+	}
+	return g, nil
+}
+
+// Lookup returns what the databases know about addr
+func (g *GeoIPEnricher) Lookup(addr netip.Addr) *structs.GeoIPRecord {
+	result := &structs.GeoIPRecord{}
+	for _, db := range g.dbs {
+		var record mmdbRecord
+		if err := db.Lookup(addr.AsSlice(), &record); err != nil {
+			continue
+		}
+
+		if result.Country == "" {
+			result.Country = record.Country.ISOCode
+		}
+		if result.Region == "" && len(record.Subdivisions) > 0 {
+			result.Region = record.Subdivisions[0].ISOCode
+		}
+		if result.City == "" {
+			result.City = record.City.Names["en"]
+		}
+		if result.ASN == 0 {
+			result.ASN = record.ASN
+		}
+		if result.ASOrg == "" {
+			result.ASOrg = record.ASOrg
+		}
+	}
+	return result
+}
+
+// Enrich implements Enricher
+func (g *GeoIPEnricher) Enrich(req *RequestInfo, fields map[string]interface{}) {
+	addr, err := netip.ParseAddr(req.ClientIP)
+	if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return
+	}
+
+	record := g.Lookup(addr)
+	setField(fields, "geo_country", record.Country)
+	setField(fields, "geo_region", record.Region)
+	setField(fields, "geo_city", record.City)
+	if record.ASN != 0 {
+		fields["geo_asn"] = record.ASN
+	}
+	setField(fields, "geo_as_org", record.ASOrg)
+}
+
+// setField sets a non-empty string field
+func setField(fields map[string]interface{}, key, value string) {
+	if value != "" {
+		fields[key] = value
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// mmdbEncode encodes strings, uint32s, slices and maps of them, each shorter
+// than 285, as MaxMind DB data
+func mmdbEncode(v interface{}) []byte {
+	control := func(typ, size int) []byte {
+		var b []byte
+		if typ <= 7 {
+			b = []byte{byte(typ << 5)}
+		} else {
+			b = []byte{0, byte(typ - 7)}
+		}
+		if size < 29 {
+			b[0] |= byte(size)
+			return b
+		}
+		b[0] |= 29
+		return append(b, byte(size-29))
+	}
+
+	switch v := v.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case uint32:
+		return append(control(6, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case []interface{}:
+		b := control(11, len(v))
+		for _, item := range v {
+			b = append(b, mmdbEncode(item)...)
+		}
+		return b
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := control(7, len(v))
+		for _, k := range keys {
+			b = append(b, mmdbEncode(k)...)
+			b = append(b, mmdbEncode(v[k])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// writeMMDB writes an IPv4 database with 24-bit records and a single node,
+// whose left record (0.0.0.0/1) points at record and whose right record
+// (128.0.0.0/1) has no data
+func writeMMDB(t *testing.T, record map[string]interface{}) string {
+	const nodeCount, separator = 1, 16
+	left := nodeCount + separator
+	b := []byte{byte(left >> 16), byte(left >> 8), byte(left), 0, 0, nodeCount}
+	b = append(b, make([]byte, separator)...)
+	b = append(b, mmdbEncode(record)...)
+	b = append(b, "\xab\xcd\xefMaxMind.com"...)
+	b = append(b, mmdbEncode(map[string]interface{}{
+		"node_count":  uint32(nodeCount),
+		"record_size": uint32(24),
+		"ip_version":  uint32(4),
+	})...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGeoIPEnricherLookup(t *testing.T) {
+	city := writeMMDB(t, map[string]interface{}{
+		"country":      map[string]interface{}{"iso_code": "US"},
+		"subdivisions": []interface{}{map[string]interface{}{"iso_code": "CA"}},
+		"city":         map[string]interface{}{"names": map[string]interface{}{"en": "San Francisco", "de": "San Francisco"}},
+	})
+	asn := writeMMDB(t, map[string]interface{}{
+		"autonomous_system_number":       uint32(13335),
+		"autonomous_system_organization": "Cloudflare",
+	})
+	g, err := NewGeoIPEnricher(city, " "+asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		addr string
+		want structs.GeoIPRecord
+	}{
+		{"in both databases", "1.2.3.4", structs.GeoIPRecord{Country: "US", Region: "CA", City: "San Francisco", ASN: 13335, ASOrg: "Cloudflare"}},
+		{"ipv4 mapped address", "::ffff:1.2.3.4", structs.GeoIPRecord{Country: "US", Region: "CA", City: "San Francisco", ASN: 13335, ASOrg: "Cloudflare"}},
+		{"outside every network", "200.0.0.1", structs.GeoIPRecord{}},
+		{"ipv6 in ipv4 databases", "2001:db8::1", structs.GeoIPRecord{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.Lookup(netip.MustParseAddr(tt.addr)); !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewGeoIPEnricherInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	if err := os.WriteFile(path, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{path, filepath.Join(t.TempDir(), "missing.mmdb")} {
+		if _, err := NewGeoIPEnricher(p); err == nil {
+			t.Fatalf("%s: expected an error", p)
+		}
+	}
+}
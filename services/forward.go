@@ -0,0 +1,535 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// forwardMaxChunkSize limits the encoded size of a single Forward
+	// message, and the decompressed size of a CompressedPackedForward chunk
+	forwardMaxChunkSize   = 32 * 1024 * 1024
+	forwardEventTimeExt   = 0 // msgpack extension type of an EventTime
+	forwardWriteTimeout   = 10 * time.Second
+	forwardHandshakeLimit = 10 * time.Second
+)
+
+// ParseForwardMessage decodes a Forward protocol message in any of its modes:
+//
+//	Message:                 [tag, time, record, option?]
+//	Forward:                 [tag, [[time, record], ...], option?]
+//	PackedForward:           [tag, msgpack stream of [time, record], option?]
+//	CompressedPackedForward: PackedForward with option.compressed = "gzip"
+//
+// Entries with an invalid time or a record that is not a map are skipped, as
+// Fluentd does, and their count returned; only a malformed message is an error.
+func ParseForwardMessage(v interface{}) (*structs.ForwardMessage, int, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) < 2 || len(arr) > 4 {
+		return nil, 0, errors.New("expected an array of tag, entries and option")
+	}
+
+	tag, ok := forwardString(arr[0])
+	if !ok {
+		return nil, 0, errors.New("tag must be a string")
+	}
+	msg := &structs.ForwardMessage{Tag: tag}
+
+	// Message mode carries a time where the other modes carry entries
+	_, packed := forwardString(arr[1])
+	_, forward := arr[1].([]interface{})
+	optionIndex := 2
+	if !packed && !forward {
+		if len(arr) < 3 {
+			return nil, 0, errors.New("message mode requires a time and a record")
+		}
+		optionIndex = 3
+	}
+	if optionIndex < len(arr) {
+		option, err := parseForwardOption(arr[optionIndex])
+		if err != nil {
+			return nil, 0, err
+		}
+		msg.Option = option
+	}
+
+	invalid := 0
+	addEntry := func(t, record interface{}) {
+		entry, ok := parseForwardEntry(t, record)
+		if !ok {
+			invalid++
+			return
+		}
+		msg.Entries = append(msg.Entries, entry)
+	}
+
+	switch entries := arr[1].(type) {
+	case []interface{}:
+		for _, e := range entries {
+			pair, ok := e.([]interface{})
+			if !ok || len(pair) < 2 {
+				invalid++
+				continue
+			}
+			addEntry(pair[0], pair[1])
+		}
+
+	case []byte, string:
+		packed, _ := forwardString(entries)
+		data := []byte(packed)
+
+		switch msg.Option.Compressed {
+		case "", "text":
+		case "gzip":
+			var err error
+			if data, err = gunzipForward(data); err != nil {
+				return nil, 0, err
+			}
+		default:
+			return nil, 0, fmt.Errorf("unsupported compression %q", msg.Option.Compressed)
+		}
+
+		decoder := NewMsgpackDecoder(bytes.NewReader(data), forwardMaxChunkSize)
+		for {
+			e, err := decoder.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid packed entries: %w", err)
+			}
+			pair, ok := e.([]interface{})
+			if !ok || len(pair) < 2 {
+				invalid++
+				continue
+			}
+			addEntry(pair[0], pair[1])
+		}
+
+	default:
+		addEntry(arr[1], arr[2])
+	}
+
+	return msg, invalid, nil
+}
+
+func parseForwardOption(v interface{}) (structs.ForwardOption, error) {
+	var option structs.ForwardOption
+	if v == nil {
+		return option, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return option, errors.New("option must be a map")
+	}
+	if size, ok := m["size"].(int64); ok {
+		option.Size = int(size)
+	}
+	option.Chunk, _ = forwardString(m["chunk"])
+	option.Compressed, _ = forwardString(m["compressed"])
+	return option, nil
+}
+
+func parseForwardEntry(t, record interface{}) (structs.ForwardEntry, bool) {
+	ts, ok := forwardTime(t)
+	if !ok {
+		return structs.ForwardEntry{}, false
+	}
+	m, ok := record.(map[string]interface{})
+	if !ok {
+		return structs.ForwardEntry{}, false
+	}
+	return structs.ForwardEntry{Time: ts, Record: normalizeForwardRecord(m)}, true
+}
+
+// forwardTime reads an entry time: integer seconds, float seconds, an
+// EventTime extension (big-endian uint32 seconds and nanoseconds) or a
+// msgpack timestamp
+func forwardTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case int64:
+		return time.Unix(v, 0).UTC(), true
+	case uint64:
+		return time.Unix(int64(v), 0).UTC(), true
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+	case time.Time:
+		return v, true
+	case MsgpackExt:
+		if v.Type != forwardEventTimeExt || len(v.Data) != 8 {
+			return time.Time{}, false
+		}
+		sec := binary.BigEndian.Uint32(v.Data[:4])
+		nsec := binary.BigEndian.Uint32(v.Data[4:])
+		return time.Unix(int64(sec), int64(nsec)).UTC(), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// normalizeForwardRecord converts values msgpack has no JSON equivalent for:
+// binary strings (common from older Fluentd versions) become strings and
+// EventTime values become RFC 3339 timestamps
+func normalizeForwardRecord(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		m[k] = normalizeForwardValue(v)
+	}
+	return m
+}
+
+func normalizeForwardValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return v
+	case time.Time, MsgpackExt:
+		if t, ok := forwardTime(v); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+		return nil
+	case map[string]interface{}:
+		return normalizeForwardRecord(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeForwardValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func forwardString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	default:
+		return "", false
+	}
+}
+
+// gunzipForward decompresses a CompressedPackedForward chunk, which may be
+// several concatenated gzip members
+func gunzipForward(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip entries: %w", err)
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(zr, forwardMaxChunkSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip entries: %w", err)
+	}
+	if len(out) > forwardMaxChunkSize {
+		return nil, fmt.Errorf("decompressed entries exceed the %d byte limit", forwardMaxChunkSize)
+	}
+	return out, nil
+}
+
+// ForwardToEvent maps a Forward record onto an event with the same field
+// mapping as Elasticsearch bulk documents, since Fluentd and Fluent Bit send
+// the same records to either output. The entry time is always the event
+// timestamp, and the tag stands in for a missing service.
+func ForwardToEvent(mapping ESFieldMapping, tag string, entry structs.ForwardEntry) (*structs.Event, error) {
+	columns := make(ESFieldMapping, len(mapping))
+	for column, paths := range mapping {
+		if column != "timestamp" {
+			columns[column] = paths
+		}
+	}
+
+	event, err := columns.ToEvent(entry.Record, tag)
+	if err != nil {
+		return nil, err
+	}
+	event.Timestamp = entry.Time
+	if _, ok := event.Data["tag"]; !ok {
+		event.Data["tag"] = tag
+	}
+
+	return event, nil
+}
+
+// ForwardServer receives Fluentd Forward protocol messages over TCP and
+// enqueues their records as events
+type ForwardServer struct {
+	queue     *Queue
+	schemas   *SchemaRegistry
+	mapping   ESFieldMapping
+	sharedKey string
+	hostname  string
+	mu        sync.Mutex
+	closed    bool
+	ctx       context.Context // cancelled by Close
+	cancel    context.CancelFunc
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// NewForwardServer creates a Forward server that maps records with mapping
+// and enqueues them onto queue
+func NewForwardServer(queue *Queue, mapping ESFieldMapping) *ForwardServer {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "monitor-core"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ForwardServer{
+		queue:    queue,
+		mapping:  mapping,
+		hostname: hostname,
+		ctx:      ctx,
+		cancel:   cancel,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// SetSharedKey requires clients to complete the Forward protocol handshake
+// with key before sending messages. An empty key disables the handshake.
+func (s *ForwardServer) SetSharedKey(key string) {
+	s.sharedKey = key
+}
+
+// SetSchemas configures the event schemas records are checked against
+func (s *ForwardServer) SetSchemas(schemas *SchemaRegistry) {
+	s.schemas = schemas
+}
+
+// ListenTCP starts accepting Forward connections on addr
+func (s *ForwardServer) ListenTCP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveTCP(listener)
+	}()
+	return nil
+}
+
+// Close stops the listeners and open connections, and waits until every
+// message already received has been enqueued
+func (s *ForwardServer) Close() {
+	s.cancel()
+	s.mu.Lock()
+	s.closed = true
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *ForwardServer) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("forward tcp accept error: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *ForwardServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, 64*1024)
+	decoder := NewMsgpackDecoder(r, forwardMaxChunkSize)
+
+	if s.sharedKey != "" {
+		if err := s.handshake(conn, decoder); err != nil {
+			log.Printf("forward handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	for {
+		v, err := decoder.Decode()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("forward connection from %s closed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		msg, invalid, err := ParseForwardMessage(v)
+		if err != nil {
+			log.Printf("invalid forward message from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if invalid > 0 {
+			log.Printf("skipped %d invalid forward entries from %s with tag %s", invalid, conn.RemoteAddr(), msg.Tag)
+		}
+
+		s.queue.Wait(s.ctx)
+		complete := s.handle(msg, conn.RemoteAddr())
+
+		// Events must be durable before a chunk is acked
+		if msg.Option.Chunk != "" || r.Buffered() == 0 {
+			if err := s.queue.Sync(); err != nil {
+				log.Printf("failed to sync wal: %v", err)
+				complete = false
+			}
+		}
+
+		// Without an ack the sender retries the whole chunk
+		if msg.Option.Chunk != "" && complete {
+			if err := s.write(conn, map[string]interface{}{"ack": msg.Option.Chunk}); err != nil {
+				log.Printf("failed to ack forward chunk from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+// handle enqueues a message's valid records all or nothing, reporting false
+// if the queue could not take them, so the sender retries a chunk without
+// any of its records being queued twice
+func (s *ForwardServer) handle(msg *structs.ForwardMessage, addr net.Addr) bool {
+	events := make([]*structs.Event, 0, len(msg.Entries))
+	for _, entry := range msg.Entries {
+		event, err := ForwardToEvent(s.mapping, msg.Tag, entry)
+		if err == nil {
+			err = PrepareEvent(event, nil, s.schemas, nil)
+		}
+		if err != nil {
+			log.Printf("invalid forward record from %s with tag %s: %v", addr, msg.Tag, err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if !s.queue.EnqueueAll(events) {
+		log.Printf("dropped %d forward records from %s: event queue is full", len(events), addr)
+		return false
+	}
+	return true
+}
+
+// handshake authenticates a client with the shared key: the server sends
+// HELO with a nonce, the client answers PING with a digest of the key, and
+// the server replies PONG with its own digest so the client can verify it
+func (s *ForwardServer) handshake(conn net.Conn, decoder *MsgpackDecoder) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	helo := []interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      []byte{},
+		"keepalive": true,
+	}}
+	if err := s.write(conn, helo); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(forwardHandshakeLimit))
+	v, err := decoder.Decode()
+	if err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	ping, ok := v.([]interface{})
+	if !ok || len(ping) < 4 {
+		return errors.New("expected PING")
+	}
+	if kind, _ := forwardString(ping[0]); kind != "PING" {
+		return errors.New("expected PING")
+	}
+	hostname, _ := forwardString(ping[1])
+	salt, _ := forwardString(ping[2])
+	digest, _ := forwardString(ping[3])
+
+	expected := forwardDigest(salt, hostname, nonce, s.sharedKey)
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(expected)) != 1 {
+		s.write(conn, []interface{}{"PONG", false, "shared_key mismatch", s.hostname, ""})
+		return fmt.Errorf("shared_key mismatch from %s", hostname)
+	}
+
+	return s.write(conn, []interface{}{"PONG", true, "", s.hostname, forwardDigest(salt, s.hostname, nonce, s.sharedKey)})
+}
+
+func forwardDigest(salt, hostname string, nonce []byte, sharedKey string) string {
+	h := sha512.New()
+	h.Write([]byte(salt))
+	h.Write([]byte(hostname))
+	h.Write(nonce)
+	h.Write([]byte(sharedKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *ForwardServer) write(conn net.Conn, v interface{}) error {
+	b, err := msgpack.Marshal(v)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(forwardWriteTimeout))
+	_, err = conn.Write(b)
+	return err
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestForwardHandleQueueFull(t *testing.T) {
+	msg := &structs.ForwardMessage{Tag: "app"}
+	for i := 0; i < 3; i++ {
+		msg.Entries = append(msg.Entries, structs.ForwardEntry{
+			Time:   time.Unix(1700000000, 0),
+			Record: map[string]interface{}{"message": "hi"},
+		})
+	}
+
+	tests := []struct {
+		name        string
+		queueSize   int
+		wantOK      bool
+		wantPending int
+	}{
+		{"chunk fits", 3, true, 3},
+		{"chunk too large", 2, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := NewQueue(tt.queueSize)
+			s := NewForwardServer(queue, DefaultESFieldMapping())
+			if ok := s.handle(msg, &net.TCPAddr{}); ok != tt.wantOK {
+				t.Fatalf("handle = %v, want %v", ok, tt.wantOK)
+			}
+			if _, _, pending := queue.Stats(); pending != tt.wantPending {
+				t.Fatalf("pending = %d, want %d", pending, tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	monitorv1 "github.com/aidenappl/monitor-core/proto/monitor/v1"
+	"github.com/aidenappl/monitor-core/structs"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcMaxDepth limits how deeply google.protobuf.Struct values may nest
+const grpcMaxDepth = 100
+
+var errGRPCTooDeep = errors.New("data nests too deeply")
+
+// DecodeIngestRequest decodes a monitor.v1.IngestRequest into events
+func DecodeIngestRequest(b []byte) ([]*structs.Event, error) {
+	var req monitorv1.IngestRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+	return IngestRequestToEvents(&req)
+}
+
+// IngestRequestToEvents maps the events of an IngestRequest onto events,
+// failing if any carries data nested deeper than grpcMaxDepth
+func IngestRequestToEvents(req *monitorv1.IngestRequest) ([]*structs.Event, error) {
+	events := make([]*structs.Event, 0, len(req.GetEvents()))
+	for _, e := range req.GetEvents() {
+		event := &structs.Event{
+			Service:      e.GetService(),
+			Env:          e.GetEnv(),
+			JobID:        e.GetJobId(),
+			RequestID:    e.GetRequestId(),
+			TraceID:      e.GetTraceId(),
+			UserID:       e.GetUserId(),
+			Name:         e.GetName(),
+			Level:        e.GetLevel(),
+			EventID:      e.GetEventId(),
+			Severity:     uint8(min(e.GetSeverity(), 255)),
+			SpanID:       e.GetSpanId(),
+			ParentSpanID: e.GetParentSpanId(),
+		}
+		if e.GetTimestamp() != nil {
+			event.Timestamp = time.Unix(e.GetTimestamp().GetSeconds(), int64(e.GetTimestamp().GetNanos())).UTC()
+		}
+		if e.GetData() != nil {
+			if structDepth(e.GetData(), 0) > grpcMaxDepth {
+				return nil, errGRPCTooDeep
+			}
+			event.Data = e.GetData().AsMap()
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// structDepth returns how deeply s nests, stopping once it passes grpcMaxDepth
+func structDepth(s *structpb.Struct, depth int) int {
+	deepest := depth + 1
+	for _, v := range s.GetFields() {
+		if deepest > grpcMaxDepth {
+			break
+		}
+		deepest = max(deepest, valueDepth(v, depth+1))
+	}
+	return deepest
+}
+
+func valueDepth(v *structpb.Value, depth int) int {
+	switch kind := v.GetKind().(type) {
+	case *structpb.Value_StructValue:
+		return structDepth(kind.StructValue, depth)
+	case *structpb.Value_ListValue:
+		deepest := depth + 1
+		for _, item := range kind.ListValue.GetValues() {
+			if deepest > grpcMaxDepth {
+				break
+			}
+			deepest = max(deepest, valueDepth(item, depth+1))
+		}
+		return deepest
+	default:
+		return depth
+	}
+}
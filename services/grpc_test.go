@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	monitorv1 "github.com/aidenappl/monitor-core/proto/monitor/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// nestedGRPCData returns a Struct nesting levels structs under "root"
+func nestedGRPCData(levels int) *structpb.Struct {
+	value := structpb.NewStringValue("x")
+	for i := 0; i < levels; i++ {
+		value = structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"k": value}})
+	}
+	return &structpb.Struct{Fields: map[string]*structpb.Value{"root": value}}
+}
+
+func TestDecodeIngestRequest(t *testing.T) {
+	data, err := structpb.NewStruct(map[string]interface{}{"status": 200, "tags": []interface{}{"a", true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := proto.Marshal(&monitorv1.IngestRequest{Events: []*monitorv1.Event{{
+		Timestamp: &timestamppb.Timestamp{Seconds: 1700000000, Nanos: 500},
+		Service:   "api",
+		Name:      "request",
+		Data:      data,
+		Severity:  1000,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := DecodeIngestRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	e := events[0]
+	if !e.Timestamp.Equal(time.Unix(1700000000, 500)) || e.Service != "api" || e.Name != "request" || e.Severity != 255 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	want := map[string]interface{}{"status": 200.0, "tags": []interface{}{"a", true}}
+	if !reflect.DeepEqual(e.Data, want) {
+		t.Fatalf("data = %#v, want %#v", e.Data, want)
+	}
+}
+
+func TestDecodeIngestRequestMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"truncated request", []byte{0x0a, 0x05, 0x12}},
+		{"truncated event field", []byte{0x0a, 0x03, 0x12, 0x05, 'a'}},
+		{"invalid wire type in event", []byte{0x0a, 0x02, 0x17, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeIngestRequest(tt.body); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestIngestRequestToEventsDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		levels  int
+		wantErr error
+	}{
+		{"within the limit", grpcMaxDepth - 1, nil},
+		{"nested too deeply", grpcMaxDepth, errGRPCTooDeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &monitorv1.IngestRequest{Events: []*monitorv1.Event{{Data: nestedGRPCData(tt.levels)}}}
+			if _, err := IngestRequestToEvents(req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// IdempotentResponse is the response recorded for an Idempotency-Key
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+// IdempotencyCache records the responses to requests sent with an
+// Idempotency-Key, so a retried request is answered without being processed
+// again. It holds at most size keys, each for at most ttl; the oldest are
+// forgotten first. It is safe for concurrent use.
+type IdempotencyCache struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	keys     map[string]*list.Element
+	order    *list.List // of *idempotencyEntry, oldest first
+	replayed int64
+}
+
+type idempotencyEntry struct {
+	key      string
+	created  time.Time
+	response *IdempotentResponse // nil while the first request is in flight
+}
+
+// NewIdempotencyCache creates a cache of size keys kept for ttl
+func NewIdempotencyCache(size int, ttl time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{
+		size:  max(size, 1),
+		ttl:   ttl,
+		keys:  make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Begin claims key for a new request. If the key has been seen, it returns
+// the recorded response, or inFlight if the first request has not finished.
+func (c *IdempotencyCache) Begin(key string) (response *IdempotentResponse, inFlight bool) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	if elem, ok := c.keys[key]; ok {
+		entry := elem.Value.(*idempotencyEntry)
+		if entry.response == nil {
+			return nil, true
+		}
+		c.replayed++
+		return entry.response, false
+	}
+	for c.order.Len() >= c.size {
+		c.evict(c.order.Front())
+	}
+	c.keys[key] = c.order.PushBack(&idempotencyEntry{key: key, created: now})
+	return nil, false
+}
+
+// Complete records the response to the request that claimed key
+func (c *IdempotencyCache) Complete(key string, response *IdempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.keys[key]; ok {
+		elem.Value.(*idempotencyEntry).response = response
+	}
+}
+
+// Release forgets key if its request never completed, so it can be retried
+func (c *IdempotencyCache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.keys[key]; ok && elem.Value.(*idempotencyEntry).response == nil {
+		c.evict(elem)
+	}
+}
+
+// Stats returns the number of keys held and of requests answered from the cache
+func (c *IdempotencyCache) Stats() (keys int, replayed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.replayed
+}
+
+// expire forgets keys older than the ttl
+func (c *IdempotencyCache) expire(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if now.Sub(elem.Value.(*idempotencyEntry).created) < c.ttl {
+			return
+		}
+		c.evict(elem)
+	}
+}
+
+func (c *IdempotencyCache) evict(elem *list.Element) {
+	delete(c.keys, elem.Value.(*idempotencyEntry).key)
+	c.order.Remove(elem)
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// PrepareEvent runs the checks every ingest path applies before an event is
+// enqueued: it validates the event, that key may send it and its data against
+// its schema in schemas, returning why the event must be rejected, and adds
+// the enrichment fields to valid events. key, schemas and fields may be nil.
+func PrepareEvent(event *structs.Event, key *structs.APIKey, schemas *SchemaRegistry, fields map[string]interface{}) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+	if !key.Allows(event.Service, event.Env) {
+		return fmt.Errorf("api key may not send events for service %q in env %q", event.Service, event.Env)
+	}
+	// Schemas describe what producers send, so check before enriching
+	if err := schemas.Check(event); err != nil {
+		return err
+	}
+	ApplyEnrichment(event, fields)
+	return nil
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaErrors caps the violations reported for one value
+const maxSchemaErrors = 10
+
+// jsonSchemaAnnotations are keywords that describe a schema without
+// constraining values
+var jsonSchemaAnnotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"format":      true,
+	"deprecated":  true,
+	"readOnly":    true,
+	"writeOnly":   true,
+}
+
+// jsonSchemaTypes are the values of the type keyword
+var jsonSchemaTypes = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"number":  true,
+	"integer": true,
+	"string":  true,
+}
+
+// JSONSchema is a compiled JSON Schema. It supports the validation keywords
+// that apply to event data: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern, allOf,
+// anyOf, oneOf and not. Schemas using any other keyword, such as $ref, are
+// refused rather than partly enforced.
+type JSONSchema struct {
+	never bool // the false schema
+
+	types      []string
+	enum       []interface{}
+	hasConst   bool
+	constValue interface{}
+
+	properties   map[string]*JSONSchema
+	required     []string
+	additional   *JSONSchema
+	items        *JSONSchema
+	minItems     *int
+	maxItems     *int
+	minimum      *float64
+	maximum      *float64
+	exclusiveMin *float64
+	exclusiveMax *float64
+	minLength    *int
+	maxLength    *int
+	pattern      *regexp.Regexp
+	allOf        []*JSONSchema
+	anyOf        []*JSONSchema
+	oneOf        []*JSONSchema
+	not          *JSONSchema
+}
+
+// CompileJSONSchema parses and checks a JSON Schema document
+func CompileJSONSchema(raw []byte) (*JSONSchema, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return compileJSONSchema(v, "#")
+}
+
+func compileJSONSchema(v interface{}, at string) (*JSONSchema, error) {
+	switch v := v.(type) {
+	case bool:
+		return &JSONSchema{never: !v}, nil
+	case map[string]interface{}:
+		s := &JSONSchema{}
+		for key, value := range v {
+			if err := s.compileKeyword(key, value, at); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", at)
+	}
+}
+
+func (s *JSONSchema) compileKeyword(key string, value interface{}, at string) error {
+	at = at + "/" + key
+	var err error
+
+	switch key {
+	case "type":
+		switch t := value.(type) {
+		case string:
+			s.types = []string{t}
+		case []interface{}:
+			for _, item := range t {
+				name, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("%s: must be a string or an array of strings", at)
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return fmt.Errorf("%s: must be a string or an array of strings", at)
+		}
+		for _, t := range s.types {
+			if !jsonSchemaTypes[t] {
+				return fmt.Errorf("%s: unknown type %q", at, t)
+			}
+		}
+	case "enum":
+		values, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an array", at)
+		}
+		s.enum = values
+	case "const":
+		s.hasConst = true
+		s.constValue = value
+	case "properties":
+		props, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an object", at)
+		}
+		s.properties = make(map[string]*JSONSchema, len(props))
+		for name, prop := range props {
+			if s.properties[name], err = compileJSONSchema(prop, at+"/"+name); err != nil {
+				return err
+			}
+		}
+	case "required":
+		names, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an array of strings", at)
+		}
+		for _, item := range names {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be an array of strings", at)
+			}
+			s.required = append(s.required, name)
+		}
+	case "additionalProperties":
+		s.additional, err = compileJSONSchema(value, at)
+	case "items":
+		s.items, err = compileJSONSchema(value, at)
+	case "minItems":
+		s.minItems, err = schemaCount(value, at)
+	case "maxItems":
+		s.maxItems, err = schemaCount(value, at)
+	case "minLength":
+		s.minLength, err = schemaCount(value, at)
+	case "maxLength":
+		s.maxLength, err = schemaCount(value, at)
+	case "minimum":
+		s.minimum, err = schemaNumber(value, at)
+	case "maximum":
+		s.maximum, err = schemaNumber(value, at)
+	case "exclusiveMinimum":
+		s.exclusiveMin, err = schemaNumber(value, at)
+	case "exclusiveMaximum":
+		s.exclusiveMax, err = schemaNumber(value, at)
+	case "pattern":
+		p, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", at)
+		}
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", at, err)
+		}
+	case "allOf":
+		s.allOf, err = schemaList(value, at)
+	case "anyOf":
+		s.anyOf, err = schemaList(value, at)
+	case "oneOf":
+		s.oneOf, err = schemaList(value, at)
+	case "not":
+		s.not, err = compileJSONSchema(value, at)
+	default:
+		if !jsonSchemaAnnotations[key] {
+			return fmt.Errorf("%s: unsupported keyword", at)
+		}
+	}
+	return err
+}
+
+func schemaCount(v interface{}, at string) (*int, error) {
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != math.Trunc(n) {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", at)
+	}
+	i := int(n)
+	return &i, nil
+}
+
+func schemaNumber(v interface{}, at string) (*float64, error) {
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", at)
+	}
+	return &n, nil
+}
+
+func schemaList(v interface{}, at string) ([]*JSONSchema, error) {
+	items, ok := v.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("%s: must be a non-empty array of schemas", at)
+	}
+	schemas := make([]*JSONSchema, len(items))
+	for i, item := range items {
+		var err error
+		if schemas[i], err = compileJSONSchema(item, at+"/"+strconv.Itoa(i)); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// Validate checks v, a value decoded from JSON, and returns up to
+// maxSchemaErrors violations, each prefixed with where it was found under
+// root (e.g. "data.items[2].price")
+func (s *JSONSchema) Validate(v interface{}, root string) []string {
+	var errs []string
+	s.validate(v, root, &errs)
+	return errs
+}
+
+func (s *JSONSchema) validate(v interface{}, path string, errs *[]string) {
+	if len(*errs) >= maxSchemaErrors {
+		return
+	}
+	add := func(format string, args ...interface{}) {
+		if len(*errs) < maxSchemaErrors {
+			*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	if s.never {
+		add("not allowed")
+		return
+	}
+
+	if len(s.types) > 0 && !s.matchesType(v) {
+		add("expected %s, got %s", strings.Join(s.types, " or "), jsonTypeName(v))
+		return
+	}
+	if s.hasConst && !jsonEqual(v, s.constValue) {
+		add("must be %s", jsonString(s.constValue))
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if jsonEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of %s", jsonString(s.enum))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(v, path, errs, add)
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			add("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			add("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, path+"["+strconv.Itoa(i)+"]", errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			add("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			add("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("must match %s", s.pattern)
+		}
+	default:
+		if n, ok := jsonNumber(v); ok {
+			s.validateNumber(n, add)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, errs)
+	}
+	if s.anyOf != nil && countMatches(s.anyOf, v, path) == 0 {
+		add("must match at least one schema in anyOf")
+	}
+	if s.oneOf != nil {
+		if n := countMatches(s.oneOf, v, path); n != 1 {
+			add("must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if s.not != nil && countMatches([]*JSONSchema{s.not}, v, path) == 1 {
+		add("must not match the schema in not")
+	}
+}
+
+func (s *JSONSchema) validateObject(v map[string]interface{}, path string, errs *[]string, add func(string, ...interface{})) {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			add("missing required property %q", name)
+		}
+	}
+
+	// Sorted so the reported violations are stable
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if prop, ok := s.properties[k]; ok {
+			prop.validate(v[k], path+"."+k, errs)
+		} else if s.additional != nil {
+			if s.additional.never {
+				add("unexpected property %q", k)
+			} else {
+				s.additional.validate(v[k], path+"."+k, errs)
+			}
+		}
+	}
+}
+
+func (s *JSONSchema) validateNumber(n float64, add func(string, ...interface{})) {
+	if s.minimum != nil && n < *s.minimum {
+		add("must be >= %v", *s.minimum)
+	}
+	if s.maximum != nil && n > *s.maximum {
+		add("must be <= %v", *s.maximum)
+	}
+	if s.exclusiveMin != nil && n <= *s.exclusiveMin {
+		add("must be > %v", *s.exclusiveMin)
+	}
+	if s.exclusiveMax != nil && n >= *s.exclusiveMax {
+		add("must be < %v", *s.exclusiveMax)
+	}
+}
+
+func (s *JSONSchema) matchesType(v interface{}) bool {
+	actual := jsonTypeName(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// countMatches returns how many of schemas v satisfies
+func countMatches(schemas []*JSONSchema, v interface{}, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		var errs []string
+		sub.validate(v, path, &errs)
+		if len(errs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// jsonTypeName returns the JSON Schema type of a decoded value; whole
+// numbers are integers
+func jsonTypeName(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if n, ok := jsonNumber(v); ok {
+			if n == math.Trunc(n) && !math.IsInf(n, 0) {
+				return "integer"
+			}
+			return "number"
+		}
+		return reflect.TypeOf(v).String()
+	}
+}
+
+// jsonNumber converts any numeric value to float64
+func jsonNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares decoded values, treating numbers of any type as equal
+// if their values are
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := jsonNumber(a); ok {
+		y, ok := jsonNumber(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		m, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(m) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := m[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := b.([]interface{})
+		if !ok || len(a) != len(l) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileJSONSchemaInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"malformed JSON", `{"type": `, "invalid JSON"},
+		{"truncated JSON", `{"properties": {"a": {}}`, "invalid JSON"},
+		{"not a schema", `"string"`, "#: schema must be an object or a boolean"},
+		{"unsupported keyword", `{"$ref": "#/definitions/a"}`, "#/$ref: unsupported keyword"},
+		{"unknown type", `{"type": "float"}`, `#/type: unknown type "float"`},
+		{"type of the wrong kind", `{"type": 1}`, "#/type: must be a string or an array of strings"},
+		{"type list of the wrong kind", `{"type": ["string", 1]}`, "#/type: must be a string or an array of strings"},
+		{"enum not an array", `{"enum": "a"}`, "#/enum: must be an array"},
+		{"properties not an object", `{"properties": []}`, "#/properties: must be an object"},
+		{"nested property", `{"properties": {"a": {"minLength": -1}}}`, "#/properties/a/minLength: must be a non-negative integer"},
+		{"required not strings", `{"required": [1]}`, "#/required: must be an array of strings"},
+		{"fractional count", `{"maxItems": 1.5}`, "#/maxItems: must be a non-negative integer"},
+		{"minimum not a number", `{"minimum": "1"}`, "#/minimum: must be a number"},
+		{"invalid pattern", `{"pattern": "("}`, "#/pattern: invalid pattern"},
+		{"pattern not a string", `{"pattern": 1}`, "#/pattern: must be a string"},
+		{"empty anyOf", `{"anyOf": []}`, "#/anyOf: must be a non-empty array of schemas"},
+		{"invalid oneOf item", `{"oneOf": [{}, 1]}`, "#/oneOf/1: schema must be an object or a boolean"},
+		{"invalid items", `{"items": {"type": "list"}}`, `#/items/type: unknown type "list"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileJSONSchema([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string
+	}{
+		{"true schema", `true`, `{"a": 1}`, nil},
+		{"false schema", `false`, `1`, []string{"data: not allowed"}},
+		{"annotations only", `{"title": "t", "description": "d", "format": "email"}`, `"x"`, nil},
+		{"type", `{"type": "object"}`, `[]`, []string{"data: expected object, got array"}},
+		{"type list", `{"type": ["string", "null"]}`, `null`, nil},
+		{"integer is a number", `{"type": "number"}`, `3`, nil},
+		{"number is not an integer", `{"type": "integer"}`, `3.5`, []string{"data: expected integer, got number"}},
+		{"enum", `{"enum": ["a", 1]}`, `1.0`, nil},
+		{"enum miss", `{"enum": ["a", 1]}`, `"b"`, []string{`data: must be one of ["a",1]`}},
+		{"const object", `{"const": {"a": [1]}}`, `{"a": [1]}`, nil},
+		{"const miss", `{"const": {"a": [1]}}`, `{"a": [2]}`, []string{`data: must be {"a":[1]}`}},
+		{
+			"required and properties",
+			`{"type": "object", "required": ["id", "price"], "properties": {"price": {"type": "number", "minimum": 0}}}`,
+			`{"price": -1}`,
+			[]string{`data: missing required property "id"`, "data.price: must be >= 0"},
+		},
+		{"closed object", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b": 2}`, []string{`data: unexpected property "b"`}},
+		{"additional properties schema", `{"additionalProperties": {"type": "string"}}`, `{"b": 2}`, []string{"data.b: expected string, got integer"}},
+		{
+			"items",
+			`{"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}}`,
+			`["a", 1, "c"]`,
+			[]string{"data: must have at most 2 items", "data[1]: expected string, got integer"},
+		},
+		{"too few items", `{"minItems": 1}`, `[]`, []string{"data: must have at least 1 items"}},
+		{"string length counts runes", `{"minLength": 2, "maxLength": 2}`, `"héé"`, []string{"data: must be at most 2 characters"}},
+		{"pattern", `{"pattern": "^[a-z]+$"}`, `"ABC"`, []string{"data: must match ^[a-z]+$"}},
+		{"exclusive bounds", `{"exclusiveMinimum": 0, "exclusiveMaximum": 10}`, `10`, []string{"data: must be < 10"}},
+		{"maximum", `{"maximum": 5}`, `6`, []string{"data: must be <= 5"}},
+		{"keywords of other types ignored", `{"minLength": 5, "minimum": 3}`, `true`, nil},
+		{"allOf", `{"allOf": [{"minimum": 1}, {"maximum": 2}]}`, `3`, []string{"data: must be <= 2"}},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "null"}]}`, `1`, []string{"data: must match at least one schema in anyOf"}},
+		{"oneOf matches two", `{"oneOf": [{"type": "number"}, {"minimum": 0}]}`, `1`, []string{"data: must match exactly one schema in oneOf, matched 2"}},
+		{"oneOf matches one", `{"oneOf": [{"type": "number"}, {"type": "string"}]}`, `1`, nil},
+		{"not", `{"not": {"type": "null"}}`, `null`, []string{"data: must not match the schema in not"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := CompileJSONSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Validate(value, "data"); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONSchemaValidateErrorLimit(t *testing.T) {
+	schema, err := CompileJSONSchema([]byte(`{"items": {"type": "string"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]interface{}, 50)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	if errs := schema.Validate(values, "data"); len(errs) != maxSchemaErrors {
+		t.Fatalf("got %d errors, want %d", len(errs), maxSchemaErrors)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// FileKeyStore keeps API keys in a local JSON file, for single instances
+// without a shared store. The file holds key hashes, not secrets, but should
+// still only be readable by the service.
+type FileKeyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileKeyStore creates a store backed by the file at path, which is
+// created with the first key
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{path: path}
+}
+
+func (s *FileKeyStore) LoadKeys(ctx context.Context) ([]*structs.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+func (s *FileKeyStore) SaveKey(ctx context.Context, key *structs.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	saved := *key
+	saved.LastUsedAt = nil
+	replaced := false
+	for i, k := range keys {
+		if k.ID == key.ID {
+			saved.LastUsedAt = k.LastUsedAt
+			keys[i] = &saved
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		keys = append(keys, &saved)
+	}
+	return s.write(keys)
+}
+
+func (s *FileKeyStore) TouchKeys(ctx context.Context, used map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if t, ok := used[k.ID]; ok && (k.LastUsedAt == nil || t.After(*k.LastUsedAt)) {
+			k.LastUsedAt = &t
+		}
+	}
+	return s.write(keys)
+}
+
+// read returns the keys in the file, or none if it does not exist yet
+func (s *FileKeyStore) read() ([]*structs.APIKey, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file structs.APIKeyFile
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid api key file: %w", err)
+	}
+	return file.Keys, nil
+}
+
+// write replaces the file atomically, so a crash never leaves it half written
+func (s *FileKeyStore) write(keys []*structs.APIKey) error {
+	b, err := json.MarshalIndent(structs.APIKeyFile{Keys: keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write api key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write api key file: %w", err)
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write api key file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write api key file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write api key file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write api key file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lokipb "github.com/aidenappl/monitor-core/proto/loki"
+	"github.com/aidenappl/monitor-core/structs"
+	"google.golang.org/protobuf/proto"
+)
+
+// Labels checked, in order, for each event column. The first one present
+// is used; the rest are kept in Event.Data like any other label.
+var (
+	lokiServiceLabels = []string{"service_name", "service", "app", "application", "job"}
+	lokiEnvLabels     = []string{"env", "environment", "deployment_environment"}
+	lokiLevelLabels   = []string{"level", "detected_level", "severity", "lvl"}
+)
+
+// lokiTraceIDKey is the label or structured metadata key holding a trace ID
+const lokiTraceIDKey = "trace_id"
+
+// lokiSpanIDKey is the label or structured metadata key holding a span ID
+const lokiSpanIDKey = "span_id"
+
+// LokiPushToEvents maps every entry in req onto an event. Stream labels fill
+// service, env and level; remaining labels, structured metadata and the line
+// itself go into Event.Data.
+func LokiPushToEvents(req *structs.LokiPushRequest) []*structs.Event {
+	var events []*structs.Event
+
+	for _, stream := range req.Streams {
+		labels := make(map[string]string, len(stream.Stream))
+		for k, v := range stream.Stream {
+			labels[k] = v
+		}
+
+		service := takeLokiLabel(labels, lokiServiceLabels)
+		if service == "" {
+			service = otelUnknownService
+		}
+		env := takeLokiLabel(labels, lokiEnvLabels)
+		level := strings.ToLower(takeLokiLabel(labels, lokiLevelLabels))
+
+		for _, entry := range stream.Values {
+			event := &structs.Event{
+				Timestamp: entry.Timestamp,
+				Service:   service,
+				Env:       env,
+				Name:      "log",
+				Level:     level,
+				Data:      make(map[string]interface{}, len(labels)+len(entry.Metadata)+1),
+			}
+			if event.Timestamp.IsZero() {
+				event.Timestamp = time.Now().UTC()
+			}
+
+			for k, v := range labels {
+				event.Data[dataKey(k)] = v
+			}
+			for k, v := range entry.Metadata {
+				event.Data[dataKey(k)] = v
+			}
+			if traceID, ok := event.Data[lokiTraceIDKey].(string); ok {
+				if id := lokiTraceID(traceID); id != "" {
+					event.TraceID = id
+					delete(event.Data, lokiTraceIDKey)
+				}
+			}
+			if spanID, ok := event.Data[lokiSpanIDKey].(string); ok {
+				if id, ok := structs.ParseSpanID(spanID); ok {
+					event.SpanID = id
+					delete(event.Data, lokiSpanIDKey)
+				}
+			}
+			event.Data["message"] = entry.Line
+
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// takeLokiLabel removes and returns the first of names present in labels
+func takeLokiLabel(labels map[string]string, names []string) string {
+	for _, name := range names {
+		if v, ok := labels[name]; ok && v != "" {
+			delete(labels, name)
+			return v
+		}
+	}
+	return ""
+}
+
+// lokiTraceID accepts a trace ID in any form structs.ParseTraceID does
+func lokiTraceID(id string) string {
+	id, _ = structs.ParseTraceID(id)
+	return id
+}
+
+// ParseLokiLabels parses a Prometheus-style label set such as
+// {job="varlogs", level="info"}
+func ParseLokiLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid labels %q", s)
+	}
+	s = s[1 : len(s)-1]
+
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, errors.New("invalid labels: expected name=\"value\"")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " ")
+		if s == "" || s[0] != '"' {
+			return nil, fmt.Errorf("invalid labels: value for %s is not quoted", name)
+		}
+
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("invalid labels: unterminated value for %s", name)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels: value for %s: %w", name, err)
+		}
+
+		labels[name] = value
+		s = s[end+1:]
+	}
+}
+
+// DecodeLokiPush decodes a protobuf (already snappy-decompressed) PushRequest
+func DecodeLokiPush(b []byte) (*structs.LokiPushRequest, error) {
+	var msg lokipb.PushRequest
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return nil, fmt.Errorf("invalid PushRequest: %w", err)
+	}
+
+	req := &structs.LokiPushRequest{}
+	for _, s := range msg.GetStreams() {
+		labels, err := ParseLokiLabels(s.GetLabels())
+		if err != nil {
+			return nil, err
+		}
+		stream := structs.LokiStream{Stream: labels}
+
+		for _, e := range s.GetEntries() {
+			entry := structs.LokiEntry{Line: e.GetLine()}
+			if ts := e.GetTimestamp(); ts.GetSeconds() != 0 || ts.GetNanos() != 0 {
+				entry.Timestamp = time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC()
+			}
+			for _, pair := range e.GetStructuredMetadata() {
+				if entry.Metadata == nil {
+					entry.Metadata = make(map[string]string)
+				}
+				entry.Metadata[pair.GetName()] = pair.GetValue()
+			}
+			stream.Values = append(stream.Values, entry)
+		}
+		req.Streams = append(req.Streams, stream)
+	}
+
+	return req, nil
+}
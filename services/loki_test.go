@@ -0,0 +1,61 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	lokipb "github.com/aidenappl/monitor-core/proto/loki"
+	"github.com/aidenappl/monitor-core/structs"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDecodeLokiPush(t *testing.T) {
+	b, err := proto.Marshal(&lokipb.PushRequest{Streams: []*lokipb.StreamAdapter{{
+		Labels: `{service_name="api", env="prod"}`,
+		Entries: []*lokipb.EntryAdapter{
+			{Timestamp: &timestamppb.Timestamp{Seconds: 1700000000, Nanos: 5}, Line: "one"},
+			{Line: "two", StructuredMetadata: []*lokipb.LabelPairAdapter{{Name: "trace_id", Value: "abc"}}},
+		},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeLokiPush(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &structs.LokiPushRequest{Streams: []structs.LokiStream{{
+		Stream: map[string]string{"service_name": "api", "env": "prod"},
+		Values: []structs.LokiEntry{
+			{Timestamp: time.Unix(1700000000, 5).UTC(), Line: "one"},
+			{Line: "two", Metadata: map[string]string{"trace_id": "abc"}},
+		},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeLokiPushMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"truncated stream", []byte{0x0a, 0x05, 0x0a}},
+		{"invalid labels", func() []byte {
+			b, _ := proto.Marshal(&lokipb.PushRequest{Streams: []*lokipb.StreamAdapter{{Labels: `{service_name=api}`}}})
+			return b
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeLokiPush(tt.body); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aidenappl/monitor-core/db"
+	prompb "github.com/aidenappl/monitor-core/proto/prometheus"
+	"github.com/aidenappl/monitor-core/structs"
+	"google.golang.org/protobuf/proto"
+)
+
+// promNameLabel is the label that carries a Prometheus metric name
+const promNameLabel = "__name__"
+
+func metricsTable() string {
+	return fmt.Sprintf("%s.metrics", db.Database)
+}
+
+// DecodePromWrite decodes a protobuf (already snappy-decompressed) Prometheus
+// remote_write WriteRequest into samples. Non-finite values (including the
+// NaN staleness markers Prometheus sends when a series disappears), native
+// histograms, exemplars and metadata are not stored.
+func DecodePromWrite(b []byte) ([]*structs.Sample, error) {
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return nil, fmt.Errorf("invalid WriteRequest: %w", err)
+	}
+
+	var samples []*structs.Sample
+	for _, series := range req.GetTimeseries() {
+		var name string
+		labels := make(map[string]string, len(series.GetLabels()))
+		for _, label := range series.GetLabels() {
+			if label.GetName() == promNameLabel {
+				name = label.GetValue()
+			} else if label.GetName() != "" {
+				labels[label.GetName()] = label.GetValue()
+			}
+		}
+
+		// Samples of a series share one label map, since it is never modified
+		for _, point := range series.GetSamples() {
+			if math.IsNaN(point.GetValue()) || math.IsInf(point.GetValue(), 0) {
+				continue
+			}
+			samples = append(samples, &structs.Sample{
+				Name:      name,
+				Labels:    labels,
+				Value:     point.GetValue(),
+				Timestamp: time.UnixMilli(point.GetTimestamp()).UTC(),
+			})
+		}
+	}
+
+	return samples, nil
+}
+
+// MetricWriter is the interface for writing metric sample batches
+type MetricWriter interface {
+	WriteMetrics(ctx context.Context, samples []*structs.Sample) error
+}
+
+// MetricBatcher buffers metric samples and flushes them in batches. Unlike
+// the event queue it has no write-ahead log: remote_write senders keep their
+// own and resend requests that are refused.
+type MetricBatcher struct {
+	samples       chan *structs.Sample
+	mu            sync.Mutex
+	closed        bool
+	writer        MetricWriter
+	retry         RetryPolicy
+	batchSize     int
+	flushInterval time.Duration
+	batch         []*structs.Sample
+	enqueued      atomic.Int64
+	rejected      atomic.Int64
+}
+
+// NewMetricBatcher creates a batcher that holds up to queueSize samples
+func NewMetricBatcher(writer MetricWriter, queueSize, batchSize int, flushInterval time.Duration) *MetricBatcher {
+	return &MetricBatcher{
+		samples:       make(chan *structs.Sample, queueSize),
+		writer:        writer,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		batch:         make([]*structs.Sample, 0, batchSize),
+	}
+}
+
+// SetRetryPolicy configures retries for failed writes (default: no retries)
+func (b *MetricBatcher) SetRetryPolicy(policy RetryPolicy) {
+	b.retry = policy
+}
+
+// Enqueue adds samples and returns how many it took, always a prefix of
+// samples. Samples that could fit in the queue are added all or nothing, so
+// a refused request can be resent without duplicating samples; more samples
+// than the queue can ever hold are added up to its free space instead of
+// being refused forever.
+func (b *MetricBatcher) Enqueue(samples []*structs.Sample) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	if free := cap(b.samples) - len(b.samples); !b.closed && (len(samples) <= free || len(samples) > cap(b.samples)) {
+		n = min(len(samples), free)
+	}
+	for _, sample := range samples[:n] {
+		b.samples <- sample
+	}
+	b.enqueued.Add(int64(n))
+	b.rejected.Add(int64(len(samples) - n))
+	return n
+}
+
+// Stats returns metric queue statistics
+func (b *MetricBatcher) Stats() (enqueued, rejected int64, pending int) {
+	return b.enqueued.Load(), b.rejected.Load(), len(b.samples)
+}
+
+// Close stops accepting samples; Run returns once the rest are flushed
+func (b *MetricBatcher) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	close(b.samples)
+}
+
+// Run starts the batcher loop
+func (b *MetricBatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		// While a failed batch is kept, stop consuming so the queue fills up
+		// and remote_write senders are refused, keeping the samples on their side
+		samples := b.samples
+		if len(b.batch) >= b.batchSize {
+			samples = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			b.flushLast(context.Background())
+			return
+
+		case sample, ok := <-samples:
+			if !ok {
+				b.flushLast(ctx)
+				return
+			}
+			b.batch = append(b.batch, sample)
+			if len(b.batch) >= b.batchSize {
+				b.flush(ctx)
+			}
+
+		case <-ticker.C:
+			if len(b.batch) > 0 {
+				b.flush(ctx)
+			}
+		}
+	}
+}
+
+func (b *MetricBatcher) flush(ctx context.Context) error {
+	start := time.Now()
+	err := b.retry.do(ctx, func() error {
+		return b.writer.WriteMetrics(ctx, b.batch)
+	})
+	if err != nil {
+		log.Printf("failed to write batch of %d samples: %v", len(b.batch), err)
+		if b.retry.retryable(err) {
+			// Keep the batch; it is retried on the next tick
+			return err
+		}
+		log.Printf("dropped batch of %d samples", len(b.batch))
+	} else {
+		log.Printf("flushed %d samples in %v", len(b.batch), time.Since(start))
+	}
+
+	b.batch = b.batch[:0]
+	return err
+}
+
+// flushLast makes a final attempt to write the batch when Run returns
+func (b *MetricBatcher) flushLast(ctx context.Context) {
+	if len(b.batch) == 0 {
+		return
+	}
+	if b.flush(ctx) != nil && len(b.batch) > 0 {
+		log.Printf("lost batch of %d samples on shutdown", len(b.batch))
+	}
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	prompb "github.com/aidenappl/monitor-core/proto/prometheus"
+	"github.com/aidenappl/monitor-core/structs"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// promSeries returns a TimeSeries with labels given as name, value pairs and
+// samples given as value, millisecond timestamp pairs
+func promSeries(labels []string, samples ...float64) *prompb.TimeSeries {
+	series := &prompb.TimeSeries{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		series.Labels = append(series.Labels, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	for i := 0; i+1 < len(samples); i += 2 {
+		series.Samples = append(series.Samples, &prompb.Sample{Value: samples[i], Timestamp: int64(samples[i+1])})
+	}
+	return series
+}
+
+func TestDecodePromWrite(t *testing.T) {
+	body, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{
+		promSeries([]string{"__name__", "up", "job", "api", "", "ignored"}, 1, 1700000000000, 0, 1700000015000),
+		promSeries([]string{"__name__", "temp"}, math.NaN(), 1700000000000, math.Inf(1), 1700000000000, 21.5, 1700000000000),
+		promSeries([]string{"__name__", "stale"}, math.NaN(), 1700000000000),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := DecodePromWrite(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	at := func(ms int64) time.Time { return time.UnixMilli(ms).UTC() }
+	want := []*structs.Sample{
+		{Name: "up", Labels: map[string]string{"job": "api"}, Value: 1, Timestamp: at(1700000000000)},
+		{Name: "up", Labels: map[string]string{"job": "api"}, Value: 0, Timestamp: at(1700000015000)},
+		{Name: "temp", Labels: map[string]string{}, Value: 21.5, Timestamp: at(1700000000000)},
+	}
+	if !reflect.DeepEqual(samples, want) {
+		t.Fatalf("got %+v, want %+v", samples, want)
+	}
+}
+
+func TestDecodePromWriteWrongWireType(t *testing.T) {
+	// A value sent as a varint is skipped and reads as zero
+	var sample []byte
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, 1700000000000)
+	sample = protowire.AppendTag(sample, 1, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, 7)
+	var series []byte
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	var body []byte
+	body = protowire.AppendTag(body, 1, protowire.BytesType)
+	body = protowire.AppendBytes(body, series)
+
+	samples, err := DecodePromWrite(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Value != 0 {
+		t.Fatalf("got %+v, want one sample with value 0", samples)
+	}
+}
+
+func TestDecodePromWriteMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"truncated request", []byte{0x0a, 0x10, 0x0a}},
+		{"invalid wire type", []byte{0x0f}},
+		{"truncated label", []byte{0x0a, 0x04, 0x0a, 0x02, 0x0a, 0x05}},
+		{"truncated sample", []byte{0x0a, 0x04, 0x12, 0x02, 0x09, 0x00}},
+		{"field number zero in series", []byte{0x0a, 0x02, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePromWrite(tt.body); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestMetricBatcherEnqueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending int
+		samples int
+		want    int
+	}{
+		{"fits", 1, 3, 3},
+		// A request that could fit later is refused whole
+		{"no room", 2, 3, 0},
+		// A request larger than the queue takes the free space
+		{"larger than the queue", 1, 6, 3},
+		{"larger than a full queue", 4, 6, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMetricBatcher(nil, 4, 10, time.Second)
+			if n := b.Enqueue(make([]*structs.Sample, tt.pending)); n != tt.pending {
+				t.Fatalf("enqueued %d pending samples, want %d", n, tt.pending)
+			}
+
+			if n := b.Enqueue(make([]*structs.Sample, tt.samples)); n != tt.want {
+				t.Fatalf("Enqueue = %d, want %d", n, tt.want)
+			}
+			_, rejected, pending := b.Stats()
+			if rejected != int64(tt.samples-tt.want) || pending != tt.pending+tt.want {
+				t.Fatalf("rejected = %d, pending = %d", rejected, pending)
+			}
+		})
+	}
+}
+
+// flakyMetricWriter fails its first failures writes with err
+type flakyMetricWriter struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	written  int
+}
+
+func (w *flakyMetricWriter) WriteMetrics(ctx context.Context, samples []*structs.Sample) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return w.err
+	}
+	w.written += len(samples)
+	return nil
+}
+
+func (w *flakyMetricWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+func TestMetricBatcherFailedWrites(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantWritten int
+	}{
+		// A batch that fails with a retryable error is kept and written later
+		{"retryable", errors.New("connection refused"), 2},
+		// A batch that can never be written is dropped
+		{"permanent", errPermanent, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &flakyMetricWriter{failures: 3, err: tt.err}
+			b := NewMetricBatcher(writer, 10, 2, 5*time.Millisecond)
+			b.SetRetryPolicy(RetryPolicy{Retryable: func(err error) bool { return !errors.Is(err, errPermanent) }})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				b.Run(ctx)
+				close(done)
+			}()
+
+			if n := b.Enqueue(make([]*structs.Sample, 2)); n != 2 {
+				t.Fatalf("enqueued %d samples, want 2", n)
+			}
+
+			deadline := time.Now().Add(200 * time.Millisecond)
+			for writer.count() < tt.wantWritten || time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			if written := writer.count(); written != tt.wantWritten {
+				t.Fatalf("written = %d, want %d", written, tt.wantWritten)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+const (
+	// msgpackMaxDepth limits how deeply arrays and maps may nest
+	msgpackMaxDepth = 100
+
+	// msgpackTimestampExt is the extension type of a msgpack timestamp
+	msgpackTimestampExt = -1
+)
+
+var (
+	errMsgpackTooDeep = errors.New("msgpack: maximum nesting depth exceeded")
+
+	// ErrMsgpackTooLarge is returned when a value exceeds the decoder's size limit
+	ErrMsgpackTooLarge = errors.New("msgpack: value exceeds size limit")
+)
+
+// MsgpackExt is a msgpack extension value other than a timestamp
+type MsgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// time decodes a timestamp extension with the msgpack library
+func (e MsgpackExt) time() (time.Time, bool) {
+	if e.Type != msgpackTimestampExt {
+		return time.Time{}, false
+	}
+	var raw bytes.Buffer
+	if err := msgpack.NewEncoder(&raw).EncodeExtHeader(e.Type, len(e.Data)); err != nil {
+		return time.Time{}, false
+	}
+	raw.Write(e.Data)
+
+	var t time.Time
+	if err := msgpack.Unmarshal(raw.Bytes(), &t); err != nil {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// MsgpackDecoder reads msgpack values from a stream. Values decode to nil,
+// bool, int64 (uint64 above math.MaxInt64), float64, string, []byte,
+// time.Time (timestamp extensions), MsgpackExt, []interface{} and
+// map[string]interface{}; non-string map keys are formatted as strings.
+type MsgpackDecoder struct {
+	dec    *msgpack.Decoder
+	budget *msgpackBudget
+}
+
+// NewMsgpackDecoder creates a decoder that rejects any value whose encoding
+// is longer than maxValueSize bytes, so a value cannot grow without bound on
+// a stream. Zero means no limit.
+func NewMsgpackDecoder(r io.Reader, maxValueSize int) *MsgpackDecoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	budget := &msgpackBudget{r: br, max: maxValueSize}
+	return &MsgpackDecoder{dec: msgpack.NewDecoder(budget), budget: budget}
+}
+
+// Decode reads the next value. It returns io.EOF only when the stream ends
+// cleanly between values.
+func (d *MsgpackDecoder) Decode() (interface{}, error) {
+	d.budget.reset()
+	if _, err := d.dec.PeekCode(); err != nil {
+		return nil, err
+	}
+	v, err := d.decode(0)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (d *MsgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errMsgpackTooDeep
+	}
+
+	c, err := d.dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	// Lengths are checked against the size limit before anything is
+	// allocated for them
+	switch {
+	case msgpcode.IsString(c) || msgpcode.IsBin(c):
+		n, err := d.dec.DecodeBytesLen()
+		if err != nil {
+			return nil, err
+		}
+		if n > d.budget.remaining {
+			return nil, ErrMsgpackTooLarge
+		}
+		b := make([]byte, n)
+		if err := d.dec.ReadFull(b); err != nil {
+			return nil, err
+		}
+		if msgpcode.IsBin(c) {
+			return b, nil
+		}
+		return string(b), nil
+
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		n, err := d.dec.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		// Every element takes at least one byte
+		if n > d.budget.remaining {
+			return nil, ErrMsgpackTooLarge
+		}
+		values := make([]interface{}, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+
+	case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+		n, err := d.dec.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		if 2*n > d.budget.remaining {
+			return nil, ErrMsgpackTooLarge
+		}
+		values := make(map[string]interface{}, min(n, 1024))
+		for i := 0; i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k := k.(type) {
+			case string:
+				values[k] = v
+			case []byte:
+				values[string(k)] = v
+			default:
+				values[fmt.Sprint(k)] = v
+			}
+		}
+		return values, nil
+
+	case msgpcode.IsExt(c):
+		typ, n, err := d.dec.DecodeExtHeader()
+		if err != nil {
+			return nil, err
+		}
+		if n > d.budget.remaining {
+			return nil, ErrMsgpackTooLarge
+		}
+		ext := MsgpackExt{Type: typ, Data: make([]byte, n)}
+		if err := d.dec.ReadFull(ext.Data); err != nil {
+			return nil, err
+		}
+		if t, ok := ext.time(); ok {
+			return t, nil
+		}
+		return ext, nil
+	}
+
+	v, err := d.dec.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+		return v, nil
+	case float32:
+		return float64(v), nil
+	default:
+		return v, nil
+	}
+}
+
+// msgpackBudget charges the bytes read for each value against the
+// decoder's size limit. It is a ByteScanner, so the msgpack decoder reads
+// through it without buffering ahead into the next value.
+type msgpackBudget struct {
+	r         *bufio.Reader
+	max       int
+	remaining int
+}
+
+func (b *msgpackBudget) reset() {
+	b.remaining = b.max
+	if b.max <= 0 {
+		b.remaining = math.MaxInt
+	}
+}
+
+func (b *msgpackBudget) Read(p []byte) (int, error) {
+	if b.remaining == 0 {
+		return 0, ErrMsgpackTooLarge
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= n
+	return n, err
+}
+
+func (b *msgpackBudget) ReadByte() (byte, error) {
+	if b.remaining == 0 {
+		return 0, ErrMsgpackTooLarge
+	}
+	c, err := b.r.ReadByte()
+	if err == nil {
+		b.remaining--
+	}
+	return c, err
+}
+
+func (b *msgpackBudget) UnreadByte() error {
+	err := b.r.UnreadByte()
+	if err == nil {
+		b.remaining++
+	}
+	return err
+}
+
+// MsgpackToEvent maps a decoded msgpack map onto an event. Keys are the same
+// as in the JSON event format; binary strings become strings and timestamp
+// extensions become RFC 3339 timestamps, so the timestamp may be either.
+func MsgpackToEvent(v interface{}) (*structs.Event, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("event must be a map")
+	}
+
+	// Round-trip through JSON so msgpack events decode exactly like JSON ones
+	b, err := json.Marshal(normalizeForwardRecord(m))
+	if err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	var event structs.Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	return &event, nil
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMsgpackDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want interface{}
+	}{
+		{"nil", []byte{0xc0}, nil},
+		{"false", []byte{0xc2}, false},
+		{"true", []byte{0xc3}, true},
+		{"positive fixint", []byte{0x7f}, int64(127)},
+		{"negative fixint", []byte{0xe0}, int64(-32)},
+		{"uint8", []byte{0xcc, 0xff}, int64(255)},
+		{"uint16", []byte{0xcd, 0x01, 0x00}, int64(256)},
+		{"uint64 above int64", []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, uint64(math.MaxUint64)},
+		{"int8", []byte{0xd0, 0x80}, int64(-128)},
+		{"int16", []byte{0xd1, 0xff, 0x00}, int64(-256)},
+		{"int32", []byte{0xd2, 0xff, 0xff, 0xff, 0xff}, int64(-1)},
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, 1.5},
+		{"float64", []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, 1.5},
+		{"fixstr", []byte{0xa2, 'h', 'i'}, "hi"},
+		{"str8", []byte{0xd9, 0x02, 'h', 'i'}, "hi"},
+		{"bin8", []byte{0xc4, 0x02, 0x00, 0x01}, []byte{0x00, 0x01}},
+		{"fixext1", []byte{0xd4, 0x05, 0x01}, MsgpackExt{Type: 5, Data: []byte{0x01}}},
+		{"ext8", []byte{0xc7, 0x01, 0x05, 0x01}, MsgpackExt{Type: 5, Data: []byte{0x01}}},
+		{"32-bit timestamp", []byte{0xd6, 0xff, 0x00, 0x00, 0x00, 0x3c}, time.Unix(60, 0).UTC()},
+		{"64-bit timestamp", []byte{0xd7, 0xff, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x3c}, time.Unix(60, 1).UTC()},
+		{"96-bit timestamp", []byte{0xc7, 0x0c, 0xff, 0x00, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, time.Unix(-1, 1).UTC()},
+		{"timestamp of the wrong length", []byte{0xd5, 0xff, 0x00, 0x01}, MsgpackExt{Type: -1, Data: []byte{0x00, 0x01}}},
+		{"fixarray", []byte{0x92, 0x01, 0xa1, 'a'}, []interface{}{int64(1), "a"}},
+		{"array16", []byte{0xdc, 0x00, 0x01, 0xc0}, []interface{}{nil}},
+		{"fixmap", []byte{0x81, 0xa1, 'k', 0x01}, map[string]interface{}{"k": int64(1)}},
+		{"map16", []byte{0xde, 0x00, 0x01, 0xa1, 'k', 0xc3}, map[string]interface{}{"k": true}},
+		{"integer map key", []byte{0x81, 0x07, 0xa1, 'v'}, map[string]interface{}{"7": "v"}},
+		{"binary map key", []byte{0x81, 0xc4, 0x01, 'k', 0x01}, map[string]interface{}{"k": int64(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewMsgpackDecoder(bytes.NewReader(tt.in), 1024).Decode()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackDecodeMalformed(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x91}, msgpackMaxDepth+2)
+	many, err := msgpack.Marshal([]string{strings.Repeat("x", 500), strings.Repeat("x", 500), strings.Repeat("x", 500)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		wantErr error
+	}{
+		{"reserved type byte", []byte{0xc1}, nil},
+		{"truncated uint32", []byte{0xce, 0x00, 0x01}, io.ErrUnexpectedEOF},
+		{"truncated float64", []byte{0xcb, 0x3f}, io.ErrUnexpectedEOF},
+		{"truncated string", []byte{0xa5, 'a', 'b'}, io.ErrUnexpectedEOF},
+		{"truncated str16 length", []byte{0xda, 0x00}, io.ErrUnexpectedEOF},
+		{"truncated ext type", []byte{0xc7, 0x01}, io.ErrUnexpectedEOF},
+		{"truncated array", []byte{0x93, 0x01, 0x02}, io.ErrUnexpectedEOF},
+		{"truncated map value", []byte{0x81, 0xa1, 'k'}, io.ErrUnexpectedEOF},
+		{"string over limit", []byte{0xdb, 0x00, 0x10, 0x00, 0x00}, ErrMsgpackTooLarge},
+		{"binary over limit", []byte{0xc6, 0xff, 0xff, 0xff, 0xff}, ErrMsgpackTooLarge},
+		{"array over limit", []byte{0xdd, 0x00, 0x10, 0x00, 0x00}, ErrMsgpackTooLarge},
+		{"map over limit", []byte{0xdf, 0xff, 0xff, 0xff, 0xff}, ErrMsgpackTooLarge},
+		{"elements over limit together", many, ErrMsgpackTooLarge},
+		{"nested too deeply", deep, errMsgpackTooDeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMsgpackDecoder(bytes.NewReader(tt.in), 1024).Decode()
+			if err == nil || err == io.EOF {
+				t.Fatalf("err = %v, want a decoding error", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMsgpackDecodeStream(t *testing.T) {
+	// The size limit applies to each value, not to the whole stream
+	var b []byte
+	for i := 0; i < 10; i++ {
+		v, err := msgpack.Marshal(strings.Repeat("x", 500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, v...)
+	}
+
+	d := NewMsgpackDecoder(bytes.NewReader(b), 1000)
+	for i := 0; i < 10; i++ {
+		if _, err := d.Decode(); err != nil {
+			t.Fatalf("value %d: %v", i, err)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("err = %v, want io.EOF at the end of the stream", err)
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	values := []interface{}{
+		nil,
+		true,
+		int64(-33),
+		int64(math.MinInt64),
+		uint64(math.MaxUint64),
+		2.25,
+		"",
+		strings.Repeat("s", 300),
+		strings.Repeat("s", 70000),
+		[]byte{1, 2, 3},
+		time.Unix(1700000000, 5).UTC(),
+		[]interface{}{},
+		make([]interface{}, 20),
+		map[string]interface{}{"a": []interface{}{int64(1), map[string]interface{}{"b": "c"}}},
+	}
+
+	for _, v := range values {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("encode %T: %v", v, err)
+		}
+		got, err := NewMsgpackDecoder(bytes.NewReader(b), 1<<20).Decode()
+		if err != nil {
+			t.Fatalf("decode %T: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("got %#v, want %#v", got, v)
+		}
+	}
+}
+
+func FuzzMsgpackDecoder(f *testing.F) {
+	for _, v := range []interface{}{
+		map[string]interface{}{"tag": "app", "n": int64(1), "f": 1.5, "b": []byte("x")},
+		[]interface{}{"app", []interface{}{int64(1), map[string]interface{}{"k": nil}}},
+	} {
+		b, _ := msgpack.Marshal(v)
+		f.Add(b)
+	}
+	f.Add([]byte{0xd6, 0xff, 0x00, 0x00, 0x00, 0x3c})
+	f.Add([]byte{0xdd, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		// Malformed input ends the stream with an error, never a panic
+		d := NewMsgpackDecoder(bytes.NewReader(in), len(in))
+		for {
+			if _, err := d.Decode(); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Well-known OpenTelemetry semantic convention attributes
+const (
+	otelServiceName     = "service.name"
+	otelEnvironment     = "deployment.environment"
+	otelEnvironmentName = "deployment.environment.name"
+	otelEventName       = "event.name"
+	otelUnknownService  = "unknown_service"
+)
+
+// OTLP span status codes
+const (
+	otelStatusUnset = 0
+	otelStatusOK    = 1
+	otelStatusError = 2
+)
+
+// otlpMaxDepth limits how deeply array and kvlist values may nest
+const otlpMaxDepth = 100
+
+var errOTLPTooDeep = errors.New("attribute value nests too deeply")
+
+// otelSpanKinds names the OTLP SpanKind enum values
+var otelSpanKinds = []string{"unspecified", "internal", "server", "client", "producer", "consumer"}
+
+// otelStatusCodes names the OTLP StatusCode enum values
+var otelStatusCodes = []string{"unset", "ok", "error"}
+
+// unsafeDataKeyRegex matches characters that cannot be used in data.* filters
+var unsafeDataKeyRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// dataKey converts an attribute key such as "http.method" into a key that
+// the query and analytics APIs accept ("http_method")
+func dataKey(key string) string {
+	key = unsafeDataKeyRegex.ReplaceAllString(key, "_")
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		key = "_" + key
+	}
+	return key
+}
+
+// otelLevel maps an OTLP severity number (or text when the number is unset)
+// onto the level strings used by events
+func otelLevel(number int32, text string) string {
+	switch {
+	case number >= 21:
+		return "fatal"
+	case number >= 17:
+		return "error"
+	case number >= 13:
+		return "warn"
+	case number >= 9:
+		return "info"
+	case number >= 5:
+		return "debug"
+	case number >= 1:
+		return "trace"
+	}
+	return strings.ToLower(text)
+}
+
+// otelSeverity keeps an OTLP severity number within the event severity range;
+// out-of-range numbers are dropped
+func otelSeverity(number int32) uint8 {
+	if number < 1 || number > int32(structs.SeverityMax) {
+		return 0
+	}
+	return uint8(number)
+}
+
+// otelTraceID converts a 32-hex-character OTLP trace ID into the hyphenated
+// UUID form events use; empty or malformed IDs are dropped
+func otelTraceID(id string) string {
+	if len(id) != 32 {
+		return ""
+	}
+	id, _ = structs.ParseTraceID(id)
+	return id
+}
+
+// otelSpanID lowercases a 16-hex-character OTLP span ID; empty or malformed
+// IDs are dropped
+func otelSpanID(id string) string {
+	id, _ = structs.ParseSpanID(id)
+	return id
+}
+
+// otelTime converts nanoseconds since the epoch into a time, falling back
+// to the observed time and finally to now
+func otelTime(nanos, observed structs.OTLPUint64) time.Time {
+	switch {
+	case nanos > 0:
+		return time.Unix(0, int64(nanos)).UTC()
+	case observed > 0:
+		return time.Unix(0, int64(observed)).UTC()
+	default:
+		return time.Now().UTC()
+	}
+}
+
+// otelResource pulls service and environment out of resource attributes and
+// returns the remaining attributes for Event.Data
+func otelResource(resource structs.OTLPResource) (service, env string, data map[string]interface{}) {
+	data = make(map[string]interface{})
+	for _, attr := range resource.Attributes {
+		switch attr.Key {
+		case otelServiceName:
+			service = attr.Value.AsString()
+		case otelEnvironment, otelEnvironmentName:
+			env = attr.Value.AsString()
+		default:
+			data[dataKey(attr.Key)] = attr.Value.Interface()
+		}
+	}
+	if service == "" {
+		service = otelUnknownService
+	}
+	return service, env, data
+}
+
+// otelData starts an event's data with the resource attributes and scope
+// name, leaving room for extra keys. Nested attribute values are copied, so
+// the events of one resource share no maps or slices.
+func otelData(resourceData map[string]interface{}, scope structs.OTLPScope, extra int) map[string]interface{} {
+	data := make(map[string]interface{}, len(resourceData)+extra+1)
+	for k, v := range resourceData {
+		data[k] = cloneData(v)
+	}
+	if scope.Name != "" {
+		data["otel_scope_name"] = scope.Name
+	}
+	return data
+}
+
+// cloneData deep-copies the maps and slices of a data value
+func cloneData(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = cloneData(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = cloneData(item)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// OTLPLogsToEvents maps every log record in req onto an event
+func OTLPLogsToEvents(req *structs.OTLPLogsRequest) []*structs.Event {
+	var events []*structs.Event
+
+	for _, rl := range req.ResourceLogs {
+		service, env, resourceData := otelResource(rl.Resource)
+
+		for _, sl := range rl.ScopeLogs {
+			for _, record := range sl.LogRecords {
+				event := &structs.Event{
+					Timestamp: otelTime(record.TimeUnixNano, record.ObservedTimeUnixNano),
+					Service:   service,
+					Env:       env,
+					TraceID:   otelTraceID(record.TraceID),
+					SpanID:    otelSpanID(record.SpanID),
+					Name:      record.EventName,
+					Level:     otelLevel(record.SeverityNumber, record.SeverityText),
+					Severity:  otelSeverity(record.SeverityNumber),
+					Data:      otelData(resourceData, sl.Scope, len(record.Attributes)+2),
+				}
+
+				for _, attr := range record.Attributes {
+					if attr.Key == otelEventName && event.Name == "" {
+						event.Name = attr.Value.AsString()
+						continue
+					}
+					event.Data[dataKey(attr.Key)] = attr.Value.Interface()
+				}
+
+				if !record.Body.IsEmpty() {
+					if record.Body.StringValue != nil {
+						event.Data["message"] = *record.Body.StringValue
+					} else {
+						event.Data["body"] = record.Body.Interface()
+					}
+				}
+
+				if event.Name == "" {
+					event.Name = "log"
+				}
+
+				events = append(events, event)
+			}
+		}
+	}
+
+	return events
+}
+
+// OTLPTracesToEvents maps every span in req onto an event timestamped at the
+// span's start, with its trace and span IDs in their columns and its kind,
+// status and duration in Event.Data
+func OTLPTracesToEvents(req *structs.OTLPTracesRequest) []*structs.Event {
+	var events []*structs.Event
+
+	for _, rs := range req.ResourceSpans {
+		service, env, resourceData := otelResource(rs.Resource)
+
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				event := &structs.Event{
+					Timestamp:    otelTime(span.StartTimeUnixNano, 0),
+					Service:      service,
+					Env:          env,
+					TraceID:      otelTraceID(span.TraceID),
+					SpanID:       otelSpanID(span.SpanID),
+					ParentSpanID: otelSpanID(span.ParentSpanID),
+					Name:         span.Name,
+					Level:        "info",
+					Data:         otelData(resourceData, ss.Scope, len(span.Attributes)+4),
+				}
+				if event.Name == "" {
+					event.Name = "span"
+				}
+
+				if span.Kind >= 0 && int(span.Kind) < len(otelSpanKinds) {
+					event.Data["span_kind"] = otelSpanKinds[span.Kind]
+				}
+				if span.StartTimeUnixNano > 0 && span.EndTimeUnixNano >= span.StartTimeUnixNano {
+					event.Data["duration_ms"] = float64(span.EndTimeUnixNano-span.StartTimeUnixNano) / float64(time.Millisecond)
+				}
+
+				status := span.Status.Code
+				if status < otelStatusUnset || status > otelStatusError {
+					status = otelStatusUnset
+				}
+				event.Data["status_code"] = otelStatusCodes[status]
+				if span.Status.Message != "" {
+					event.Data["status_message"] = span.Status.Message
+				}
+				if status == otelStatusError {
+					event.Level = "error"
+				}
+
+				for _, attr := range span.Attributes {
+					event.Data[dataKey(attr.Key)] = attr.Value.Interface()
+				}
+
+				events = append(events, event)
+			}
+		}
+	}
+
+	return events
+}
+
+// otlpUnmarshal bounds how deeply protobuf messages may nest. Each level of
+// an array or kvlist value is two or three messages deep, so values nested
+// past otlpMaxDepth still decode and are refused by otlpValue.
+var otlpUnmarshal = proto.UnmarshalOptions{RecursionLimit: 3*otlpMaxDepth + 16}
+
+// DecodeOTLPLogs decodes a protobuf ExportLogsServiceRequest
+func DecodeOTLPLogs(b []byte) (*structs.OTLPLogsRequest, error) {
+	var msg collogspb.ExportLogsServiceRequest
+	if err := otlpUnmarshal.Unmarshal(b, &msg); err != nil {
+		return nil, fmt.Errorf("invalid ExportLogsServiceRequest: %w", err)
+	}
+
+	req := &structs.OTLPLogsRequest{}
+	for _, rl := range msg.GetResourceLogs() {
+		resource, err := otlpResource(rl.GetResource())
+		if err != nil {
+			return nil, err
+		}
+		resourceLogs := structs.OTLPResourceLogs{Resource: resource}
+
+		for _, sl := range rl.GetScopeLogs() {
+			scope, err := otlpScope(sl.GetScope())
+			if err != nil {
+				return nil, err
+			}
+			scopeLogs := structs.OTLPScopeLogs{Scope: scope}
+
+			for _, lr := range sl.GetLogRecords() {
+				record := structs.OTLPLogRecord{
+					TimeUnixNano:         structs.OTLPUint64(lr.GetTimeUnixNano()),
+					ObservedTimeUnixNano: structs.OTLPUint64(lr.GetObservedTimeUnixNano()),
+					SeverityNumber:       int32(lr.GetSeverityNumber()),
+					SeverityText:         lr.GetSeverityText(),
+					EventName:            lr.GetEventName(),
+					TraceID:              hex.EncodeToString(lr.GetTraceId()),
+					SpanID:               hex.EncodeToString(lr.GetSpanId()),
+				}
+				if record.Body, err = otlpValue(lr.GetBody(), 0); err != nil {
+					return nil, err
+				}
+				if record.Attributes, err = otlpKeyValues(lr.GetAttributes(), 0); err != nil {
+					return nil, err
+				}
+				scopeLogs.LogRecords = append(scopeLogs.LogRecords, record)
+			}
+			resourceLogs.ScopeLogs = append(resourceLogs.ScopeLogs, scopeLogs)
+		}
+		req.ResourceLogs = append(req.ResourceLogs, resourceLogs)
+	}
+
+	return req, nil
+}
+
+// DecodeOTLPTraces decodes a protobuf ExportTraceServiceRequest
+func DecodeOTLPTraces(b []byte) (*structs.OTLPTracesRequest, error) {
+	var msg coltracepb.ExportTraceServiceRequest
+	if err := otlpUnmarshal.Unmarshal(b, &msg); err != nil {
+		return nil, fmt.Errorf("invalid ExportTraceServiceRequest: %w", err)
+	}
+
+	req := &structs.OTLPTracesRequest{}
+	for _, rs := range msg.GetResourceSpans() {
+		resource, err := otlpResource(rs.GetResource())
+		if err != nil {
+			return nil, err
+		}
+		resourceSpans := structs.OTLPResourceSpans{Resource: resource}
+
+		for _, ss := range rs.GetScopeSpans() {
+			scope, err := otlpScope(ss.GetScope())
+			if err != nil {
+				return nil, err
+			}
+			scopeSpans := structs.OTLPScopeSpans{Scope: scope}
+
+			for _, s := range ss.GetSpans() {
+				span := structs.OTLPSpan{
+					TraceID:           hex.EncodeToString(s.GetTraceId()),
+					SpanID:            hex.EncodeToString(s.GetSpanId()),
+					ParentSpanID:      hex.EncodeToString(s.GetParentSpanId()),
+					Name:              s.GetName(),
+					Kind:              int32(s.GetKind()),
+					StartTimeUnixNano: structs.OTLPUint64(s.GetStartTimeUnixNano()),
+					EndTimeUnixNano:   structs.OTLPUint64(s.GetEndTimeUnixNano()),
+					Status: structs.OTLPStatus{
+						Code:    int32(s.GetStatus().GetCode()),
+						Message: s.GetStatus().GetMessage(),
+					},
+				}
+				if span.Attributes, err = otlpKeyValues(s.GetAttributes(), 0); err != nil {
+					return nil, err
+				}
+				scopeSpans.Spans = append(scopeSpans.Spans, span)
+			}
+			resourceSpans.ScopeSpans = append(resourceSpans.ScopeSpans, scopeSpans)
+		}
+		req.ResourceSpans = append(req.ResourceSpans, resourceSpans)
+	}
+
+	return req, nil
+}
+
+func otlpResource(resource *resourcepb.Resource) (structs.OTLPResource, error) {
+	attributes, err := otlpKeyValues(resource.GetAttributes(), 0)
+	return structs.OTLPResource{Attributes: attributes}, err
+}
+
+func otlpScope(scope *commonpb.InstrumentationScope) (structs.OTLPScope, error) {
+	attributes, err := otlpKeyValues(scope.GetAttributes(), 0)
+	return structs.OTLPScope{Name: scope.GetName(), Version: scope.GetVersion(), Attributes: attributes}, err
+}
+
+func otlpKeyValues(kvs []*commonpb.KeyValue, depth int) ([]structs.OTLPKeyValue, error) {
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	out := make([]structs.OTLPKeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		value, err := otlpValue(kv.GetValue(), depth)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, structs.OTLPKeyValue{Key: kv.GetKey(), Value: value})
+	}
+	return out, nil
+}
+
+// otlpValue converts an AnyValue, whose array and kvlist values may hold
+// further values up to otlpMaxDepth deep
+func otlpValue(v *commonpb.AnyValue, depth int) (structs.OTLPAnyValue, error) {
+	var out structs.OTLPAnyValue
+	if depth >= otlpMaxDepth {
+		return out, errOTLPTooDeep
+	}
+	switch value := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		out.StringValue = &value.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		out.BoolValue = &value.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		i := structs.OTLPInt64(value.IntValue)
+		out.IntValue = &i
+	case *commonpb.AnyValue_DoubleValue:
+		out.DoubleValue = &value.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		out.BytesValue = append([]byte{}, value.BytesValue...)
+	case *commonpb.AnyValue_ArrayValue:
+		array := &structs.OTLPArrayValue{}
+		for _, item := range value.ArrayValue.GetValues() {
+			converted, err := otlpValue(item, depth+1)
+			if err != nil {
+				return out, err
+			}
+			array.Values = append(array.Values, converted)
+		}
+		out.ArrayValue = array
+	case *commonpb.AnyValue_KvlistValue:
+		values, err := otlpKeyValues(value.KvlistValue.GetValues(), depth+1)
+		if err != nil {
+			return out, err
+		}
+		out.KvlistValue = &structs.OTLPKeyValueList{Values: values}
+	}
+	return out, nil
+}
+
+// EncodeOTLPExportResponse encodes an ExportLogsServiceResponse, or an
+// ExportTraceServiceResponse when spans were rejected. Without a partial
+// success both encode to an empty message.
+func EncodeOTLPExportResponse(resp *structs.OTLPExportResponse) []byte {
+	var msg proto.Message
+	switch ps := resp.PartialSuccess; {
+	case ps == nil:
+		msg = &collogspb.ExportLogsServiceResponse{}
+	case ps.RejectedSpans > 0:
+		msg = &coltracepb.ExportTraceServiceResponse{PartialSuccess: &coltracepb.ExportTracePartialSuccess{
+			RejectedSpans: ps.RejectedSpans,
+			ErrorMessage:  ps.ErrorMessage,
+		}}
+	default:
+		msg = &collogspb.ExportLogsServiceResponse{PartialSuccess: &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: ps.RejectedLogRecords,
+			ErrorMessage:       ps.ErrorMessage,
+		}}
+	}
+	b, _ := proto.Marshal(msg)
+	return b
+}
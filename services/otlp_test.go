@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// nestedOTLPValue returns an AnyValue holding levels nested array values, or
+// kvlist values if kvlist is set, around a string
+func nestedOTLPValue(levels int, kvlist bool) *commonpb.AnyValue {
+	value := &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "x"}}
+	for i := 0; i < levels; i++ {
+		if kvlist {
+			value = &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+				Values: []*commonpb.KeyValue{{Key: "k", Value: value}},
+			}}}
+		} else {
+			value = &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+				Values: []*commonpb.AnyValue{value},
+			}}}
+		}
+	}
+	return value
+}
+
+// otlpLogsWithBody encodes an ExportLogsServiceRequest with one log record
+func otlpLogsWithBody(body *commonpb.AnyValue) []byte {
+	b, _ := proto.Marshal(&collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{Body: body}}}},
+	}}})
+	return b
+}
+
+// otlpTracesWithAttribute encodes an ExportTraceServiceRequest with one span
+func otlpTracesWithAttribute(value *commonpb.AnyValue) []byte {
+	b, _ := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+			Name:       "GET /",
+			Attributes: []*commonpb.KeyValue{{Key: "nested", Value: value}},
+		}}}},
+	}}})
+	return b
+}
+
+func TestDecodeOTLPLogsDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		levels  int
+		kvlist  bool
+		wantErr bool
+	}{
+		{"flat", 0, false, false},
+		{"arrays within limit", otlpMaxDepth - 1, false, false},
+		{"kvlists within limit", otlpMaxDepth - 1, true, false},
+		{"arrays at limit", otlpMaxDepth, false, true},
+		{"kvlists at limit", otlpMaxDepth, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := DecodeOTLPLogs(otlpLogsWithBody(nestedOTLPValue(tt.levels, tt.kvlist)))
+			if tt.wantErr {
+				if !errors.Is(err, errOTLPTooDeep) {
+					t.Fatalf("err = %v, want %v", err, errOTLPTooDeep)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n := len(req.ResourceLogs[0].ScopeLogs[0].LogRecords); n != 1 {
+				t.Fatalf("got %d log records, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDecodeOTLPTracesDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		levels  int
+		wantErr bool
+	}{
+		{"flat", 0, false},
+		{"within limit", otlpMaxDepth - 1, false},
+		{"at limit", otlpMaxDepth, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := DecodeOTLPTraces(otlpTracesWithAttribute(nestedOTLPValue(tt.levels, true)))
+			if tt.wantErr {
+				if !errors.Is(err, errOTLPTooDeep) {
+					t.Fatalf("err = %v, want %v", err, errOTLPTooDeep)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name := req.ResourceSpans[0].ScopeSpans[0].Spans[0].Name; name != "GET /" {
+				t.Fatalf("span name = %q, want %q", name, "GET /")
+			}
+		})
+	}
+}
+
+// truncated drops the last byte of b
+func truncated(b []byte) []byte {
+	return b[:len(b)-1]
+}
+
+func TestDecodeOTLPLogsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"truncated tag", []byte{0x80}},
+		{"truncated length", []byte{0x0a, 0x80}},
+		{"length past end", []byte{0x0a, 0x05, 0x01}},
+		{"field number zero", []byte{0x02, 0x00}},
+		{"truncated nested body", truncated(otlpLogsWithBody(nestedOTLPValue(1, false)))},
+		{"nested past the recursion limit", otlpLogsWithBody(nestedOTLPValue(10000, false))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeOTLPLogs(tt.body); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -54,19 +55,45 @@ type DataKeysResult struct {
 	Keys []string `json:"keys"`
 }
 
+// eventsTable is read with FINAL once it is a ReplacingMergeTree, so copies
+// of a retried event that the storage engine has not merged yet are counted
+// once. A plain MergeTree does not support FINAL.
 func eventsTable() string {
+	if db.ReplacingEvents {
+		return fmt.Sprintf("%s.events FINAL", db.Database)
+	}
 	return fmt.Sprintf("%s.events", db.Database)
 }
 
+// callerScope limits a query to the events the caller may read: those of
+// its tenant and, if its API key is restricted, of the key's services and
+// envs
+func callerScope(ctx context.Context) sq.Eq {
+	scope := sq.Eq{"tenant": TenantFromContext(ctx)}
+	if key := APIKeyFromContext(ctx); key != nil {
+		if len(key.Services) > 0 {
+			scope["service"] = key.Services
+		}
+		if len(key.Envs) > 0 {
+			scope["env"] = key.Envs
+		}
+	}
+	return scope
+}
+
 var validColumns = map[string]bool{
-	"service":    true,
-	"env":        true,
-	"job_id":     true,
-	"request_id": true,
-	"trace_id":   true,
-	"user_id":    true,
-	"name":       true,
-	"level":      true,
+	"event_id":       true,
+	"service":        true,
+	"env":            true,
+	"job_id":         true,
+	"request_id":     true,
+	"trace_id":       true,
+	"span_id":        true,
+	"parent_span_id": true,
+	"user_id":        true,
+	"name":           true,
+	"level":          true,
+	"severity":       true,
 }
 
 func applyFilters(builder sq.SelectBuilder, params QueryParams) sq.SelectBuilder {
@@ -92,6 +119,14 @@ func applyColumnFilter(builder sq.SelectBuilder, f Filter) sq.SelectBuilder {
 	if !validColumns[f.Field] {
 		return builder
 	}
+	if f.Field == "level" && IsOrderedOperator(string(f.Operator)) {
+		cond, args, err := severityCondition(string(f.Operator), f.Value)
+		if err != nil {
+			return builder
+		}
+		return builder.Where(cond, args...)
+	}
+	f.Value = normalizeFilterValue(f.Field, string(f.Operator), f.Value)
 
 	switch f.Operator {
 	case OpEq, "":
@@ -121,6 +156,101 @@ func applyColumnFilter(builder sq.SelectBuilder, f Filter) sq.SelectBuilder {
 	return builder
 }
 
+// IsOrderedOperator reports whether operator is lt, gt, lte or gte
+func IsOrderedOperator(operator string) bool {
+	switch Operator(operator) {
+	case OpLt, OpGt, OpLte, OpGte:
+		return true
+	}
+	return false
+}
+
+// severityCondition compares the severity column against the band of a
+// level, so level__gte=warn also matches error and fatal. Events with an
+// unrecognised level have severity zero and match no ordered comparison.
+func severityCondition(operator string, value interface{}) (string, []interface{}, error) {
+	level, ok := structs.ParseLevel(fmt.Sprint(value))
+	if !ok {
+		return "", nil, fmt.Errorf("invalid level: %v (expected one of %s)", value, strings.Join(structs.Levels, ", "))
+	}
+	low, _ := structs.LevelSeverity(level)
+	high := low + 3
+
+	switch Operator(operator) {
+	case OpLt:
+		return "severity BETWEEN 1 AND ?", []interface{}{low - 1}, nil
+	case OpLte:
+		return "severity BETWEEN 1 AND ?", []interface{}{high}, nil
+	case OpGt:
+		return "severity > ?", []interface{}{high}, nil
+	case OpGte:
+		return "severity >= ?", []interface{}{low}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported operator for level: %s", operator)
+}
+
+// filterValueNormalizers map the values of equality and in filters on a
+// column onto the form ingest stores, so level=WARNING finds warn events and
+// a 32-hex trace_id finds the trace stored as a UUID
+var filterValueNormalizers = map[string]func(string) string{
+	"level": func(v string) string {
+		if level, ok := structs.ParseLevel(v); ok {
+			return level
+		}
+		return strings.ToLower(strings.TrimSpace(v))
+	},
+	"trace_id":       normalizeID(structs.ParseTraceID),
+	"span_id":        normalizeID(structs.ParseSpanID),
+	"parent_span_id": normalizeID(structs.ParseSpanID),
+}
+
+// normalizeID adapts an ID parser to filterValueNormalizers, passing values
+// it cannot parse through unchanged
+func normalizeID(parse func(string) (string, bool)) func(string) string {
+	return func(v string) string {
+		if id, ok := parse(v); ok {
+			return id
+		}
+		return v
+	}
+}
+
+// normalizeFilterValue applies the column's normalizer to the value of an
+// eq, neq or in filter
+func normalizeFilterValue(field, operator string, value interface{}) interface{} {
+	normalize, ok := filterValueNormalizers[field]
+	if !ok {
+		return value
+	}
+	switch Operator(operator) {
+	case OpEq, OpNeq, OpIn, "":
+	default:
+		return value
+	}
+
+	switch v := value.(type) {
+	case string:
+		return normalize(v)
+	case []string:
+		values := make([]string, len(v))
+		for i, s := range v {
+			values[i] = normalize(s)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			if str, ok := s.(string); ok {
+				values[i] = normalize(str)
+			} else {
+				values[i] = s
+			}
+		}
+		return values
+	}
+	return value
+}
+
 func applyDataFilter(builder sq.SelectBuilder, f Filter) sq.SelectBuilder {
 	extractStr := fmt.Sprintf("JSONExtractString(data, '%s')", f.Field)
 	extractNum := fmt.Sprintf("toFloat64OrNull(JSONExtractRaw(data, '%s'))", f.Field)
@@ -160,6 +290,7 @@ func QueryEvents(ctx context.Context, params QueryParams) (*QueryResult, error)
 	// Count query
 	countBuilder := sq.Select("count()").
 		From(eventsTable()).
+		Where(callerScope(ctx)).
 		PlaceholderFormat(sq.Question)
 	countBuilder = applyFilters(countBuilder, params)
 
@@ -174,8 +305,9 @@ func QueryEvents(ctx context.Context, params QueryParams) (*QueryResult, error)
 	}
 
 	// Data query
-	queryBuilder := sq.Select("timestamp", "service", "env", "job_id", "request_id", "trace_id", "user_id", "name", "level", "data").
+	queryBuilder := sq.Select("timestamp", "event_id", "received_at", "sample_rate", "service", "env", "job_id", "request_id", "trace_id", "span_id", "parent_span_id", "user_id", "name", "level", "severity", "data").
 		From(eventsTable()).
+		Where(callerScope(ctx)).
 		OrderBy("timestamp DESC").
 		Limit(uint64(params.Limit)).
 		Offset(uint64(params.Offset)).
@@ -197,7 +329,7 @@ func QueryEvents(ctx context.Context, params QueryParams) (*QueryResult, error)
 	for rows.Next() {
 		var e structs.Event
 		var dataStr string
-		if err := rows.Scan(&e.Timestamp, &e.Service, &e.Env, &e.JobID, &e.RequestID, &e.TraceID, &e.UserID, &e.Name, &e.Level, &dataStr); err != nil {
+		if err := rows.Scan(&e.Timestamp, &e.EventID, &e.ReceivedAt, &e.SampleRate, &e.Service, &e.Env, &e.JobID, &e.RequestID, &e.TraceID, &e.SpanID, &e.ParentSpanID, &e.UserID, &e.Name, &e.Level, &e.Severity, &dataStr); err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
 		if dataStr != "" && dataStr != "{}" {
@@ -232,6 +364,7 @@ func GetLabelValues(ctx context.Context, label string, params QueryParams) (*Lab
 
 	builder := sq.Select(fmt.Sprintf("DISTINCT %s", column)).
 		From(eventsTable()).
+		Where(callerScope(ctx)).
 		OrderBy(column).
 		Limit(1000).
 		PlaceholderFormat(sq.Question)
@@ -287,6 +420,7 @@ func GetLabelValues(ctx context.Context, label string, params QueryParams) (*Lab
 func GetDataKeys(ctx context.Context, params QueryParams) (*DataKeysResult, error) {
 	builder := sq.Select("DISTINCT arrayJoin(JSONExtractKeys(data)) AS key").
 		From(eventsTable()).
+		Where(callerScope(ctx)).
 		OrderBy("key").
 		Limit(1000).
 		PlaceholderFormat(sq.Question)
@@ -327,6 +461,7 @@ func GetDataValues(ctx context.Context, key string, params QueryParams) (*LabelV
 	builder := sq.Select("DISTINCT JSONExtractString(data, ?) AS value").
 		From(eventsTable()).
 		Where("JSONExtractString(data, ?) != ''").
+		Where(callerScope(ctx)).
 		OrderBy("value").
 		Limit(1000).
 		PlaceholderFormat(sq.Question)
@@ -1,42 +1,445 @@
 package services
 
 import (
+	"context"
 	"log"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aidenappl/monitor-core/structs"
+	"github.com/google/uuid"
 )
 
-// Queue is a buffered channel for events
+// maxDroppedServices caps the services whose dropped events are counted on
+// their own; drops of any further services are counted under
+// otherDroppedServices, as service names come from clients
+const (
+	maxDroppedServices   = 100
+	otherDroppedServices = "other"
+)
+
+// QueuedEvent is an event waiting in the queue along with its WAL position
+type QueuedEvent struct {
+	Event *structs.Event
+	Pos   WALPosition
+}
+
+// Queue is a buffered channel for events, optionally backed by a write-ahead log
 type Queue struct {
-	events   chan *structs.Event
-	dropped  atomic.Int64
-	enqueued atomic.Int64
+	events           chan QueuedEvent
+	slots            atomic.Int64 // events sent or about to be sent to events
+	wal              *WAL
+	mu               sync.Mutex
+	highWater        int
+	redactor         *Redactor
+	sampler          *Sampler
+	maxSampleRate    uint32
+	sampledOut       atomic.Int64
+	dedup            *DedupWindow
+	duplicates       atomic.Int64
+	dropped          atomic.Int64
+	enqueued         atomic.Int64
+	rejected         atomic.Int64
+	droppedByService sync.Map // service name -> *atomic.Int64
+	droppedServices  atomic.Int64
+	tenants          *Tenants
+	pendingByTenant  sync.Map // tenant name -> *atomic.Int64
+	droppedByTenant  sync.Map // tenant name -> *atomic.Int64
+	waiters          atomic.Int64
+	waitMu           sync.Mutex
+	drained          chan struct{} // closed when an event leaves the queue
 }
 
 // NewQueue creates a new event queue with the specified buffer size
 func NewQueue(size int) *Queue {
 	return &Queue{
-		events: make(chan *structs.Event, size),
+		events:    make(chan QueuedEvent, size),
+		highWater: size,
 	}
 }
 
-// Enqueue adds an event to the queue
-// Returns false if the queue is full (event dropped)
+// NewDurableQueue creates a queue that appends every accepted event to wal
+func NewDurableQueue(size int, wal *WAL) *Queue {
+	q := NewQueue(size)
+	q.wal = wal
+	return q
+}
+
+// Enqueue adds an event to the queue, normalizing its level and trace IDs,
+// stamping its receive time, event ID and tenant if the caller has not and
+// redacting its data. Returns false if the queue or the tenant's quota is
+// full (event dropped); events discarded by sampling rules and duplicates of
+// recently queued events count as accepted.
 func (q *Queue) Enqueue(event *structs.Event) bool {
-	select {
-	case q.events <- event:
+	return q.EnqueueAll([]*structs.Event{event})
+}
+
+// EnqueueAll adds events to the queue like Enqueue, all or nothing: room in
+// the queue and in the quotas of their tenants is reserved for every event
+// before any is queued. Returns false if there is not enough, in which case
+// none are queued and every event counts as dropped.
+func (q *Queue) EnqueueAll(events []*structs.Event) bool {
+	queued := make([]*structs.Event, 0, len(events))
+	var dedupKeys []string
+	for _, event := range events {
+		event.NormalizeLevel()
+		event.NormalizeTraceContext()
+		if q.maxSampleRate > 0 {
+			event.SampleRate = min(event.SampleRate, q.maxSampleRate)
+		}
+		if event.Tenant == "" {
+			event.Tenant = structs.DefaultTenant
+		}
+
+		if event.EventID != "" && q.dedup != nil {
+			key := event.Tenant + "\x00" + event.Service + "\x00" + event.EventID
+			if !q.dedup.Add(key) {
+				q.duplicates.Add(1)
+				continue
+			}
+			dedupKeys = append(dedupKeys, key)
+		}
+		if !q.sampler.Sample(event) {
+			q.sampledOut.Add(1)
+			continue
+		}
+		if event.EventID == "" {
+			event.EventID = uuid.NewString()
+		}
+		if event.ReceivedAt.IsZero() {
+			event.ReceivedAt = time.Now().UTC()
+		}
+		q.redactor.Redact(event)
+		queued = append(queued, event)
+	}
+	if len(queued) == 0 {
+		return true
+	}
+
+	n := 0
+	if q.reserve(queued) {
+		n = q.enqueue(queued)
+	}
+	if n == len(queued) {
+		return true
+	}
+
+	for _, event := range queued[n:] {
+		q.drop(event)
+		q.release(event)
+	}
+	// Let a retry of the dropped events through
+	for _, key := range dedupKeys {
+		q.dedup.Remove(key)
+	}
+	return false
+}
+
+// reserve counts events as pending for their tenants, unless that would take
+// a tenant over its queue quota, in which case none are
+func (q *Queue) reserve(events []*structs.Event) bool {
+	for i, event := range events {
+		pending := q.tenantCounter(&q.pendingByTenant, event.Tenant)
+		if n := pending.Add(1); q.tenants != nil {
+			if quota := q.tenants.QueueQuota(event.Tenant); quota > 0 && n > int64(quota) {
+				pending.Add(-1)
+				for _, reserved := range events[:i] {
+					q.release(reserved)
+				}
+				log.Printf("queue quota of tenant %s exceeded: dropped %d events", event.Tenant, len(events))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// release gives back the quota an event held while it was pending
+func (q *Queue) release(event *structs.Event) {
+	q.tenantCounter(&q.pendingByTenant, event.Tenant).Add(-1)
+}
+
+// dequeued releases the queue slot and quota an event held while it was
+// pending. The batcher calls it for every event it takes off the queue.
+func (q *Queue) dequeued(event *structs.Event) {
+	q.slots.Add(-1)
+	q.release(event)
+
+	if q.waiters.Load() > 0 {
+		q.waitMu.Lock()
+		if q.drained != nil {
+			close(q.drained)
+			q.drained = nil
+		}
+		q.waitMu.Unlock()
+	}
+}
+
+func (q *Queue) tenantCounter(counters *sync.Map, tenant string) *atomic.Int64 {
+	counter, _ := counters.LoadOrStore(tenant, &atomic.Int64{})
+	return counter.(*atomic.Int64)
+}
+
+// claim takes n slots in the channel, so sending n events cannot block, or
+// none if fewer are free
+func (q *Queue) claim(n int) bool {
+	for {
+		used := q.slots.Load()
+		if used+int64(n) > int64(cap(q.events)) {
+			return false
+		}
+		if q.slots.CompareAndSwap(used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+// enqueue sends events to the channel, appending each to the WAL first if
+// there is one, and returns how many were queued: none if the channel has no
+// room for all of them. Only a failed WAL append stops part way, leaving the
+// events already appended queued.
+func (q *Queue) enqueue(events []*structs.Event) int {
+	if !q.claim(len(events)) {
+		log.Printf("queue overflow: dropped %d events", len(events))
+		return 0
+	}
+
+	if q.wal == nil {
+		for _, event := range events {
+			q.events <- QueuedEvent{Event: event}
+		}
+		q.enqueued.Add(int64(len(events)))
+		return len(events)
+	}
+
+	// Appending and sending under one lock keeps channel order identical to
+	// WAL order, so the batcher can commit positions monotonically
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, event := range events {
+		pos, err := q.wal.Append(event)
+		if err != nil {
+			q.slots.Add(-int64(len(events) - i))
+			log.Printf("wal append failed: dropped %d events: %v", len(events)-i, err)
+			return i
+		}
+		q.events <- QueuedEvent{Event: event, Pos: pos}
 		q.enqueued.Add(1)
+	}
+	return len(events)
+}
+
+func (q *Queue) drop(event *structs.Event) {
+	q.dropped.Add(1)
+	q.serviceDropCounter(event.Service).Add(1)
+	q.tenantCounter(&q.droppedByTenant, event.Tenant).Add(1)
+}
+
+// serviceDropCounter returns the dropped event counter of service, or of
+// otherDroppedServices once maxDroppedServices services have one
+func (q *Queue) serviceDropCounter(service string) *atomic.Int64 {
+	if counter, ok := q.droppedByService.Load(service); ok {
+		return counter.(*atomic.Int64)
+	}
+	if q.droppedServices.Add(1) > maxDroppedServices {
+		q.droppedServices.Add(-1)
+		counter, _ := q.droppedByService.LoadOrStore(otherDroppedServices, &atomic.Int64{})
+		return counter.(*atomic.Int64)
+	}
+	counter, loaded := q.droppedByService.LoadOrStore(service, &atomic.Int64{})
+	if loaded {
+		// Another drop of the same service stored it first
+		q.droppedServices.Add(-1)
+	}
+	return counter.(*atomic.Int64)
+}
+
+// SetHighWaterMark sets the number of pending events at which the queue
+// reports itself as saturated
+func (q *Queue) SetHighWaterMark(pending int) {
+	if pending <= 0 || pending > cap(q.events) {
+		pending = cap(q.events)
+	}
+	q.highWater = pending
+}
+
+// SetRedactor sets the rules applied to every event before it is queued.
+// Call it before events are enqueued.
+func (q *Queue) SetRedactor(r *Redactor) {
+	q.redactor = r
+}
+
+// Redactor returns the queue's redaction rules, or nil if there are none
+func (q *Queue) Redactor() *Redactor {
+	return q.redactor
+}
+
+// SetSampler sets the sampling rules applied to every event before it is
+// queued. Call it before events are enqueued.
+func (q *Queue) SetSampler(s *Sampler) {
+	q.sampler = s
+}
+
+// SetMaxClientSampleRate caps the sample rate producers may set on their
+// events (default: no cap), so one event cannot stand for an arbitrary
+// number of others in analytics; a cap of 1 ignores producer rates. Call it
+// before events are enqueued.
+func (q *Queue) SetMaxClientSampleRate(rate uint32) {
+	q.maxSampleRate = rate
+}
+
+// Sampler returns the queue's sampling rules, or nil if there are none
+func (q *Queue) Sampler() *Sampler {
+	return q.sampler
+}
+
+// SampledOut returns the number of events discarded by sampling rules
+func (q *Queue) SampledOut() int64 {
+	return q.sampledOut.Load()
+}
+
+// SetDedupWindow sets the window of recent event IDs checked for duplicates.
+// Call it before events are enqueued.
+func (q *Queue) SetDedupWindow(w *DedupWindow) {
+	q.dedup = w
+}
+
+// DedupWindow returns the queue's dedup window, or nil if there is none
+func (q *Queue) DedupWindow() *DedupWindow {
+	return q.dedup
+}
+
+// Duplicates returns the number of events discarded as duplicates of
+// recently queued ones
+func (q *Queue) Duplicates() int64 {
+	return q.duplicates.Load()
+}
+
+// SetTenants sets the tenants whose queue quotas are enforced. Call it
+// before events are enqueued.
+func (q *Queue) SetTenants(t *Tenants) {
+	q.tenants = t
+}
+
+// Tenants returns the queue's tenants, or nil if there are none
+func (q *Queue) Tenants() *Tenants {
+	return q.tenants
+}
+
+// Saturated reports whether pending events have reached the high-water mark
+func (q *Queue) Saturated() bool {
+	return len(q.events) >= q.highWater
+}
+
+// SaturatedFor reports whether the queue is saturated or tenant has used up
+// its queue quota
+func (q *Queue) SaturatedFor(tenant string) bool {
+	if q.Saturated() {
 		return true
-	default:
-		q.dropped.Add(1)
-		log.Printf("queue overflow: dropped event %s", event.Name)
-		return false
 	}
+	quota := q.tenants.QueueQuota(tenant)
+	return quota > 0 && q.tenantCounter(&q.pendingByTenant, tenant).Load() >= int64(quota)
+}
+
+// Wait blocks while the queue is saturated, returning ctx.Err() if ctx ends
+// first. Streaming receivers call it before reading more from a connection,
+// so flow control pushes back on the sender instead of events being dropped.
+func (q *Queue) Wait(ctx context.Context) error {
+	return q.wait(ctx, q.Saturated)
+}
+
+// WaitFor blocks like Wait while the queue is saturated for tenant
+func (q *Queue) WaitFor(ctx context.Context, tenant string) error {
+	return q.wait(ctx, func() bool { return q.SaturatedFor(tenant) })
+}
+
+func (q *Queue) wait(ctx context.Context, saturated func() bool) error {
+	// Count as a waiter before checking, so an event leaving the queue
+	// after the check always wakes us
+	q.waiters.Add(1)
+	defer q.waiters.Add(-1)
+
+	for {
+		q.waitMu.Lock()
+		if q.drained == nil {
+			q.drained = make(chan struct{})
+		}
+		drained := q.drained
+		q.waitMu.Unlock()
+
+		if !saturated() {
+			return nil
+		}
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Reject records a request turned away because the queue was saturated
+func (q *Queue) Reject() {
+	q.rejected.Add(1)
+}
+
+// Rejected returns the number of requests turned away while saturated
+func (q *Queue) Rejected() int64 {
+	return q.rejected.Load()
+}
+
+// DroppedByService returns the number of dropped events per service
+func (q *Queue) DroppedByService() map[string]int64 {
+	counts := make(map[string]int64)
+	q.droppedByService.Range(func(key, value any) bool {
+		counts[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return counts
+}
+
+// TenantStats returns the pending and dropped events of every configured
+// tenant and of any other tenant that has sent events
+func (q *Queue) TenantStats() map[string]structs.TenantStats {
+	stats := make(map[string]structs.TenantStats)
+	for _, name := range q.tenants.Names() {
+		stats[name] = structs.TenantStats{
+			RetentionDays: q.tenants.RetentionDays(name),
+			QueueQuota:    q.tenants.QueueQuota(name),
+		}
+	}
+	q.pendingByTenant.Range(func(key, value any) bool {
+		s := stats[key.(string)]
+		s.Pending = value.(*atomic.Int64).Load()
+		stats[key.(string)] = s
+		return true
+	})
+	q.droppedByTenant.Range(func(key, value any) bool {
+		s := stats[key.(string)]
+		s.Dropped = value.(*atomic.Int64).Load()
+		stats[key.(string)] = s
+		return true
+	})
+	return stats
+}
+
+// Sync makes every event enqueued so far durable
+func (q *Queue) Sync() error {
+	if q.wal == nil {
+		return nil
+	}
+	return q.wal.Sync()
+}
+
+// WAL returns the write-ahead log backing the queue, or nil
+func (q *Queue) WAL() *WAL {
+	return q.wal
 }
 
 // Events returns the channel for consuming events
-func (q *Queue) Events() <-chan *structs.Event {
+func (q *Queue) Events() <-chan QueuedEvent {
 	return q.events
 }
 
@@ -47,5 +450,7 @@ func (q *Queue) Stats() (enqueued, dropped int64, pending int) {
 
 // Close closes the queue channel
 func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 	close(q.events)
 }
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestQueueDroppedByServiceCap(t *testing.T) {
+	q := NewQueue(0)
+	for i := 0; i < maxDroppedServices+50; i++ {
+		q.drop(&structs.Event{Service: fmt.Sprintf("svc-%d", i)})
+	}
+	q.drop(&structs.Event{Service: "svc-0"})
+
+	counts := q.DroppedByService()
+	if len(counts) != maxDroppedServices+1 {
+		t.Fatalf("tracked %d services, want %d", len(counts), maxDroppedServices+1)
+	}
+	if counts["svc-0"] != 2 {
+		t.Errorf("svc-0 dropped = %d, want 2", counts["svc-0"])
+	}
+	if counts[otherDroppedServices] != 50 {
+		t.Errorf("other dropped = %d, want 50", counts[otherDroppedServices])
+	}
+}
+
+func TestQueueEnqueueAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		queued      int
+		batch       int
+		wantOK      bool
+		wantPending int
+	}{
+		{"fits", 0, 3, true, 3},
+		{"fills the queue", 1, 2, true, 3},
+		{"one too many", 1, 3, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(3)
+			for i := 0; i < tt.queued; i++ {
+				q.Enqueue(&structs.Event{Service: "api", Name: "queued"})
+			}
+
+			batch := make([]*structs.Event, tt.batch)
+			for i := range batch {
+				batch[i] = &structs.Event{Service: "api", Name: "batch"}
+			}
+			if ok := q.EnqueueAll(batch); ok != tt.wantOK {
+				t.Fatalf("EnqueueAll = %v, want %v", ok, tt.wantOK)
+			}
+
+			_, dropped, pending := q.Stats()
+			if pending != tt.wantPending {
+				t.Fatalf("pending = %d, want %d", pending, tt.wantPending)
+			}
+			if wantDropped := tt.queued + tt.batch - tt.wantPending; dropped != int64(wantDropped) {
+				t.Fatalf("dropped = %d, want %d", dropped, wantDropped)
+			}
+		})
+	}
+}
+
+func TestQueueWait(t *testing.T) {
+	q := NewQueue(1)
+	q.Enqueue(&structs.Event{Service: "api", Name: "queued"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error)
+	go func() { done <- q.Wait(context.Background()) }()
+	qe := <-q.Events()
+	q.dequeued(qe.Event)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return once the queue drained")
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// Redaction actions
+const (
+	RedactDrop = "drop"
+	RedactHash = "hash"
+	RedactMask = "mask"
+)
+
+// defaultRedactionReplacement replaces masked matches when a rule sets none
+const defaultRedactionReplacement = "[REDACTED]"
+
+// Redactor applies redaction rules to event data before events are queued,
+// so sensitive values never reach the write-ahead log or ClickHouse. It is
+// safe for concurrent use; a nil Redactor does nothing.
+type Redactor struct {
+	rules []*redactionRule
+	key   []byte
+}
+
+type redactionRule struct {
+	structs.RedactionRule
+	keys    map[string]bool
+	pattern *regexp.Regexp
+	fired   atomic.Int64
+}
+
+// LoadRedactor reads a JSON rules file. hmacKey keys the hash action and is
+// required if any rule hashes.
+func LoadRedactor(file string, hmacKey []byte) (*Redactor, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var config structs.RedactionConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+	return NewRedactor(config.Rules, hmacKey)
+}
+
+// NewRedactor validates rules and compiles their patterns
+func NewRedactor(rules []structs.RedactionRule, hmacKey []byte) (*Redactor, error) {
+	r := &Redactor{key: hmacKey}
+	names := make(map[string]bool)
+
+	for i, config := range rules {
+		if config.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i+1)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("rule %s: duplicate name", config.Name)
+		}
+		names[config.Name] = true
+
+		rule := &redactionRule{RedactionRule: config, keys: make(map[string]bool)}
+		for _, key := range config.Keys {
+			rule.keys[strings.ToLower(key)] = true
+		}
+		for _, p := range append(append([]string{}, config.Services...), config.Names...) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid scope pattern %q", config.Name, p)
+			}
+		}
+
+		switch config.Action {
+		case RedactDrop, RedactHash:
+			if len(rule.keys) == 0 {
+				return nil, fmt.Errorf("rule %s: %s requires keys", config.Name, config.Action)
+			}
+			if config.Action == RedactHash && len(hmacKey) == 0 {
+				return nil, fmt.Errorf("rule %s: hash requires REDACTION_HMAC_KEY", config.Name)
+			}
+		case RedactMask:
+			if config.Pattern == "" {
+				return nil, fmt.Errorf("rule %s: mask requires a pattern", config.Name)
+			}
+			pattern, err := regexp.Compile(config.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid pattern: %w", config.Name, err)
+			}
+			rule.pattern = pattern
+			if rule.Replacement == "" {
+				rule.Replacement = defaultRedactionReplacement
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: action must be drop, hash or mask", config.Name)
+		}
+
+		r.rules = append(r.rules, rule)
+	}
+
+	if len(r.rules) == 0 {
+		return nil, errors.New("no redaction rules defined")
+	}
+	return r, nil
+}
+
+// Redact applies every rule in scope for the event to its data, in order
+func (r *Redactor) Redact(event *structs.Event) {
+	if r == nil || len(event.Data) == 0 {
+		return
+	}
+	for _, rule := range r.rules {
+		if !rule.inScope(event) {
+			continue
+		}
+		// Without keys, mask checks every string value
+		matched := rule.Action == RedactMask && len(rule.keys) == 0
+		if data, changed := r.redactMap(rule, event.Data, matched); changed {
+			event.Data = data
+			rule.fired.Add(1)
+		}
+	}
+}
+
+// Stats returns how many events each rule has changed, in rule order
+func (r *Redactor) Stats() []structs.RedactionRuleStats {
+	if r == nil {
+		return nil
+	}
+	stats := make([]structs.RedactionRuleStats, len(r.rules))
+	for i, rule := range r.rules {
+		stats[i] = structs.RedactionRuleStats{Name: rule.Name, Action: rule.Action, Fired: rule.fired.Load()}
+	}
+	return stats
+}
+
+// inScope reports whether the rule applies to the event's service and name
+func (rule *redactionRule) inScope(event *structs.Event) bool {
+	return matchesAny(rule.Services, event.Service) && matchesAny(rule.Names, event.Name)
+}
+
+// matchesAny reports whether s matches one of patterns, or patterns is empty
+func matchesAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// redactMap applies a rule to a map and everything nested in it, returning
+// the redacted map and whether anything changed. matched is set inside a
+// value whose key a mask rule names. The map is copied before its first
+// change rather than edited in place, as event data may share nested maps
+// and slices with other events.
+func (r *Redactor) redactMap(rule *redactionRule, m map[string]interface{}, matched bool) (map[string]interface{}, bool) {
+	out, changed := m, false
+	for k, v := range m {
+		keyMatched := rule.keys[strings.ToLower(k)]
+		var nv interface{}
+		switch {
+		case keyMatched && rule.Action == RedactDrop:
+			if !changed {
+				out, changed = maps.Clone(m), true
+			}
+			delete(out, k)
+			continue
+		case keyMatched && rule.Action == RedactHash:
+			if v == nil {
+				continue
+			}
+			nv = r.hash(v)
+		default:
+			var ok bool
+			if nv, ok = r.redactValue(rule, v, matched || keyMatched); !ok {
+				continue
+			}
+		}
+		if !changed {
+			out, changed = maps.Clone(m), true
+		}
+		out[k] = nv
+	}
+	return out, changed
+}
+
+// redactValue applies a rule inside a data value, returning the new value
+// and whether anything changed. Like redactMap, it copies maps and slices
+// instead of changing them.
+func (r *Redactor) redactValue(rule *redactionRule, v interface{}, matched bool) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return r.redactMap(rule, v, matched)
+	case []interface{}:
+		out, changed := v, false
+		for i, item := range v {
+			nv, ok := r.redactValue(rule, item, matched)
+			if !ok {
+				continue
+			}
+			if !changed {
+				out, changed = slices.Clone(v), true
+			}
+			out[i] = nv
+		}
+		return out, changed
+	case string:
+		if !matched || rule.pattern == nil {
+			return v, false
+		}
+		masked := rule.pattern.ReplaceAllLiteralString(v, rule.Replacement)
+		return masked, masked != v
+	default:
+		return v, false
+	}
+}
+
+// hash returns the hex HMAC-SHA256 of a value: the bytes of a string, or the
+// JSON encoding of anything else. Equal values hash alike, so hashed fields
+// can still be grouped and joined on.
+func (r *Redactor) hash(v interface{}) string {
+	mac := hmac.New(sha256.New, r.key)
+	if s, ok := v.(string); ok {
+		mac.Write([]byte(s))
+	} else {
+		b, _ := json.Marshal(v)
+		mac.Write(b)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestRedactCopiesData(t *testing.T) {
+	tests := []struct {
+		name string
+		rule structs.RedactionRule
+		want string
+	}{
+		{
+			"drop",
+			structs.RedactionRule{Name: "r", Action: RedactDrop, Keys: []string{"token"}},
+			`{"user": {"email": "a@example.com"}, "tags": ["a@example.com", {"id": 1}]}`,
+		},
+		{
+			"hash",
+			structs.RedactionRule{Name: "r", Action: RedactHash, Keys: []string{"token"}},
+			`{"user": {"email": "a@example.com", "token": "fd47d0a76038cac7e7529f7f9c9f3c05ab4dc66c7c78a3a14593b836e676f217"}, "tags": ["a@example.com", {"id": 1, "token": "fd47d0a76038cac7e7529f7f9c9f3c05ab4dc66c7c78a3a14593b836e676f217"}]}`,
+		},
+		{
+			"mask",
+			structs.RedactionRule{Name: "r", Action: RedactMask, Pattern: `\S+@\S+`},
+			`{"user": {"email": "[REDACTED]", "token": "t"}, "tags": ["[REDACTED]", {"id": 1, "token": "t"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor([]structs.RedactionRule{tt.rule}, []byte("key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const data = `{"user": {"email": "a@example.com", "token": "t"}, "tags": ["a@example.com", {"id": 1, "token": "t"}]}`
+			var original map[string]interface{}
+			json.Unmarshal([]byte(data), &original)
+			event := &structs.Event{Service: "api", Name: "signup", Data: original}
+			r.Redact(event)
+
+			var before, want map[string]interface{}
+			json.Unmarshal([]byte(data), &before)
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(original, before) {
+				t.Fatalf("redaction changed the original data: %v", original)
+			}
+			if !reflect.DeepEqual(event.Data, want) {
+				t.Fatalf("got %v, want %v", event.Data, want)
+			}
+		})
+	}
+}
+
+func TestRedactSharedOTLPResource(t *testing.T) {
+	// Both records start from the attributes of one resource, so a value
+	// nested in them must be hashed once per event and not twice
+	var req structs.OTLPLogsRequest
+	if err := json.Unmarshal([]byte(`{"resourceLogs": [{
+		"resource": {"attributes": [{"key": "user", "value": {"kvlistValue": {"values": [
+			{"key": "email", "value": {"stringValue": "a@example.com"}}
+		]}}}]},
+		"scopeLogs": [{"logRecords": [{"body": {"stringValue": "one"}}, {"body": {"stringValue": "two"}}]}]
+	}]}`), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRedactor([]structs.RedactionRule{{Name: "email", Action: RedactHash, Keys: []string{"email"}}}, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := OTLPLogsToEvents(&req)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	for _, event := range events {
+		r.Redact(event)
+	}
+
+	want := r.hash("a@example.com")
+	for i, event := range events {
+		user, _ := event.Data["user"].(map[string]interface{})
+		if user["email"] != want {
+			t.Fatalf("event %d: email = %v, want %v", i, user["email"], want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// Sampling actions
+const (
+	SampleDrop = "drop"
+	SampleKeep = "sample"
+)
+
+// Sampler drops or samples events before they are queued, recording the
+// sample rate on the events it keeps so analytics can scale counts back up.
+// It is safe for concurrent use; a nil Sampler keeps everything.
+type Sampler struct {
+	rules []*samplingRule
+}
+
+type samplingRule struct {
+	structs.SamplingRule
+	seen    atomic.Uint64
+	kept    atomic.Int64
+	dropped atomic.Int64
+}
+
+// LoadSampler reads a JSON rules file
+func LoadSampler(file string) (*Sampler, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var config structs.SamplingConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+	return NewSampler(config.Rules)
+}
+
+// NewSampler validates rules
+func NewSampler(rules []structs.SamplingRule) (*Sampler, error) {
+	s := &Sampler{}
+	names := make(map[string]bool)
+
+	for i, config := range rules {
+		if config.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i+1)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("rule %s: duplicate name", config.Name)
+		}
+		names[config.Name] = true
+
+		for _, p := range append(append(append([]string{}, config.Services...), config.Names...), config.Levels...) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid scope pattern %q", config.Name, p)
+			}
+		}
+
+		// Events carry canonical levels, so "WARNING" in a rule means warn
+		levels := make([]string, len(config.Levels))
+		for j, l := range config.Levels {
+			if level, ok := structs.ParseLevel(l); ok {
+				l = level
+			}
+			levels[j] = l
+		}
+		config.Levels = levels
+
+		switch config.Action {
+		case SampleDrop:
+			if config.Rate != 0 || config.By != "" {
+				return nil, fmt.Errorf("rule %s: drop does not take a rate", config.Name)
+			}
+		case SampleKeep:
+			if config.Rate < 1 {
+				return nil, fmt.Errorf("rule %s: sample requires a rate of at least 1", config.Name)
+			}
+			if config.By != "" && config.By != "trace_id" && config.By != "request_id" {
+				return nil, fmt.Errorf("rule %s: by must be trace_id or request_id", config.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: action must be drop or sample", config.Name)
+		}
+
+		s.rules = append(s.rules, &samplingRule{SamplingRule: config})
+	}
+
+	if len(s.rules) == 0 {
+		return nil, errors.New("no sampling rules defined")
+	}
+	return s, nil
+}
+
+// Sample reports whether an event should be kept. The first rule matching the
+// event decides; events no rule matches are kept. A kept event's sample rate
+// is multiplied by the rule's rate, saturating at the largest uint32.
+func (s *Sampler) Sample(event *structs.Event) bool {
+	if s == nil {
+		return true
+	}
+	for _, rule := range s.rules {
+		if !rule.matches(event) {
+			continue
+		}
+		if rule.Action == SampleDrop || !rule.keep(event) {
+			rule.dropped.Add(1)
+			return false
+		}
+		rule.kept.Add(1)
+		event.SampleRate = uint32(min(uint64(max(event.SampleRate, 1))*uint64(rule.Rate), math.MaxUint32))
+		return true
+	}
+	return true
+}
+
+// Stats returns how many events each rule has kept and dropped, in rule order
+func (s *Sampler) Stats() []structs.SamplingRuleStats {
+	if s == nil {
+		return nil
+	}
+	stats := make([]structs.SamplingRuleStats, len(s.rules))
+	for i, rule := range s.rules {
+		stats[i] = structs.SamplingRuleStats{
+			Name:    rule.Name,
+			Action:  rule.Action,
+			Rate:    rule.Rate,
+			Kept:    rule.kept.Load(),
+			Dropped: rule.dropped.Load(),
+		}
+	}
+	return stats
+}
+
+// matches reports whether the rule applies to the event
+func (rule *samplingRule) matches(event *structs.Event) bool {
+	return matchesAny(rule.Services, event.Service) &&
+		matchesAny(rule.Names, event.Name) &&
+		matchesAny(rule.Levels, strings.ToLower(event.Level))
+}
+
+// keep decides whether a sampled event is one of the 1 in Rate kept. Events
+// with the rule's ID are kept when the ID hashes to a multiple of the rate,
+// so every service sampling the same trace at the same rate keeps the same
+// traces.
+func (rule *samplingRule) keep(event *structs.Event) bool {
+	rate := uint64(rule.Rate)
+	if rate == 1 {
+		return true
+	}
+
+	var id string
+	switch rule.By {
+	case "trace_id":
+		id = event.TraceID
+	case "request_id":
+		id = event.RequestID
+	}
+	if id != "" {
+		h := fnv.New64a()
+		h.Write([]byte(strings.ToLower(id)))
+		return h.Sum64()%rate == 0
+	}
+	return (rule.seen.Add(1)-1)%rate == 0
+}
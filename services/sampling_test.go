@@ -0,0 +1,44 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestSampleRate(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxSampleRate uint32
+		clientRate    uint32
+		want          uint32
+	}{
+		{"unset", 0, 0, 10},
+		{"multiplied", 0, 5, 50},
+		{"saturates", 0, math.MaxUint32 / 2, math.MaxUint32},
+		{"capped", 100, 1000, 1000},
+		{"ignored", 1, 1000, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler, err := NewSampler([]structs.SamplingRule{{Name: "all", Action: SampleKeep, Rate: 10}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := NewQueue(1)
+			q.SetSampler(sampler)
+			q.SetMaxClientSampleRate(tt.maxSampleRate)
+
+			// The first event of a rule without by is always kept
+			event := &structs.Event{Service: "api", Name: "request", SampleRate: tt.clientRate}
+			if !q.Enqueue(event) {
+				t.Fatal("enqueue failed")
+			}
+			if event.SampleRate != tt.want {
+				t.Fatalf("sample rate = %d, want %d", event.SampleRate, tt.want)
+			}
+		})
+	}
+}
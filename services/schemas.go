@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// Schema validation modes
+const (
+	SchemaOff     = "off"
+	SchemaWarn    = "warn"
+	SchemaEnforce = "enforce"
+)
+
+// SchemaErrorsKey is the data key under which warn mode lists an event's
+// schema violations
+const SchemaErrorsKey = "_schema_errors"
+
+// ErrSchemaNotFound is returned for a service and name without a schema
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// ErrInvalidSchema marks a schema or mode that cannot be registered
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// SchemaStore persists registered schemas
+type SchemaStore interface {
+	LoadSchemas(ctx context.Context) ([]*structs.EventSchema, error)
+	SaveSchema(ctx context.Context, schema *structs.EventSchema) error
+	DeleteSchema(ctx context.Context, service, name string) error
+}
+
+// SchemaRegistry holds the schemas registered per service and event name and
+// validates event data against them. Changes are written to the store and
+// picked up by other instances when they reload it. It is safe for
+// concurrent use; a nil registry checks nothing.
+type SchemaRegistry struct {
+	store   SchemaStore
+	writeMu sync.Mutex // serializes changes, held across store calls
+	mu      sync.RWMutex
+	schemas map[schemaKey]*registeredSchema
+	warned  atomic.Int64
+	refused atomic.Int64
+}
+
+type schemaKey struct {
+	service string
+	name    string
+}
+
+type registeredSchema struct {
+	structs.EventSchema
+	compiled *JSONSchema
+	checked  atomic.Int64
+	invalid  atomic.Int64
+}
+
+// NewSchemaRegistry creates an empty registry backed by store
+func NewSchemaRegistry(store SchemaStore) *SchemaRegistry {
+	return &SchemaRegistry{
+		store:   store,
+		schemas: make(map[schemaKey]*registeredSchema),
+	}
+}
+
+// Load replaces the registered schemas with those in the store. Counters of
+// schemas that are still registered carry over.
+func (r *SchemaRegistry) Load(ctx context.Context) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	stored, err := r.store.LoadSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	schemas := make(map[schemaKey]*registeredSchema, len(stored))
+	for _, s := range stored {
+		compiled, err := CompileJSONSchema(s.Schema)
+		if err != nil {
+			log.Printf("skipping schema %s/%s: %v", s.Service, s.Name, err)
+			continue
+		}
+		schemas[schemaKey{s.Service, s.Name}] = &registeredSchema{EventSchema: *s, compiled: compiled}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, entry := range schemas {
+		if old, ok := r.schemas[key]; ok {
+			entry.checked.Store(old.checked.Load())
+			entry.invalid.Store(old.invalid.Load())
+		}
+	}
+	r.schemas = schemas
+	return nil
+}
+
+// Run reloads the registry every interval until ctx is cancelled, so changes
+// made through other instances take effect. A zero interval never reloads.
+func (r *SchemaRegistry) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("failed to reload schemas: %v", err)
+			}
+		}
+	}
+}
+
+// List returns the registered schemas, optionally for one service, sorted by
+// service and name
+func (r *SchemaRegistry) List(service string) []*structs.EventSchema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := []*structs.EventSchema{}
+	for key, entry := range r.schemas {
+		if service == "" || key.service == service {
+			list = append(list, entry.snapshot())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Service != list[j].Service {
+			return list[i].Service < list[j].Service
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Get returns the schema registered for a service and event name
+func (r *SchemaRegistry) Get(service, name string) (*structs.EventSchema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.schemas[schemaKey{service, name}]
+	if !ok {
+		return nil, ErrSchemaNotFound
+	}
+	return entry.snapshot(), nil
+}
+
+// Put registers or replaces the schema for a service and event name. The
+// mode defaults to warn.
+func (r *SchemaRegistry) Put(ctx context.Context, service, name string, req *structs.SchemaRequest) (*structs.EventSchema, error) {
+	if service == "" || name == "" {
+		return nil, fmt.Errorf("%w: service and name are required", ErrInvalidSchema)
+	}
+	mode := req.Mode
+	switch mode {
+	case "":
+		mode = SchemaWarn
+	case SchemaOff, SchemaWarn, SchemaEnforce:
+	default:
+		return nil, fmt.Errorf("%w: mode must be off, warn or enforce", ErrInvalidSchema)
+	}
+	if len(req.Schema) == 0 {
+		return nil, fmt.Errorf("%w: schema is required", ErrInvalidSchema)
+	}
+	compiled, err := CompileJSONSchema(req.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	var schema bytes.Buffer
+	if err := json.Compact(&schema, req.Schema); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	now := time.Now().UTC()
+	entry := &registeredSchema{
+		EventSchema: structs.EventSchema{
+			Service:   service,
+			Name:      name,
+			Mode:      mode,
+			Schema:    schema.Bytes(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		compiled: compiled,
+	}
+	key := schemaKey{service, name}
+	r.mu.RLock()
+	old, ok := r.schemas[key]
+	r.mu.RUnlock()
+	if ok {
+		entry.CreatedAt = old.CreatedAt
+	}
+
+	if err := r.store.SaveSchema(ctx, &entry.EventSchema); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if ok {
+		entry.checked.Store(old.checked.Load())
+		entry.invalid.Store(old.invalid.Load())
+	}
+	r.schemas[key] = entry
+	r.mu.Unlock()
+	return entry.snapshot(), nil
+}
+
+// Delete removes the schema for a service and event name
+func (r *SchemaRegistry) Delete(ctx context.Context, service, name string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	key := schemaKey{service, name}
+	r.mu.RLock()
+	_, ok := r.schemas[key]
+	r.mu.RUnlock()
+	if !ok {
+		return ErrSchemaNotFound
+	}
+	if err := r.store.DeleteSchema(ctx, service, name); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	delete(r.schemas, key)
+	r.mu.Unlock()
+	return nil
+}
+
+// Check validates an event's data against the schema for its service and
+// name. In warn mode violations are listed under data._schema_errors; in
+// enforce mode they are returned as an error and the event should be
+// rejected.
+func (r *SchemaRegistry) Check(event *structs.Event) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	entry, ok := r.schemas[schemaKey{event.Service, event.Name}]
+	r.mu.RUnlock()
+	if !ok || entry.Mode == SchemaOff {
+		return nil
+	}
+
+	entry.checked.Add(1)
+	var data interface{} = map[string]interface{}{}
+	if event.Data != nil {
+		data = event.Data
+	}
+	violations := entry.compiled.Validate(data, "data")
+	if len(violations) == 0 {
+		return nil
+	}
+	entry.invalid.Add(1)
+
+	if entry.Mode == SchemaEnforce {
+		r.refused.Add(1)
+		msg := violations[0]
+		if len(violations) > 1 {
+			msg += fmt.Sprintf(" (and %d more)", len(violations)-1)
+		}
+		return fmt.Errorf("schema violation: %s", msg)
+	}
+
+	r.warned.Add(1)
+	if event.Data == nil {
+		event.Data = make(map[string]interface{}, 1)
+	}
+	event.Data[SchemaErrorsKey] = violations
+	return nil
+}
+
+// Stats returns the number of registered schemas and of events tagged and
+// rejected for violating them
+func (r *SchemaRegistry) Stats() (registered int, warned, rejected int64) {
+	r.mu.RLock()
+	registered = len(r.schemas)
+	r.mu.RUnlock()
+	return registered, r.warned.Load(), r.refused.Load()
+}
+
+func (entry *registeredSchema) snapshot() *structs.EventSchema {
+	s := entry.EventSchema
+	s.Checked = entry.checked.Load()
+	s.Invalid = entry.invalid.Load()
+	return &s
+}
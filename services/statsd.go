@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+const (
+	statsdMaxPacketSize = 64 * 1024
+	statsdCounter       = "c"
+	statsdGauge         = "g"
+	statsdSet           = "s"
+)
+
+// statsdTimerTypes are the types aggregated as timers; DogStatsD histograms
+// and distributions are treated the same way
+var statsdTimerTypes = map[string]bool{"ms": true, "h": true, "d": true}
+
+// statsdPercentiles are the upper percentiles emitted for timers
+var statsdPercentiles = []int{90, 95, 99}
+
+// ParseStatsD parses a line such as "api.requests:1|c|@0.5|#route:/users".
+// DogStatsD tags become labels; DogStatsD events and service checks are
+// rejected.
+func ParseStatsD(line []byte) (*structs.StatsDMetric, error) {
+	if bytes.HasPrefix(line, []byte("_e{")) || bytes.HasPrefix(line, []byte("_sc|")) {
+		return nil, errors.New("events and service checks are not supported")
+	}
+
+	name, rest, ok := bytes.Cut(line, []byte(":"))
+	if !ok || len(name) == 0 {
+		return nil, fmt.Errorf("invalid line %q: expected name:value|type", line)
+	}
+	parts := bytes.Split(rest, []byte("|"))
+	if len(parts) < 2 || len(parts[0]) == 0 {
+		return nil, fmt.Errorf("invalid line %q: expected name:value|type", line)
+	}
+
+	m := &structs.StatsDMetric{
+		Name:       sanitizeStatsDName(string(name)),
+		Type:       string(parts[1]),
+		SampleRate: 1,
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("invalid line %q: empty name", line)
+	}
+
+	value := string(parts[0])
+	switch {
+	case m.Type == statsdSet:
+		m.SetMember = value
+	case m.Type == statsdCounter || m.Type == statsdGauge || statsdTimerTypes[m.Type]:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid value %q for %s", value, m.Name)
+		}
+		m.Value = v
+		m.Delta = m.Type == statsdGauge && (value[0] == '+' || value[0] == '-')
+	default:
+		return nil, fmt.Errorf("unsupported type %q for %s", m.Type, m.Name)
+	}
+
+	for _, field := range parts[2:] {
+		switch {
+		case len(field) > 1 && field[0] == '@':
+			rate, err := strconv.ParseFloat(string(field[1:]), 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q for %s", field, m.Name)
+			}
+			m.SampleRate = rate
+		case len(field) > 1 && field[0] == '#':
+			m.Tags = parseStatsDTags(string(field[1:]))
+		}
+	}
+
+	return m, nil
+}
+
+// sanitizeStatsDName cleans a metric name the way statsd does: whitespace
+// becomes "_", "/" becomes "-", and anything else unusual is removed
+func sanitizeStatsDName(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		switch {
+		case c == ' ' || c == '\t':
+			b.WriteByte('_')
+		case c == '/':
+			b.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-', c == '.':
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// parseStatsDTags parses "key:value,flag" DogStatsD tags; tags without a
+// value get an empty one
+func parseStatsDTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(tag, ":")
+		if key = strings.TrimSpace(key); key != "" {
+			tags[dataKey(key)] = value
+		}
+	}
+	return tags
+}
+
+// statsdSeries identifies one aggregate: a name, a type and a set of tags
+type statsdSeries struct {
+	name string
+	tags map[string]string
+}
+
+type statsdTimer struct {
+	statsdSeries
+	values []float64
+	count  float64 // values weighted by their sample rate
+}
+
+type statsdGaugeValue struct {
+	statsdSeries
+	value   float64
+	updated bool
+	seen    time.Time // flush that last reported the gauge
+}
+
+type statsdSetValue struct {
+	statsdSeries
+	members map[string]struct{}
+}
+
+type statsdCounterValue struct {
+	statsdSeries
+	value float64
+}
+
+// StatsDAggregator accumulates StatsD metrics between flushes, as the statsd
+// daemon does: counters are summed, gauges keep their last value, timers are
+// summarized and sets count their unique members
+type StatsDAggregator struct {
+	mu       sync.Mutex
+	counters map[string]*statsdCounterValue
+	gauges   map[string]*statsdGaugeValue
+	timers   map[string]*statsdTimer
+	sets     map[string]*statsdSetValue
+	gaugeTTL time.Duration
+}
+
+// NewStatsDAggregator creates an empty aggregator
+func NewStatsDAggregator() *StatsDAggregator {
+	return &StatsDAggregator{
+		counters: make(map[string]*statsdCounterValue),
+		gauges:   make(map[string]*statsdGaugeValue),
+		timers:   make(map[string]*statsdTimer),
+		sets:     make(map[string]*statsdSetValue),
+	}
+}
+
+// SetGaugeTTL forgets gauges that are not updated for ttl (default: never),
+// so gauges of series that are gone do not accumulate. A relative update to
+// a forgotten gauge starts again from zero.
+func (a *StatsDAggregator) SetGaugeTTL(ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gaugeTTL = ttl
+}
+
+// Add records a metric in the current interval
+func (a *StatsDAggregator) Add(m *structs.StatsDMetric) {
+	key := statsdKey(m.Name, m.Tags)
+	series := statsdSeries{name: m.Name, tags: m.Tags}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case m.Type == statsdCounter:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &statsdCounterValue{statsdSeries: series}
+			a.counters[key] = c
+		}
+		c.value += m.Value / m.SampleRate
+
+	case m.Type == statsdGauge:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &statsdGaugeValue{statsdSeries: series}
+			a.gauges[key] = g
+		}
+		if m.Delta {
+			g.value += m.Value
+		} else {
+			g.value = m.Value
+		}
+		g.updated = true
+
+	case m.Type == statsdSet:
+		s, ok := a.sets[key]
+		if !ok {
+			s = &statsdSetValue{statsdSeries: series, members: make(map[string]struct{})}
+			a.sets[key] = s
+		}
+		s.members[m.SetMember] = struct{}{}
+
+	case statsdTimerTypes[m.Type]:
+		t, ok := a.timers[key]
+		if !ok {
+			t = &statsdTimer{statsdSeries: series}
+			a.timers[key] = t
+		}
+		t.values = append(t.values, m.Value)
+		t.count += 1 / m.SampleRate
+	}
+}
+
+// Flush returns the aggregates of the interval that just ended, stamped with
+// now, and starts a new interval. Counters report the count for the
+// interval; gauges are reported when updated and keep their value for later
+// relative updates until they have been idle for the gauge TTL.
+func (a *StatsDAggregator) Flush(now time.Time) []*structs.Sample {
+	a.mu.Lock()
+	counters, timers, sets := a.counters, a.timers, a.sets
+	a.counters = make(map[string]*statsdCounterValue)
+	a.timers = make(map[string]*statsdTimer)
+	a.sets = make(map[string]*statsdSetValue)
+
+	var samples []*structs.Sample
+	for key, g := range a.gauges {
+		switch {
+		case g.updated:
+			samples = append(samples, g.sample(g.name, g.value, now))
+			g.updated = false
+			g.seen = now
+		case a.gaugeTTL > 0 && now.Sub(g.seen) >= a.gaugeTTL:
+			delete(a.gauges, key)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, c := range counters {
+		samples = append(samples, c.sample(c.name, c.value, now))
+	}
+	for _, s := range sets {
+		samples = append(samples, s.sample(s.name, float64(len(s.members)), now))
+	}
+	for _, t := range timers {
+		samples = append(samples, t.summarize(now)...)
+	}
+
+	return samples
+}
+
+func (s statsdSeries) sample(name string, value float64, now time.Time) *structs.Sample {
+	labels := s.tags
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return &structs.Sample{Timestamp: now, Name: name, Labels: labels, Value: value}
+}
+
+// summarize reports a timer as <name>.count, .sum, .mean, .lower, .upper,
+// .median and .upper_<percentile>
+func (t *statsdTimer) summarize(now time.Time) []*structs.Sample {
+	sort.Float64s(t.values)
+
+	var sum float64
+	for _, v := range t.values {
+		sum += v
+	}
+	n := len(t.values)
+
+	samples := []*structs.Sample{
+		t.sample(t.name+".count", t.count, now),
+		t.sample(t.name+".sum", sum, now),
+		t.sample(t.name+".mean", sum/float64(n), now),
+		t.sample(t.name+".lower", t.values[0], now),
+		t.sample(t.name+".upper", t.values[n-1], now),
+		t.sample(t.name+".median", statsdPercentile(t.values, 50), now),
+	}
+	for _, p := range statsdPercentiles {
+		samples = append(samples, t.sample(fmt.Sprintf("%s.upper_%d", t.name, p), statsdPercentile(t.values, p), now))
+	}
+	return samples
+}
+
+// statsdPercentile returns the nearest-rank percentile of sorted values
+func statsdPercentile(sorted []float64, p int) float64 {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// statsdKey identifies a series by name and sorted tags
+func statsdKey(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte('|')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
+
+// StatsDServer receives StatsD metrics over UDP, aggregates them and writes
+// the aggregates to the metrics batcher every flush interval
+type StatsDServer struct {
+	batcher       *MetricBatcher
+	aggregator    *StatsDAggregator
+	flushInterval time.Duration
+	mu            sync.Mutex
+	packets       []net.PacketConn
+	invalid       int
+	done          chan struct{}
+	flushing      bool
+	wg            sync.WaitGroup
+	unsent        []*structs.Sample // samples the metric queue had no room for
+}
+
+// NewStatsDServer creates a StatsD server that flushes onto batcher
+func NewStatsDServer(batcher *MetricBatcher, flushInterval time.Duration) *StatsDServer {
+	return &StatsDServer{
+		batcher:       batcher,
+		aggregator:    NewStatsDAggregator(),
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+}
+
+// SetGaugeTTL forgets gauges that are not updated for ttl (default: never)
+func (s *StatsDServer) SetGaugeTTL(ttl time.Duration) {
+	s.aggregator.SetGaugeTTL(ttl)
+}
+
+// ListenUDP starts receiving StatsD packets on addr, one or more
+// newline-separated metrics per packet
+func (s *StatsDServer) ListenUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.packets = append(s.packets, conn)
+	startFlusher := !s.flushing
+	s.flushing = true
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveUDP(conn)
+	}()
+
+	if startFlusher {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runFlusher()
+		}()
+	}
+	return nil
+}
+
+// Close stops the listeners and flushes what has been aggregated so far
+func (s *StatsDServer) Close() {
+	s.mu.Lock()
+	for _, conn := range s.packets {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+	s.flush()
+	if len(s.unsent) > 0 {
+		log.Printf("dropped %d statsd samples: metric queue is full", len(s.unsent))
+	}
+}
+
+func (s *StatsDServer) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, statsdMaxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("statsd udp read error: %v", err)
+			continue
+		}
+
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			m, err := ParseStatsD(line)
+			if err != nil {
+				s.mu.Lock()
+				s.invalid++
+				s.mu.Unlock()
+				continue
+			}
+			s.aggregator.Add(m)
+		}
+	}
+}
+
+func (s *StatsDServer) runFlusher() {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+func (s *StatsDServer) flush() {
+	s.mu.Lock()
+	invalid := s.invalid
+	s.invalid = 0
+	s.mu.Unlock()
+	if invalid > 0 {
+		log.Printf("skipped %d invalid statsd lines", invalid)
+	}
+
+	// Samples left over from earlier flushes go first
+	samples := append(s.unsent, s.aggregator.Flush(time.Now().UTC())...)
+
+	// Enqueue a batch at a time so an interval larger than the free space is
+	// partly written now rather than refused whole
+	for len(samples) > 0 {
+		n := s.batcher.Enqueue(samples[:min(len(samples), s.batcher.batchSize)])
+		if n == 0 {
+			break
+		}
+		samples = samples[n:]
+	}
+
+	// Keep the rest for the next flush, up to what the queue can hold
+	if limit := cap(s.batcher.samples); len(samples) > limit {
+		log.Printf("dropped %d statsd samples: metric queue is full", len(samples)-limit)
+		samples = samples[len(samples)-limit:]
+	}
+	s.unsent = samples
+}
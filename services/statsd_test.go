@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestParseStatsD(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want structs.StatsDMetric
+	}{
+		{"counter", "api.requests:1|c", structs.StatsDMetric{Name: "api.requests", Type: "c", Value: 1, SampleRate: 1}},
+		{"sampled counter", "api.requests:2|c|@0.5", structs.StatsDMetric{Name: "api.requests", Type: "c", Value: 2, SampleRate: 0.5}},
+		{"gauge", "queue.depth:-3.5|g", structs.StatsDMetric{Name: "queue.depth", Type: "g", Value: -3.5, Delta: true, SampleRate: 1}},
+		{"absolute gauge", "queue.depth:7|g", structs.StatsDMetric{Name: "queue.depth", Type: "g", Value: 7, SampleRate: 1}},
+		{"timer", "db.query:12.5|ms", structs.StatsDMetric{Name: "db.query", Type: "ms", Value: 12.5, SampleRate: 1}},
+		{"distribution", "db.query:3|d", structs.StatsDMetric{Name: "db.query", Type: "d", Value: 3, SampleRate: 1}},
+		{"set", "users:alice|s", structs.StatsDMetric{Name: "users", Type: "s", SetMember: "alice", SampleRate: 1}},
+		{
+			"dogstatsd tags",
+			"api.requests:1|c|@1|#route:/users,canary",
+			structs.StatsDMetric{Name: "api.requests", Type: "c", Value: 1, SampleRate: 1, Tags: map[string]string{"route": "/users", "canary": ""}},
+		},
+		{"unknown field ignored", "api.requests:1|c|T1700000000", structs.StatsDMetric{Name: "api.requests", Type: "c", Value: 1, SampleRate: 1}},
+		{"name sanitized", "my app/requests$:1|c", structs.StatsDMetric{Name: "my_app-requests", Type: "c", Value: 1, SampleRate: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStatsD([]byte(tt.line))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatsDMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr string
+	}{
+		{"empty", "", "expected name:value|type"},
+		{"no value", "api.requests", "expected name:value|type"},
+		{"no name", ":1|c", "expected name:value|type"},
+		{"no type", "api.requests:1", "expected name:value|type"},
+		{"empty value", "api.requests:|c", "expected name:value|type"},
+		{"name of invalid characters", "$$$:1|c", "empty name"},
+		{"unknown type", "api.requests:1|x", `unsupported type "x"`},
+		{"value not a number", "api.requests:one|c", `invalid value "one"`},
+		{"infinite value", "api.requests:Inf|g", `invalid value "Inf"`},
+		{"nan value", "api.requests:NaN|ms", `invalid value "NaN"`},
+		{"zero sample rate", "api.requests:1|c|@0", "invalid sample rate"},
+		{"sample rate above one", "api.requests:1|c|@2", "invalid sample rate"},
+		{"sample rate not a number", "api.requests:1|c|@x", "invalid sample rate"},
+		{"event", "_e{5,4}:title|text", "not supported"},
+		{"service check", "_sc|redis|0", "not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStatsD([]byte(tt.line))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatsDAggregatorGaugeTTL(t *testing.T) {
+	a := NewStatsDAggregator()
+	a.SetGaugeTTL(time.Minute)
+	start := time.Unix(1700000000, 0)
+
+	a.Add(&structs.StatsDMetric{Name: "queue.depth", Type: statsdGauge, Value: 5, SampleRate: 1})
+	if samples := a.Flush(start); len(samples) != 1 || samples[0].Value != 5 {
+		t.Fatalf("first flush = %+v, want one sample of 5", samples)
+	}
+
+	// An idle gauge keeps its value for relative updates until the TTL
+	a.Flush(start.Add(30 * time.Second))
+	a.Add(&structs.StatsDMetric{Name: "queue.depth", Type: statsdGauge, Value: 1, Delta: true, SampleRate: 1})
+	if samples := a.Flush(start.Add(40 * time.Second)); len(samples) != 1 || samples[0].Value != 6 {
+		t.Fatalf("flush before the ttl = %+v, want one sample of 6", samples)
+	}
+
+	// After it the gauge is forgotten, and a relative update starts from zero
+	a.Flush(start.Add(100 * time.Second))
+	if len(a.gauges) != 0 {
+		t.Fatalf("%d gauges left after the ttl, want 0", len(a.gauges))
+	}
+	a.Add(&structs.StatsDMetric{Name: "queue.depth", Type: statsdGauge, Value: 1, Delta: true, SampleRate: 1})
+	if samples := a.Flush(start.Add(110 * time.Second)); len(samples) != 1 || samples[0].Value != 1 {
+		t.Fatalf("flush after the ttl = %+v, want one sample of 1", samples)
+	}
+}
+
+func TestStatsDServerFlushQueueFull(t *testing.T) {
+	batcher := NewMetricBatcher(nil, 4, 2, time.Second)
+	s := NewStatsDServer(batcher, time.Second)
+	for i := 0; i < 5; i++ {
+		s.aggregator.Add(&structs.StatsDMetric{Name: fmt.Sprintf("requests.%d", i), Type: statsdCounter, Value: 1, SampleRate: 1})
+	}
+
+	// The queue takes what fits and the rest waits for the next flush
+	s.flush()
+	if _, _, pending := batcher.Stats(); pending != 4 || len(s.unsent) != 1 {
+		t.Fatalf("pending = %d, unsent = %d, want 4 and 1", pending, len(s.unsent))
+	}
+
+	for i := 0; i < 4; i++ {
+		<-batcher.samples
+	}
+	s.flush()
+	if _, _, pending := batcher.Stats(); pending != 1 || len(s.unsent) != 0 {
+		t.Fatalf("pending = %d, unsent = %d, want 1 and 0", pending, len(s.unsent))
+	}
+}
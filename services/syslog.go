@@ -0,0 +1,584 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+const (
+	syslogMaxMessageSize  = 64 * 1024
+	syslogDefaultPriority = 13 // user.notice, as RFC 3164 assigns to messages without a PRI
+	syslogDefaultService  = "syslog"
+	syslogDefaultName     = "syslog"
+	syslogNilValue        = "-"
+	syslogBOM             = "\xef\xbb\xbf"
+)
+
+// syslogFacilities names facility codes 0-23
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogSeverities names severity codes 0-7
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogLevels maps severity codes 0-7 onto event levels
+var syslogLevels = []string{"fatal", "fatal", "fatal", "error", "warn", "info", "info", "debug"}
+
+// ParseSyslog parses an RFC 5424 or RFC 3164 message. RFC 5424 messages are
+// recognised by the version number that follows the PRI.
+func ParseSyslog(b []byte) (*structs.SyslogMessage, error) {
+	b = bytes.TrimRight(b, "\r\n\x00")
+	if len(b) == 0 {
+		return nil, errors.New("empty message")
+	}
+
+	pri, rest, err := parseSyslogPriority(b)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &structs.SyslogMessage{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+
+	if isRFC5424(rest) {
+		if err := parseRFC5424(msg, rest); err != nil {
+			return nil, err
+		}
+	} else {
+		parseRFC3164(msg, rest, time.Now())
+	}
+
+	return msg, nil
+}
+
+// SyslogToEvent maps a syslog message onto an event. Messages without a
+// timestamp are stamped with received; source is the sender's address.
+func SyslogToEvent(msg *structs.SyslogMessage, received time.Time, source string) *structs.Event {
+	event := &structs.Event{
+		Timestamp: received,
+		Service:   msg.AppName,
+		Name:      msg.MsgID,
+		Level:     syslogLevels[msg.Severity],
+		Data:      make(map[string]interface{}),
+	}
+	if !msg.Timestamp.IsZero() {
+		event.Timestamp = msg.Timestamp.UTC()
+	}
+	if event.Service == "" {
+		event.Service = syslogDefaultService
+	}
+	if event.Name == "" {
+		event.Name = syslogDefaultName
+	}
+
+	for id, params := range msg.StructuredData {
+		for name, value := range params {
+			event.Data[dataKey(id+"_"+name)] = value
+		}
+	}
+
+	event.Data["facility"] = syslogFacilities[msg.Facility]
+	event.Data["severity"] = syslogSeverities[msg.Severity]
+	if msg.Hostname != "" {
+		event.Data["hostname"] = msg.Hostname
+	}
+	if msg.ProcID != "" {
+		event.Data["proc_id"] = msg.ProcID
+	}
+	if source != "" {
+		event.Data["source_ip"] = source
+	}
+	if msg.Message != "" {
+		event.Data["message"] = msg.Message
+	}
+
+	return event
+}
+
+func parseSyslogPriority(b []byte) (int, []byte, error) {
+	if b[0] != '<' {
+		return syslogDefaultPriority, b, nil
+	}
+
+	end := bytes.IndexByte(b, '>')
+	if end < 2 || end > 4 {
+		return 0, nil, errors.New("invalid PRI")
+	}
+	for _, c := range b[1:end] {
+		if c < '0' || c > '9' {
+			return 0, nil, fmt.Errorf("invalid PRI %q", b[1:end])
+		}
+	}
+	pri, _ := strconv.Atoi(string(b[1:end]))
+	if pri > 191 {
+		return 0, nil, fmt.Errorf("invalid PRI %d", pri)
+	}
+
+	return pri, b[end+1:], nil
+}
+
+// isRFC5424 reports whether b (the message after its PRI) starts with a
+// version number followed by a space
+func isRFC5424(b []byte) bool {
+	i := 0
+	for i < len(b) && i < 3 && b[i] >= '0' && b[i] <= '9' {
+		i++
+	}
+	return i > 0 && i < len(b) && b[i] == ' '
+}
+
+// parseRFC5424 parses VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(msg *structs.SyslogMessage, b []byte) error {
+	fields := bytes.SplitN(b, []byte(" "), 7)
+	if len(fields) < 6 {
+		return errors.New("truncated RFC 5424 header")
+	}
+	if string(fields[0]) != "1" {
+		return fmt.Errorf("unsupported syslog version %q", fields[0])
+	}
+
+	if ts := syslogField(fields[1]); ts != "" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", ts)
+		}
+		msg.Timestamp = t
+	}
+	msg.Hostname = syslogField(fields[2])
+	msg.AppName = syslogField(fields[3])
+	msg.ProcID = syslogField(fields[4])
+	msg.MsgID = syslogField(fields[5])
+
+	if len(fields) < 7 {
+		return nil
+	}
+
+	sd, rest, err := parseStructuredData(fields[6])
+	if err != nil {
+		return err
+	}
+	msg.StructuredData = sd
+	msg.Message = syslogText(rest)
+
+	return nil
+}
+
+// parseStructuredData parses RFC 5424 SD-ELEMENTs ([id name="value" ...])
+// and returns the remaining message
+func parseStructuredData(b []byte) (map[string]map[string]string, []byte, error) {
+	if len(b) == 0 {
+		return nil, b, nil
+	}
+	if b[0] == '-' {
+		return nil, bytes.TrimPrefix(b[1:], []byte(" ")), nil
+	}
+	if b[0] != '[' {
+		return nil, nil, errors.New("invalid structured data")
+	}
+
+	sd := make(map[string]map[string]string)
+	for len(b) > 0 && b[0] == '[' {
+		b = b[1:]
+
+		end := bytes.IndexAny(b, " ]")
+		if end <= 0 {
+			return nil, nil, errors.New("invalid structured data: missing SD-ID")
+		}
+		id := string(b[:end])
+		b = b[end:]
+
+		params := sd[id]
+		if params == nil {
+			params = make(map[string]string)
+			sd[id] = params
+		}
+
+		for len(b) > 0 && b[0] == ' ' {
+			b = b[1:]
+
+			eq := bytes.IndexByte(b, '=')
+			if eq <= 0 || eq+1 >= len(b) || b[eq+1] != '"' {
+				return nil, nil, fmt.Errorf("invalid structured data: malformed param in %q", id)
+			}
+			name := string(b[:eq])
+			b = b[eq+2:]
+
+			// PARAM-VALUE escapes '"', '\' and ']' with a backslash
+			var value []byte
+			closed := false
+			for i := 0; i < len(b); i++ {
+				c := b[i]
+				if c == '\\' && i+1 < len(b) && (b[i+1] == '"' || b[i+1] == '\\' || b[i+1] == ']') {
+					value = append(value, b[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					b = b[i+1:]
+					closed = true
+					break
+				}
+				value = append(value, c)
+			}
+			if !closed {
+				return nil, nil, fmt.Errorf("invalid structured data: unterminated value for %s", name)
+			}
+			params[name] = string(value)
+		}
+
+		if len(b) == 0 || b[0] != ']' {
+			return nil, nil, fmt.Errorf("invalid structured data: unterminated element %q", id)
+		}
+		b = b[1:]
+	}
+
+	return sd, bytes.TrimPrefix(b, []byte(" ")), nil
+}
+
+// parseRFC3164 parses [TIMESTAMP HOSTNAME] [TAG[PID]:] MSG. RFC 3164 has no
+// fixed format, so every part is optional and anything unrecognised becomes
+// part of the message.
+func parseRFC3164(msg *structs.SyslogMessage, b []byte, now time.Time) {
+	b = bytes.TrimLeft(b, " ")
+
+	if len(b) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, string(b[:len(time.Stamp)]), time.Local); err == nil {
+			msg.Timestamp = syslogYear(t, now)
+			b = b[len(time.Stamp):]
+		}
+	}
+	if msg.Timestamp.IsZero() {
+		// Some senders use an RFC 3339 timestamp in an otherwise RFC 3164 message
+		token, rest := syslogToken(b)
+		if t, err := time.Parse(time.RFC3339Nano, token); err == nil {
+			msg.Timestamp = t
+			b = rest
+		}
+	}
+
+	// The hostname follows the timestamp, but is often left out; a token
+	// ending in ':' is the tag instead
+	if !msg.Timestamp.IsZero() {
+		token, rest := syslogToken(b)
+		if token != "" && !strings.HasSuffix(token, ":") && !strings.Contains(token, "[") {
+			msg.Hostname = token
+			b = rest
+		}
+	}
+
+	msg.AppName, msg.ProcID, b = parseSyslogTag(b)
+	msg.Message = syslogText(b)
+}
+
+// parseSyslogTag splits "app[pid]: message" into its parts, returning b
+// unchanged when it does not start with a tag
+func parseSyslogTag(b []byte) (app, pid string, rest []byte) {
+	b = bytes.TrimLeft(b, " ")
+
+	i := 0
+	for i < len(b) && i < 48 && b[i] != ':' && b[i] != '[' && b[i] != ' ' {
+		i++
+	}
+	if i == 0 || i >= len(b) {
+		return "", "", b
+	}
+
+	tag := string(b[:i])
+	rest = b[i:]
+	if rest[0] == '[' {
+		end := bytes.IndexByte(rest, ']')
+		if end < 0 {
+			return "", "", b
+		}
+		pid = string(rest[1:end])
+		rest = rest[end+1:]
+	}
+	if len(rest) > 0 && rest[0] == ':' {
+		rest = rest[1:]
+	} else if pid == "" {
+		return "", "", b
+	}
+
+	return tag, pid, bytes.TrimPrefix(rest, []byte(" "))
+}
+
+// syslogYear places a year-less RFC 3164 timestamp in the current year, or
+// the previous one if that would put it more than a day in the future
+func syslogYear(t, now time.Time) time.Time {
+	t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+func syslogToken(b []byte) (string, []byte) {
+	b = bytes.TrimLeft(b, " ")
+	end := bytes.IndexByte(b, ' ')
+	if end < 0 {
+		return string(b), nil
+	}
+	return string(b[:end]), b[end+1:]
+}
+
+func syslogField(b []byte) string {
+	if string(b) == syslogNilValue {
+		return ""
+	}
+	return string(b)
+}
+
+func syslogText(b []byte) string {
+	s := strings.TrimPrefix(string(b), syslogBOM)
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "\uFFFD")
+	}
+	return s
+}
+
+// readSyslogFrame reads one message from a TCP stream, supporting both
+// octet-counted and newline-delimited framing (RFC 6587)
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c := first[0]; {
+		case c >= '1' && c <= '9':
+			// Octet counting: MSG-LEN SP SYSLOG-MSG
+			digits, err := r.ReadSlice(' ')
+			if err != nil || len(digits) > 8 {
+				return nil, errors.New("invalid octet count")
+			}
+			n, err := strconv.Atoi(string(digits[:len(digits)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid octet count %q", digits)
+			}
+			if n > syslogMaxMessageSize {
+				return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", n, syslogMaxMessageSize)
+			}
+			frame := make([]byte, n)
+			_, err = io.ReadFull(r, frame)
+			return frame, err
+
+		case c == '\n' || c == '\r' || c == 0:
+			r.ReadByte()
+
+		default:
+			// Non-transparent framing: each message ends with LF
+			line, err := r.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				return nil, fmt.Errorf("message exceeds the %d byte limit", syslogMaxMessageSize)
+			}
+			frame := append([]byte(nil), bytes.TrimRight(line, "\r\n\x00")...)
+			if err == io.EOF && len(frame) > 0 {
+				return frame, nil
+			}
+			return frame, err
+		}
+	}
+}
+
+// SyslogServer receives syslog messages over UDP and TCP and enqueues them as events
+type SyslogServer struct {
+	queue     *Queue
+	schemas   *SchemaRegistry
+	mu        sync.Mutex
+	closed    bool
+	ctx       context.Context // cancelled by Close
+	cancel    context.CancelFunc
+	packets   []net.PacketConn
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// NewSyslogServer creates a syslog server that enqueues onto queue
+func NewSyslogServer(queue *Queue) *SyslogServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SyslogServer{
+		queue:  queue,
+		ctx:    ctx,
+		cancel: cancel,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// SetSchemas configures the event schemas messages are checked against
+func (s *SyslogServer) SetSchemas(schemas *SchemaRegistry) {
+	s.schemas = schemas
+}
+
+// ListenUDP starts receiving one message per datagram on addr
+func (s *SyslogServer) ListenUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.packets = append(s.packets, conn)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveUDP(conn)
+	}()
+	return nil
+}
+
+// ListenTCP starts accepting syslog connections on addr
+func (s *SyslogServer) ListenTCP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveTCP(listener)
+	}()
+	return nil
+}
+
+// Close stops the listeners and open connections, and waits until every
+// message already received has been enqueued
+func (s *SyslogServer) Close() {
+	s.cancel()
+	s.mu.Lock()
+	s.closed = true
+	for _, conn := range s.packets {
+		conn.Close()
+	}
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *SyslogServer) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, syslogMaxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("syslog udp read error: %v", err)
+			continue
+		}
+		s.handle(buf[:n], addr)
+	}
+}
+
+func (s *SyslogServer) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("syslog tcp accept error: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *SyslogServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, syslogMaxMessageSize)
+	for {
+		frame, err := readSyslogFrame(r)
+		if len(frame) > 0 {
+			s.queue.Wait(s.ctx)
+			s.handle(frame, conn.RemoteAddr())
+
+			// Make events durable once the sender has nothing more buffered
+			if r.Buffered() == 0 {
+				if err := s.queue.Sync(); err != nil {
+					log.Printf("failed to sync wal: %v", err)
+				}
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog connection from %s closed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+func (s *SyslogServer) handle(b []byte, addr net.Addr) {
+	source, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		source = addr.String()
+	}
+
+	msg, err := ParseSyslog(b)
+	if err != nil {
+		log.Printf("invalid syslog message from %s: %v", source, err)
+		return
+	}
+
+	event := SyslogToEvent(msg, time.Now().UTC(), source)
+	if err := PrepareEvent(event, nil, s.schemas, nil); err != nil {
+		log.Printf("invalid syslog event from %s: %v", source, err)
+		return
+	}
+
+	s.queue.Enqueue(event)
+}
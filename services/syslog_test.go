@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want structs.SyslogMessage
+	}{
+		{
+			"rfc 5424",
+			`<165>1 2024-01-02T03:04:05.5Z host app 42 ID47 [origin ip="10.0.0.1"][meta a="x\"y\]z" b="\\"] hello`,
+			structs.SyslogMessage{
+				Facility:  20,
+				Severity:  5,
+				Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC),
+				Hostname:  "host",
+				AppName:   "app",
+				ProcID:    "42",
+				MsgID:     "ID47",
+				StructuredData: map[string]map[string]string{
+					"origin": {"ip": "10.0.0.1"},
+					"meta":   {"a": `x"y]z`, "b": `\`},
+				},
+				Message: "hello",
+			},
+		},
+		{
+			"rfc 5424 nil values",
+			"<14>1 - - - - - -",
+			structs.SyslogMessage{Facility: 1, Severity: 6},
+		},
+		{
+			"rfc 5424 without structured data",
+			"<14>1 - host app - -",
+			structs.SyslogMessage{Facility: 1, Severity: 6, Hostname: "host", AppName: "app"},
+		},
+		{
+			"rfc 5424 message with bom",
+			"<14>1 - - - - - - \xef\xbb\xbfhi\xff\r\n",
+			structs.SyslogMessage{Facility: 1, Severity: 6, Message: "hi�"},
+		},
+		{
+			"rfc 3164 tag and pid",
+			"<13>sshd[123]: accepted",
+			structs.SyslogMessage{Facility: 1, Severity: 5, AppName: "sshd", ProcID: "123", Message: "accepted"},
+		},
+		{
+			"no priority",
+			"plain message",
+			structs.SyslogMessage{Facility: 1, Severity: 5, Message: "plain message"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSyslog([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyslogMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{"empty", "\r\n", "empty message"},
+		{"empty priority", "<>1 - - - - - -", "invalid PRI"},
+		{"unterminated priority", "<13 message", "invalid PRI"},
+		{"priority too long", "<0013>message", "invalid PRI"},
+		{"priority not a number", "<1a>message", "invalid PRI"},
+		{"priority out of range", "<192>message", "invalid PRI 192"},
+		{"unsupported version", "<13>2 - - - - - -", "unsupported syslog version"},
+		{"truncated header", "<13>1 - host app", "truncated RFC 5424 header"},
+		{"invalid timestamp", "<13>1 yesterday - - - - -", "invalid timestamp"},
+		{"structured data without brackets", "<13>1 - - - - - id a=\"b\"", "invalid structured data"},
+		{"missing sd-id", "<13>1 - - - - - [ a=\"b\"]", "missing SD-ID"},
+		{"unquoted param", "<13>1 - - - - - [id a=b]", "malformed param"},
+		{"unterminated value", "<13>1 - - - - - [id a=\"b]", "unterminated value"},
+		{"unterminated element", "<13>1 - - - - - [id a=\"b\"", "unterminated element"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSyslog([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRFC3164(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name string
+		in   string
+		want structs.SyslogMessage
+	}{
+		{
+			"timestamp host and tag",
+			"Jan  2 10:00:00 web01 nginx: GET /",
+			structs.SyslogMessage{Timestamp: time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local), Hostname: "web01", AppName: "nginx", Message: "GET /"},
+		},
+		{
+			"timestamp from last year",
+			"Dec 31 23:00:00 web01 cron[7]: run",
+			structs.SyslogMessage{Timestamp: time.Date(2023, 12, 31, 23, 0, 0, 0, time.Local), Hostname: "web01", AppName: "cron", ProcID: "7", Message: "run"},
+		},
+		{
+			"timestamp without host",
+			"Jan  2 10:00:00 nginx: GET /",
+			structs.SyslogMessage{Timestamp: time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local), AppName: "nginx", Message: "GET /"},
+		},
+		{
+			"rfc 3339 timestamp",
+			"2024-01-02T10:00:00Z web01 app: hi",
+			structs.SyslogMessage{Timestamp: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), Hostname: "web01", AppName: "app", Message: "hi"},
+		},
+		{
+			"unterminated pid",
+			"app[12: hi",
+			structs.SyslogMessage{Message: "app[12: hi"},
+		},
+		{
+			"no tag",
+			"just some text",
+			structs.SyslogMessage{Message: "just some text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got structs.SyslogMessage
+			parseRFC3164(&got, []byte(tt.in), now)
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Fatalf("timestamp = %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp = tt.want.Timestamp
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"newline framing", "<13>a\n<13>b\r\n", []string{"<13>a", "<13>b"}, false},
+		{"last line without newline", "<13>a\n<13>b", []string{"<13>a", "<13>b"}, false},
+		{"octet counting", "5 <13>a7 <13>b\nc", []string{"<13>a", "<13>b\nc"}, false},
+		{"mixed framing", "5 <13>a\n<13>b\n", []string{"<13>a", "<13>b"}, false},
+		{"truncated octet count frame", "9 <13>a", nil, true},
+		{"octet count over limit", "70000 x", nil, true},
+		{"octet count too long", "123456789 x", nil, true},
+		{"octet count without a space", "123456789", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.in), syslogMaxMessageSize)
+			var got []string
+			var err error
+			for {
+				var frame []byte
+				frame, err = readSyslogFrame(r)
+				if err != nil {
+					break
+				}
+				got = append(got, string(frame))
+			}
+			if tt.wantErr == (err == io.EOF) {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
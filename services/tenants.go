@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// maxRetentionDays bounds a tenant's retention to ten years
+const maxRetentionDays = 3650
+
+var tenantNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Tenants maps API keys onto tenants and holds each tenant's retention and
+// queue quota. A nil registry has only the default tenant.
+type Tenants struct {
+	byKey  map[string]string
+	byName map[string]*structs.Tenant
+}
+
+type tenantContextKey struct{}
+
+// LoadTenants reads a tenants file
+func LoadTenants(file string) (*Tenants, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var config structs.TenantConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid tenants file: %w", err)
+	}
+	return NewTenants(config.Tenants)
+}
+
+// NewTenants validates tenants. A tenant named "default" sets the retention
+// and quota of the default tenant; it may list API keys of its own.
+func NewTenants(tenants []structs.Tenant) (*Tenants, error) {
+	t := &Tenants{
+		byKey:  make(map[string]string),
+		byName: make(map[string]*structs.Tenant, len(tenants)),
+	}
+
+	for i := range tenants {
+		tenant := tenants[i]
+		if tenant.Name == "" {
+			return nil, fmt.Errorf("tenant %d: name is required", i+1)
+		}
+		if !tenantNameRegex.MatchString(tenant.Name) {
+			return nil, fmt.Errorf("tenant %s: name must be lowercase letters, digits, '-' or '_'", tenant.Name)
+		}
+		if _, ok := t.byName[tenant.Name]; ok {
+			return nil, fmt.Errorf("tenant %s: duplicate name", tenant.Name)
+		}
+		if len(tenant.APIKeys) == 0 && tenant.Name != structs.DefaultTenant {
+			return nil, fmt.Errorf("tenant %s: at least one API key is required", tenant.Name)
+		}
+		if tenant.RetentionDays > maxRetentionDays {
+			return nil, fmt.Errorf("tenant %s: retention_days must be at most %d", tenant.Name, maxRetentionDays)
+		}
+		if tenant.QueueQuota < 0 {
+			return nil, fmt.Errorf("tenant %s: queue_quota must not be negative", tenant.Name)
+		}
+		for _, scope := range tenant.Scopes {
+			if !slices.Contains(structs.Scopes, scope) {
+				return nil, fmt.Errorf("tenant %s: scope %q must be one of %v", tenant.Name, scope, structs.Scopes)
+			}
+		}
+		if len(tenant.Scopes) == 0 {
+			tenant.Scopes = []string{structs.ScopeIngest, structs.ScopeQuery}
+		}
+		for _, key := range tenant.APIKeys {
+			if key == "" {
+				return nil, fmt.Errorf("tenant %s: API keys must not be empty", tenant.Name)
+			}
+			if owner, ok := t.byKey[key]; ok {
+				return nil, fmt.Errorf("tenant %s: API key already belongs to tenant %s", tenant.Name, owner)
+			}
+			t.byKey[key] = tenant.Name
+		}
+		t.byName[tenant.Name] = &tenant
+	}
+	return t, nil
+}
+
+// Lookup returns the tenant an API key belongs to
+func (t *Tenants) Lookup(key string) (string, bool) {
+	if t == nil || key == "" {
+		return "", false
+	}
+	name, ok := t.byKey[key]
+	return name, ok
+}
+
+// Len returns the number of configured tenants
+func (t *Tenants) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.byName)
+}
+
+// Names returns the configured tenants and the default tenant, sorted
+func (t *Tenants) Names() []string {
+	names := []string{structs.DefaultTenant}
+	if t != nil {
+		for name := range t.byName {
+			if name != structs.DefaultTenant {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RetentionDays returns how many days a tenant's data is kept, or zero for
+// the table default
+func (t *Tenants) RetentionDays(tenant string) uint16 {
+	if t == nil {
+		return 0
+	}
+	if config, ok := t.byName[tenant]; ok {
+		return config.RetentionDays
+	}
+	return 0
+}
+
+// QueueQuota returns how many of a tenant's events may be queued at once, or
+// zero for no quota
+func (t *Tenants) QueueQuota(tenant string) int {
+	if t == nil {
+		return 0
+	}
+	if config, ok := t.byName[tenant]; ok {
+		return config.QueueQuota
+	}
+	return 0
+}
+
+// Scopes returns what a tenant's API keys may be used for
+func (t *Tenants) Scopes(tenant string) []string {
+	if t != nil {
+		if config, ok := t.byName[tenant]; ok {
+			return config.Scopes
+		}
+	}
+	return []string{structs.ScopeIngest, structs.ScopeQuery}
+}
+
+// WithTenant returns a context carrying the tenant a request belongs to
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant a request belongs to, or the default
+// tenant when none was set
+func TenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantContextKey{}).(string); ok && tenant != "" {
+		return tenant
+	}
+	return structs.DefaultTenant
+}
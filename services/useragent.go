@@ -0,0 +1,146 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+// uaBrowsers maps product tokens to browser names, most specific first:
+// Edge, Opera and most other browsers also send Chrome/ and Safari/
+var uaBrowsers = []struct {
+	token string
+	name  string
+}{
+	{"EdgiOS/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"Edg/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPiOS/", "Opera"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"UCBrowser/", "UC Browser"},
+	{"Vivaldi/", "Vivaldi"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+	{"MSIE ", "Internet Explorer"},
+}
+
+// uaBotMarkers identify crawlers, monitors and HTTP libraries (lowercase)
+var uaBotMarkers = []string{"bot", "crawler", "spider", "slurp", "headless", "curl/", "wget/", "python-", "go-http-client", "java/", "libwww"}
+
+// uaWindowsVersions maps Windows NT versions to marketing names
+var uaWindowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.2":  "XP",
+	"5.1":  "XP",
+}
+
+// ParseUserAgent recognises the common browsers, operating systems and
+// crawlers from a User-Agent header
+func ParseUserAgent(ua string) *structs.UserAgent {
+	result := &structs.UserAgent{}
+	if ua == "" {
+		return result
+	}
+
+	parseUABrowser(ua, result)
+	parseUAOS(ua, result)
+
+	switch {
+	case result.Device == "bot":
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		result.Device = "tablet"
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		result.Device = "mobile"
+	default:
+		result.Device = "desktop"
+	}
+	return result
+}
+
+func parseUABrowser(ua string, result *structs.UserAgent) {
+	lower := strings.ToLower(ua)
+	for _, marker := range uaBotMarkers {
+		i := strings.Index(lower, marker)
+		if i < 0 {
+			continue
+		}
+		// Name the bot after the product token containing the marker
+		start := strings.LastIndexAny(ua[:i], " ;(") + 1
+		end := i + strings.IndexAny(ua[i:]+" ", " ;)")
+		name, version, _ := strings.Cut(ua[start:end], "/")
+		result.Browser = name
+		result.BrowserVersion = uaVersionPrefix(version)
+		result.Device = "bot"
+		return
+	}
+
+	for _, b := range uaBrowsers {
+		if version, ok := uaVersion(ua, b.token); ok {
+			result.Browser = b.name
+			result.BrowserVersion = version
+			return
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "Trident/"):
+		result.Browser = "Internet Explorer"
+		result.BrowserVersion, _ = uaVersion(ua, "rv:")
+	case strings.Contains(ua, "Safari/"):
+		result.Browser = "Safari"
+		result.BrowserVersion, _ = uaVersion(ua, "Version/")
+	}
+}
+
+func parseUAOS(ua string, result *structs.UserAgent) {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		result.OS = "Windows"
+		if nt, ok := uaVersion(ua, "Windows NT "); ok {
+			result.OSVersion = uaWindowsVersions[nt]
+		}
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		result.OS = "iOS"
+		result.OSVersion, _ = uaVersion(ua, " OS ")
+	case strings.Contains(ua, "Android"):
+		result.OS = "Android"
+		result.OSVersion, _ = uaVersion(ua, "Android ")
+	case strings.Contains(ua, "CrOS"):
+		result.OS = "ChromeOS"
+	case strings.Contains(ua, "Mac OS X"):
+		result.OS = "macOS"
+		result.OSVersion, _ = uaVersion(ua, "Mac OS X ")
+	case strings.Contains(ua, "Linux"):
+		result.OS = "Linux"
+	}
+}
+
+// uaVersion returns the version number that follows token, with underscores
+// (as in "Mac OS X 10_15_7") turned into dots
+func uaVersion(ua, token string) (string, bool) {
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return "", false
+	}
+	return uaVersionPrefix(ua[i+len(token):]), true
+}
+
+// uaVersionPrefix returns the leading run of digits, dots and underscores of s
+func uaVersionPrefix(s string) string {
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == '_') {
+		end++
+	}
+	return strings.TrimRight(strings.ReplaceAll(s[:end], "_", "."), ".")
+}
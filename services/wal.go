@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aidenappl/monitor-core/structs"
+)
+
+const (
+	walSegmentPrefix  = "wal-"
+	walSegmentSuffix  = ".log"
+	walCheckpointFile = "checkpoint"
+
+	// walHeaderSize is the per-entry header: 4 bytes length + 4 bytes CRC32
+	walHeaderSize = 8
+
+	// walMaxEntrySize guards against reading a corrupt length prefix
+	walMaxEntrySize = 16 * 1024 * 1024
+)
+
+// WALPosition identifies the end of an entry in the write-ahead log
+type WALPosition struct {
+	Segment uint64
+	Offset  int64
+}
+
+// Before reports whether p comes strictly before other
+func (p WALPosition) Before(other WALPosition) bool {
+	if p.Segment != other.Segment {
+		return p.Segment < other.Segment
+	}
+	return p.Offset < other.Offset
+}
+
+// WAL is a segmented, append-only write-ahead log of accepted events.
+// Events are appended before the ingest request returns and the log is
+// truncated only after the batcher has written them to ClickHouse.
+type WAL struct {
+	dir            string
+	maxSegmentSize int64
+
+	mu        sync.Mutex
+	file      *os.File
+	segment   uint64
+	offset    int64
+	committed WALPosition
+}
+
+// OpenWAL opens (or creates) a write-ahead log in dir.
+// Existing segments are left untouched for Replay; appends always go to a fresh segment.
+func OpenWAL(dir string, maxSegmentSize int64) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create wal directory: %w", err)
+	}
+
+	w := &WAL{
+		dir:            dir,
+		maxSegmentSize: maxSegmentSize,
+	}
+
+	committed, err := w.readCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	w.committed = committed
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	next := committed.Segment + 1
+	if len(segments) > 0 && segments[len(segments)-1] >= next {
+		next = segments[len(segments)-1] + 1
+	}
+
+	if err := w.openSegment(next); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Append writes an event to the active segment and returns its position
+func (w *WAL) Append(event *structs.Event) (WALPosition, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return WALPosition{}, fmt.Errorf("failed to encode wal entry: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.offset >= w.maxSegmentSize {
+		if err := w.rotate(); err != nil {
+			return WALPosition{}, err
+		}
+	}
+
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+
+	n, err := w.file.Write(buf)
+	w.offset += int64(n)
+	if err != nil {
+		return WALPosition{}, fmt.Errorf("failed to write wal entry: %w", err)
+	}
+
+	return WALPosition{Segment: w.segment, Offset: w.offset}, nil
+}
+
+// Sync flushes the active segment to stable storage
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Commit records that every entry up to and including pos has been written
+// to ClickHouse and removes segments that are no longer needed
+func (w *WAL) Commit(pos WALPosition) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.committed.Before(pos) {
+		return nil
+	}
+
+	if err := w.writeCheckpoint(pos); err != nil {
+		return err
+	}
+	w.committed = pos
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if seg >= pos.Segment {
+			break
+		}
+		if err := os.Remove(w.segmentPath(seg)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove wal segment %d: %w", seg, err)
+		}
+	}
+
+	return nil
+}
+
+// Replay calls fn for every uncommitted entry in segments written before
+// this WAL was opened, in the order they were appended
+func (w *WAL) Replay(fn func(event *structs.Event, pos WALPosition) error) error {
+	w.mu.Lock()
+	active := w.segment
+	committed := w.committed
+	w.mu.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		if seg >= active || seg < committed.Segment {
+			continue
+		}
+
+		var start int64
+		if seg == committed.Segment {
+			start = committed.Offset
+		}
+
+		if err := w.replaySegment(seg, start, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close syncs and closes the active segment
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		w.file = nil
+		return err
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *WAL) replaySegment(seg uint64, start int64, fn func(event *structs.Event, pos WALPosition) error) error {
+	f, err := os.Open(w.segmentPath(seg))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open wal segment %d: %w", seg, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek wal segment %d: %w", seg, err)
+	}
+
+	reader := bufio.NewReader(f)
+	offset := start
+	header := make([]byte, walHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF {
+				log.Printf("wal segment %d: truncated entry header at offset %d", seg, offset)
+			}
+			return nil
+		}
+
+		size := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		if size > walMaxEntrySize {
+			log.Printf("wal segment %d: invalid entry size %d at offset %d", seg, size, offset)
+			return nil
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			log.Printf("wal segment %d: truncated entry at offset %d", seg, offset)
+			return nil
+		}
+		if crc32.ChecksumIEEE(payload) != checksum {
+			log.Printf("wal segment %d: checksum mismatch at offset %d", seg, offset)
+			return nil
+		}
+
+		offset += int64(walHeaderSize) + int64(size)
+
+		var event structs.Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("wal segment %d: skipping undecodable entry at offset %d: %v", seg, offset, err)
+			continue
+		}
+
+		if err := fn(&event, WALPosition{Segment: seg, Offset: offset}); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *WAL) rotate() error {
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync wal segment %d: %w", w.segment, err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close wal segment %d: %w", w.segment, err)
+	}
+	return w.openSegment(w.segment + 1)
+}
+
+func (w *WAL) openSegment(seg uint64) error {
+	f, err := os.OpenFile(w.segmentPath(seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment %d: %w", seg, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat wal segment %d: %w", seg, err)
+	}
+
+	w.file = f
+	w.segment = seg
+	w.offset = info.Size()
+	return nil
+}
+
+// segments returns the sequence numbers of all segment files in ascending order
+func (w *WAL) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wal directory: %w", err)
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, walSegmentPrefix) || !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walSegmentPrefix), walSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (w *WAL) segmentPath(seg uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%020d%s", walSegmentPrefix, seg, walSegmentSuffix))
+}
+
+func (w *WAL) readCheckpoint() (WALPosition, error) {
+	b, err := os.ReadFile(filepath.Join(w.dir, walCheckpointFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return WALPosition{}, nil
+		}
+		return WALPosition{}, fmt.Errorf("failed to read wal checkpoint: %w", err)
+	}
+
+	var pos WALPosition
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(b)), "%d %d", &pos.Segment, &pos.Offset); err != nil {
+		return WALPosition{}, fmt.Errorf("invalid wal checkpoint: %w", err)
+	}
+	return pos, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file
+func (w *WAL) writeCheckpoint(pos WALPosition) error {
+	path := filepath.Join(w.dir, walCheckpointFile)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write wal checkpoint: %w", err)
+	}
+	if _, err := fmt.Fprintf(f, "%d %d\n", pos.Segment, pos.Offset); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write wal checkpoint: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync wal checkpoint: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close wal checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace wal checkpoint: %w", err)
+	}
+	return nil
+}
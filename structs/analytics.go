@@ -7,6 +7,7 @@ type AggregationType string
 
 const (
 	AggCount       AggregationType = "count"
+	AggCountStored AggregationType = "count_stored"
 	AggSum         AggregationType = "sum"
 	AggAvg         AggregationType = "avg"
 	AggMin         AggregationType = "min"
@@ -55,6 +56,9 @@ type AnalyticsQuery struct {
 
 // TimeSeriesQuery represents a query for time series data
 type TimeSeriesQuery struct {
+	// Data source: "events" (default) or "metrics"
+	Source string `json:"source,omitempty"`
+
 	// Aggregation settings
 	Aggregation AggregationType `json:"aggregation"`
 	Field       string          `json:"field,omitempty"` // Required for sum, avg, min, max, percentiles
@@ -0,0 +1,88 @@
+package structs
+
+import (
+	"slices"
+	"time"
+)
+
+// API key scopes. Admin keys may also ingest and query.
+const (
+	ScopeIngest = "ingest"
+	ScopeQuery  = "query"
+	ScopeAdmin  = "admin"
+)
+
+// Scopes lists the scopes an API key can be given
+var Scopes = []string{ScopeIngest, ScopeQuery, ScopeAdmin}
+
+// APIKey is an API key and what it may be used for. Only a hash of the
+// secret is kept; the secret itself is shown once, when the key is created
+// or rotated.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"` // start of the secret, to tell keys apart
+	Hash   string   `json:"hash,omitempty"`
+	Tenant string   `json:"tenant"`
+	Scopes []string `json:"scopes"`
+
+	// Services and Envs restrict the events the key may send and read;
+	// empty allows all
+	Services []string `json:"services,omitempty"`
+	Envs     []string `json:"envs,omitempty"`
+
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyFile is the API key store file used with API_KEY_STORE=file
+type APIKeyFile struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+// APIKeyRequest is the body of POST /v1/admin/keys
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Tenant    string     `json:"tenant,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	Services  []string   `json:"services,omitempty"`
+	Envs      []string   `json:"envs,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeySecret is a key together with its secret, returned when the key is
+// created or rotated
+type APIKeySecret struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// HasScope reports whether the key may be used for scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// Restricted reports whether the key is limited to some services or envs
+func (k *APIKey) Restricted() bool {
+	return k != nil && (len(k.Services) > 0 || len(k.Envs) > 0)
+}
+
+// Allows reports whether the key may send and read events of a service and
+// env. A nil key allows everything.
+func (k *APIKey) Allows(service, env string) bool {
+	if k == nil {
+		return true
+	}
+	if len(k.Services) > 0 && !slices.Contains(k.Services, service) {
+		return false
+	}
+	return len(k.Envs) == 0 || slices.Contains(k.Envs, env)
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
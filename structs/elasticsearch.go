@@ -0,0 +1,42 @@
+package structs
+
+// ESBulkResponse is the body of an Elasticsearch _bulk response
+type ESBulkResponse struct {
+	Took   int64          `json:"took"`
+	Errors bool           `json:"errors"`
+	Items  []ESBulkResult `json:"items"`
+}
+
+// ESBulkResult is one entry in a _bulk response, keyed by the action
+// ("index", "create", ...) as Elasticsearch does
+type ESBulkResult map[string]*ESBulkItem
+
+// ESBulkItem is the outcome of a single bulk action
+type ESBulkItem struct {
+	Index   string    `json:"_index"`
+	ID      string    `json:"_id"`
+	Version int       `json:"_version,omitempty"`
+	Result  string    `json:"result,omitempty"`
+	Shards  *ESShards `json:"_shards,omitempty"`
+	Status  int       `json:"status"`
+	Error   *ESError  `json:"error,omitempty"`
+}
+
+// ESShards reports shard-level success of a write
+type ESShards struct {
+	Total      int `json:"total"`
+	Successful int `json:"successful"`
+	Failed     int `json:"failed"`
+}
+
+// ESError is an Elasticsearch error object
+type ESError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ESErrorResponse is the body of a failed Elasticsearch request
+type ESErrorResponse struct {
+	Error  ESError `json:"error"`
+	Status int     `json:"status"`
+}
@@ -0,0 +1,21 @@
+package structs
+
+// UserAgent is the browser, operating system and device parsed from a
+// User-Agent header. Fields are empty when they could not be recognised.
+type UserAgent struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	Device         string // desktop, mobile, tablet or bot
+}
+
+// GeoIPRecord is what the GeoIP databases know about an IP address. Fields
+// are empty (ASN zero) when the address is not in a database.
+type GeoIPRecord struct {
+	Country string // ISO 3166-1 alpha-2 code
+	Region  string // ISO 3166-2 subdivision code, without the country prefix
+	City    string // English name
+	ASN     uint64
+	ASOrg   string
+}
@@ -3,15 +3,25 @@ package structs
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
 	"time"
 )
 
+// MaxEventIDLength limits the length of a client-supplied event ID
+const MaxEventIDLength = 128
+
 // uuidRegex matches standard UUID format (with or without hyphens)
 var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 
 // Event represents a single monitoring event
 type Event struct {
+	// EventID identifies the event across retries: the ingest dedup window
+	// and the storage engine keep one copy per ID. Generated on ingest when
+	// the producer sends none.
+	EventID string `json:"event_id,omitempty"`
+
 	Timestamp time.Time              `json:"timestamp"`
 	Service   string                 `json:"service"`
 	Env       string                 `json:"env"`
@@ -22,9 +32,76 @@ type Event struct {
 	Name      string                 `json:"name"`
 	Level     string                 `json:"level"`
 	Data      map[string]interface{} `json:"data"`
+
+	// SpanID and ParentSpanID place the event within its trace, as 16 hex
+	// characters (see ParseSpanID)
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+
+	// Severity is the level's number on the OpenTelemetry scale (1-24, see
+	// NormalizeLevel), stored so filters can compare levels by order
+	Severity uint8 `json:"severity,omitempty"`
+
+	// ReceivedAt is when the server accepted the event; comparing it with
+	// Timestamp shows producers whose clocks are off
+	ReceivedAt time.Time `json:"received_at"`
+
+	// SampleRate is how many events this one stands for after sampling;
+	// zero is read as 1. Producers that sample themselves may set it.
+	SampleRate uint32 `json:"sample_rate,omitempty"`
+
+	// Tenant owns the event. It is set from the API key the event was sent
+	// with, replacing any tenant the producer sent.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// UnmarshalJSON decodes an event, accepting any timestamp ParseTimestamp
+// does: an RFC 3339 or common log format string, or an epoch number. The
+// level may be a number, read as ParseLevel reads numeric strings.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type event Event
+	aux := struct {
+		*event
+		Timestamp json.RawMessage `json:"timestamp"`
+		Level     json.RawMessage `json:"level"`
+	}{event: (*event)(e)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	e.Level = ""
+	if level := string(aux.Level); level != "" && level != "null" {
+		if level[0] == '"' {
+			if err := json.Unmarshal(aux.Level, &e.Level); err != nil {
+				return err
+			}
+		} else if _, err := strconv.ParseFloat(level, 64); err == nil {
+			e.Level = level
+		} else {
+			return fmt.Errorf("invalid level %s", level)
+		}
+	}
+
+	raw := string(aux.Timestamp)
+	switch {
+	case raw == "" || raw == "null" || raw == `""`:
+		e.Timestamp = time.Time{}
+		return nil
+	case raw[0] == '"':
+		if err := json.Unmarshal(aux.Timestamp, &raw); err != nil {
+			return err
+		}
+	}
+
+	t, err := ParseTimestamp(raw)
+	if err != nil {
+		return err
+	}
+	e.Timestamp = t
+	return nil
 }
 
-// Validate checks that all required fields are present and IDs are valid UUIDs
+// Validate checks that all required fields are present and IDs are well formed
 func (e *Event) Validate() error {
 	if e.Timestamp.IsZero() {
 		return errors.New("timestamp is required")
@@ -35,14 +112,26 @@ func (e *Event) Validate() error {
 	if e.Name == "" {
 		return errors.New("name is required")
 	}
+	if len(e.EventID) > MaxEventIDLength {
+		return fmt.Errorf("event_id must be at most %d characters", MaxEventIDLength)
+	}
+	if e.Severity > SeverityMax {
+		return fmt.Errorf("severity must be between 0 and %d", SeverityMax)
+	}
 	if e.JobID != "" && !uuidRegex.MatchString(e.JobID) {
 		return errors.New("job_id must be a valid UUID")
 	}
 	if e.RequestID != "" && !uuidRegex.MatchString(e.RequestID) {
 		return errors.New("request_id must be a valid UUID")
 	}
-	if e.TraceID != "" && !uuidRegex.MatchString(e.TraceID) {
-		return errors.New("trace_id must be a valid UUID")
+	if _, ok := ParseTraceID(e.TraceID); e.TraceID != "" && !ok {
+		return errors.New("trace_id must be a valid UUID or 16 or 32 hex characters")
+	}
+	if _, ok := ParseSpanID(e.SpanID); e.SpanID != "" && !ok {
+		return errors.New("span_id must be 16 hex characters")
+	}
+	if _, ok := ParseSpanID(e.ParentSpanID); e.ParentSpanID != "" && !ok {
+		return errors.New("parent_span_id must be 16 hex characters")
 	}
 	return nil
 }
@@ -0,0 +1,25 @@
+package structs
+
+import "time"
+
+// ForwardMessage is a Fluentd Forward protocol message. Message, Forward,
+// PackedForward and CompressedPackedForward modes all decode to a tag and its
+// entries.
+type ForwardMessage struct {
+	Tag     string
+	Entries []ForwardEntry
+	Option  ForwardOption
+}
+
+// ForwardEntry is a single record and its event time
+type ForwardEntry struct {
+	Time   time.Time
+	Record map[string]interface{}
+}
+
+// ForwardOption holds the options sent after a message's entries
+type ForwardOption struct {
+	Size       int
+	Chunk      string // when set, the sender waits for an ack with this chunk id
+	Compressed string // "gzip" for CompressedPackedForward
+}
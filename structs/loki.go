@@ -0,0 +1,60 @@
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// LokiPushRequest is a Loki push API request. Protobuf payloads are decoded
+// into the same types as JSON ones.
+type LokiPushRequest struct {
+	Streams []LokiStream `json:"streams"`
+}
+
+// LokiStream is a set of log lines sharing the same labels
+type LokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values []LokiEntry       `json:"values"`
+}
+
+// LokiEntry is a single log line
+type LokiEntry struct {
+	Timestamp time.Time
+	Line      string
+	Metadata  map[string]string // structured metadata, if any
+}
+
+// UnmarshalJSON decodes the ["<unix nanoseconds>", "<line>", {metadata}] form
+func (e *LokiEntry) UnmarshalJSON(b []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return err
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("entry must be [timestamp, line] or [timestamp, line, metadata]")
+	}
+
+	var ts string
+	if err := json.Unmarshal(parts[0], &ts); err != nil {
+		return fmt.Errorf("invalid entry timestamp: %w", err)
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid entry timestamp %q", ts)
+	}
+	e.Timestamp = time.Unix(0, nanos).UTC()
+
+	if err := json.Unmarshal(parts[1], &e.Line); err != nil {
+		return fmt.Errorf("invalid entry line: %w", err)
+	}
+
+	if len(parts) == 3 {
+		if err := json.Unmarshal(parts[2], &e.Metadata); err != nil {
+			return fmt.Errorf("invalid entry metadata: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package structs
+
+import (
+	"errors"
+	"time"
+)
+
+// Sample is a single metric value, stored in the metrics table
+type Sample struct {
+	Timestamp time.Time
+	Name      string
+	Labels    map[string]string // every label except __name__
+	Value     float64
+	Tenant    string // empty for the default tenant
+}
+
+// Validate checks that the sample has a name and a timestamp
+func (s *Sample) Validate() error {
+	if s.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
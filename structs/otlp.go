@@ -0,0 +1,225 @@
+package structs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// OTLP types mirror the OpenTelemetry protocol messages in their OTLP/JSON
+// form. Protobuf payloads are decoded into the same types so both encodings
+// share one mapping onto Event.
+
+// OTLPLogsRequest is an ExportLogsServiceRequest
+type OTLPLogsRequest struct {
+	ResourceLogs []OTLPResourceLogs `json:"resourceLogs"`
+}
+
+// OTLPResourceLogs is a collection of logs from a single resource
+type OTLPResourceLogs struct {
+	Resource  OTLPResource    `json:"resource"`
+	ScopeLogs []OTLPScopeLogs `json:"scopeLogs"`
+}
+
+// OTLPScopeLogs is a collection of logs from a single instrumentation scope
+type OTLPScopeLogs struct {
+	Scope      OTLPScope       `json:"scope"`
+	LogRecords []OTLPLogRecord `json:"logRecords"`
+}
+
+// OTLPLogRecord is a single OpenTelemetry log record
+type OTLPLogRecord struct {
+	TimeUnixNano         OTLPUint64     `json:"timeUnixNano"`
+	ObservedTimeUnixNano OTLPUint64     `json:"observedTimeUnixNano"`
+	SeverityNumber       int32          `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	EventName            string         `json:"eventName"`
+	Body                 OTLPAnyValue   `json:"body"`
+	Attributes           []OTLPKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"` // hex encoded
+	SpanID               string         `json:"spanId"`  // hex encoded
+}
+
+// OTLPTracesRequest is an ExportTraceServiceRequest
+type OTLPTracesRequest struct {
+	ResourceSpans []OTLPResourceSpans `json:"resourceSpans"`
+}
+
+// OTLPResourceSpans is a collection of spans from a single resource
+type OTLPResourceSpans struct {
+	Resource   OTLPResource     `json:"resource"`
+	ScopeSpans []OTLPScopeSpans `json:"scopeSpans"`
+}
+
+// OTLPScopeSpans is a collection of spans from a single instrumentation scope
+type OTLPScopeSpans struct {
+	Scope OTLPScope  `json:"scope"`
+	Spans []OTLPSpan `json:"spans"`
+}
+
+// OTLPSpan is a single operation within a trace
+type OTLPSpan struct {
+	TraceID           string         `json:"traceId"`      // hex encoded
+	SpanID            string         `json:"spanId"`       // hex encoded
+	ParentSpanID      string         `json:"parentSpanId"` // hex encoded
+	Name              string         `json:"name"`
+	Kind              int32          `json:"kind"`
+	StartTimeUnixNano OTLPUint64     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   OTLPUint64     `json:"endTimeUnixNano"`
+	Attributes        []OTLPKeyValue `json:"attributes"`
+	Status            OTLPStatus     `json:"status"`
+}
+
+// OTLPStatus is the outcome of a span
+type OTLPStatus struct {
+	Code    int32  `json:"code"` // 0 unset, 1 ok, 2 error
+	Message string `json:"message"`
+}
+
+// OTLPResource describes the entity producing telemetry
+type OTLPResource struct {
+	Attributes []OTLPKeyValue `json:"attributes"`
+}
+
+// OTLPScope is the instrumentation scope (library) that produced telemetry
+type OTLPScope struct {
+	Name       string         `json:"name"`
+	Version    string         `json:"version"`
+	Attributes []OTLPKeyValue `json:"attributes"`
+}
+
+// OTLPKeyValue is a single attribute
+type OTLPKeyValue struct {
+	Key   string       `json:"key"`
+	Value OTLPAnyValue `json:"value"`
+}
+
+// OTLPAnyValue holds exactly one of the OTLP attribute value types
+type OTLPAnyValue struct {
+	StringValue *string           `json:"stringValue,omitempty"`
+	BoolValue   *bool             `json:"boolValue,omitempty"`
+	IntValue    *OTLPInt64        `json:"intValue,omitempty"`
+	DoubleValue *float64          `json:"doubleValue,omitempty"`
+	ArrayValue  *OTLPArrayValue   `json:"arrayValue,omitempty"`
+	KvlistValue *OTLPKeyValueList `json:"kvlistValue,omitempty"`
+	BytesValue  []byte            `json:"bytesValue,omitempty"`
+}
+
+// OTLPArrayValue is a list of values
+type OTLPArrayValue struct {
+	Values []OTLPAnyValue `json:"values"`
+}
+
+// OTLPKeyValueList is a nested map of values
+type OTLPKeyValueList struct {
+	Values []OTLPKeyValue `json:"values"`
+}
+
+// IsEmpty reports whether no value is set
+func (v OTLPAnyValue) IsEmpty() bool {
+	return v.StringValue == nil && v.BoolValue == nil && v.IntValue == nil && v.DoubleValue == nil &&
+		v.ArrayValue == nil && v.KvlistValue == nil && v.BytesValue == nil
+}
+
+// Interface converts the value to plain Go types suitable for Event.Data
+func (v OTLPAnyValue) Interface() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.Interface())
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.Interface()
+		}
+		return values
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	default:
+		return nil
+	}
+}
+
+// AsString returns the value as a string, formatting scalars
+func (v OTLPAnyValue) AsString() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64)
+	case v.IsEmpty():
+		return ""
+	default:
+		b, _ := json.Marshal(v.Interface())
+		return string(b)
+	}
+}
+
+// OTLPUint64 is a uint64 that OTLP/JSON encodes as a decimal string
+type OTLPUint64 uint64
+
+// UnmarshalJSON accepts both quoted and bare numbers
+func (u *OTLPUint64) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*u = 0
+		return nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*u = OTLPUint64(v)
+	return nil
+}
+
+// OTLPInt64 is an int64 that OTLP/JSON encodes as a decimal string
+type OTLPInt64 int64
+
+// UnmarshalJSON accepts both quoted and bare numbers
+func (i *OTLPInt64) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = OTLPInt64(v)
+	return nil
+}
+
+// MarshalJSON encodes the value as a decimal string, as OTLP/JSON does
+func (i OTLPInt64) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+// OTLPPartialSuccess reports records the receiver could not accept
+type OTLPPartialSuccess struct {
+	RejectedLogRecords int64  `json:"rejectedLogRecords,omitempty"`
+	RejectedSpans      int64  `json:"rejectedSpans,omitempty"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+// OTLPExportResponse is the body of an Export*ServiceResponse
+type OTLPExportResponse struct {
+	PartialSuccess *OTLPPartialSuccess `json:"partialSuccess,omitempty"`
+}
@@ -0,0 +1,32 @@
+package structs
+
+// RedactionConfig is the rules file loaded with REDACTION_RULES_FILE
+type RedactionConfig struct {
+	Rules []RedactionRule `json:"rules"`
+}
+
+// RedactionRule removes or obscures sensitive values in event data. Rules
+// apply to every event unless Services or Names limit them; both accept
+// shell-style patterns such as "payments-*".
+type RedactionRule struct {
+	Name     string   `json:"name"`
+	Action   string   `json:"action"` // drop, hash or mask
+	Services []string `json:"services,omitempty"`
+	Names    []string `json:"names,omitempty"`
+
+	// Keys are data keys, matched case-insensitively at any depth. Required
+	// for drop and hash; optional for mask, which otherwise checks every
+	// string value.
+	Keys []string `json:"keys,omitempty"`
+
+	// Pattern is the regular expression whose matches mask replaces
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"` // default "[REDACTED]"
+}
+
+// RedactionRuleStats counts the events a rule has changed
+type RedactionRuleStats struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Fired  int64  `json:"fired"`
+}
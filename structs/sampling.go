@@ -0,0 +1,33 @@
+package structs
+
+// SamplingConfig is the rules file loaded with SAMPLING_RULES_FILE
+type SamplingConfig struct {
+	Rules []SamplingRule `json:"rules"`
+}
+
+// SamplingRule drops or samples the events it matches. The first matching
+// rule decides an event's fate. Services, Names and Levels accept
+// shell-style patterns such as "debug*" and match every event when empty.
+type SamplingRule struct {
+	Name     string   `json:"name"`
+	Action   string   `json:"action"` // drop or sample
+	Services []string `json:"services,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Levels   []string `json:"levels,omitempty"`
+
+	// Rate keeps 1 in Rate matching events
+	Rate uint32 `json:"rate,omitempty"`
+
+	// By is trace_id or request_id to keep or drop all events sharing that
+	// ID together; events without the ID are sampled 1 in Rate
+	By string `json:"by,omitempty"`
+}
+
+// SamplingRuleStats counts the events a rule has matched
+type SamplingRuleStats struct {
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	Rate    uint32 `json:"rate,omitempty"`
+	Kept    int64  `json:"kept"`
+	Dropped int64  `json:"dropped"`
+}
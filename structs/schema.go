@@ -0,0 +1,28 @@
+package structs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventSchema is a JSON Schema that the data of events with a given service
+// and name is validated against on ingest
+type EventSchema struct {
+	Service   string          `json:"service"`
+	Name      string          `json:"name"`
+	Mode      string          `json:"mode"` // off, warn or enforce
+	Schema    json.RawMessage `json:"schema"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+
+	// Counts of events checked and found invalid by this instance since it
+	// started
+	Checked int64 `json:"checked"`
+	Invalid int64 `json:"invalid"`
+}
+
+// SchemaRequest is the body of PUT /v1/schemas/{service}/{name}
+type SchemaRequest struct {
+	Mode   string          `json:"mode"`
+	Schema json.RawMessage `json:"schema"`
+}
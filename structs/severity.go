@@ -0,0 +1,106 @@
+package structs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Severity numbers of the canonical levels, on the OpenTelemetry scale: each
+// level owns a band of four numbers starting at its own, up to SeverityMax.
+// Zero means the severity is unknown.
+const (
+	SeverityTrace uint8 = 1
+	SeverityDebug uint8 = 5
+	SeverityInfo  uint8 = 9
+	SeverityWarn  uint8 = 13
+	SeverityError uint8 = 17
+	SeverityFatal uint8 = 21
+	SeverityMax   uint8 = 24
+)
+
+// Levels lists the canonical event levels from least to most severe
+var Levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// levelAliases maps the level spellings of common loggers, lowercased, onto
+// canonical levels
+var levelAliases = map[string]string{
+	"trace": "trace", "trc": "trace", "verbose": "trace", "finest": "trace", "finer": "trace", "v": "trace",
+	"debug": "debug", "dbg": "debug", "fine": "debug", "config": "debug", "d": "debug",
+	"info": "info", "inf": "info", "information": "info", "informational": "info", "notice": "info", "i": "info",
+	"warn": "warn", "wrn": "warn", "warning": "warn", "w": "warn",
+	"error": "error", "err": "error", "eror": "error", "severe": "error", "e": "error",
+	"fatal": "fatal", "ftl": "fatal", "critical": "fatal", "crit": "fatal", "emerg": "fatal",
+	"emergency": "fatal", "alert": "fatal", "panic": "fatal", "dpanic": "fatal", "f": "fatal",
+}
+
+// LevelSeverity returns the severity number of a canonical level
+func LevelSeverity(level string) (uint8, bool) {
+	for i, l := range Levels {
+		if l == level {
+			return uint8(i)*4 + 1, true
+		}
+	}
+	return 0, false
+}
+
+// SeverityLevel returns the canonical level a severity number falls in, or ""
+// for zero and numbers above SeverityMax
+func SeverityLevel(severity uint8) string {
+	if severity == 0 || severity > SeverityMax {
+		return ""
+	}
+	return Levels[(severity-1)/4]
+}
+
+// ParseLevel maps a level onto the canonical scale. Names are matched
+// case-insensitively against the aliases of common loggers ("WARNING",
+// "Warn", "crit"); numbers are read on the Python logging scale, where 10 is
+// debug, 20 info, 30 warn, 40 error, 50 and above fatal, and 1-9 trace.
+func ParseLevel(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if level, ok := levelAliases[s]; ok {
+		return level, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return "", false
+	}
+	switch {
+	case n >= 50:
+		return "fatal", true
+	case n >= 40:
+		return "error", true
+	case n >= 30:
+		return "warn", true
+	case n >= 20:
+		return "info", true
+	case n >= 10:
+		return "debug", true
+	}
+	return "trace", true
+}
+
+// NormalizeLevel rewrites the event's level onto the canonical scale and sets
+// its severity number to match. A severity the producer sent is kept when it
+// lies within the level's band, and names the level when there is none.
+// Unrecognised levels are kept lowercased, with severity zero.
+func (e *Event) NormalizeLevel() {
+	if e.Severity > SeverityMax {
+		e.Severity = 0
+	}
+	if strings.TrimSpace(e.Level) == "" {
+		e.Level = SeverityLevel(e.Severity)
+		return
+	}
+
+	level, ok := ParseLevel(e.Level)
+	if !ok {
+		e.Level = strings.ToLower(strings.TrimSpace(e.Level))
+		e.Severity = 0
+		return
+	}
+	e.Level = level
+	if SeverityLevel(e.Severity) != level {
+		e.Severity, _ = LevelSeverity(level)
+	}
+}
@@ -0,0 +1,12 @@
+package structs
+
+// StatsDMetric is one parsed StatsD line
+type StatsDMetric struct {
+	Name       string
+	Type       string  // c (counter), g (gauge), ms/h/d (timer) or s (set)
+	Value      float64 // unused for sets
+	Delta      bool    // gauge value prefixed with + or -, adjusting the current value
+	SetMember  string  // value added to a set
+	SampleRate float64 // 0 < rate <= 1
+	Tags       map[string]string
+}
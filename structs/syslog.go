@@ -0,0 +1,16 @@
+package structs
+
+import "time"
+
+// SyslogMessage is a parsed RFC 5424 or RFC 3164 syslog message
+type SyslogMessage struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time // zero when the message carries none
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string // SD-ID -> param name -> value
+	Message        string
+}
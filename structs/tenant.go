@@ -0,0 +1,38 @@
+package structs
+
+// DefaultTenant owns data sent with API_KEY, without authentication, or
+// through listeners that take no API key (syslog, StatsD, Fluent Forward)
+const DefaultTenant = "default"
+
+// TenantConfig is the tenants file loaded with TENANTS_FILE
+type TenantConfig struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// Tenant is a team whose events and metrics are kept apart from everyone
+// else's. Requests authenticated with one of its API keys ingest into and
+// query only the tenant's data.
+type Tenant struct {
+	Name    string   `json:"name"`
+	APIKeys []string `json:"api_keys"`
+
+	// RetentionDays is how long the tenant's events and metrics are kept;
+	// zero uses the table default of 30 days
+	RetentionDays uint16 `json:"retention_days,omitempty"`
+
+	// QueueQuota caps how many of the tenant's events may wait in the queue
+	// at once; zero leaves only the queue size as a limit
+	QueueQuota int `json:"queue_quota,omitempty"`
+
+	// Scopes are what the tenant's API keys may be used for; empty allows
+	// ingest and query but not admin
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// TenantStats reports a tenant's share of the queue
+type TenantStats struct {
+	RetentionDays uint16 `json:"retention_days,omitempty"`
+	QueueQuota    int    `json:"queue_quota,omitempty"`
+	Pending       int64  `json:"pending"`
+	Dropped       int64  `json:"dropped"`
+}
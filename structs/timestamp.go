@@ -0,0 +1,78 @@
+package structs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the date formats ParseTimestamp accepts besides epoch
+// numbers. Layouts without a zone are read as UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999",   // Go log package, nginx error log
+	"02/Jan/2006:15:04:05 -0700",      // Apache and nginx access logs
+	"Mon, 02 Jan 2006 15:04:05 -0700", // RFC 1123 with numeric zone
+	time.RFC1123,
+	time.UnixDate,
+	time.RubyDate,
+	time.ANSIC,
+}
+
+// ParseTimestamp parses an event timestamp: epoch seconds, milliseconds,
+// microseconds or nanoseconds (told apart by magnitude, optionally with a
+// fraction), RFC 3339, or one of the common log formats in timestampLayouts
+func ParseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, ok := parseEpoch(s); ok {
+		return t, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// parseEpoch reads a non-negative epoch number. Values below 1e11 are seconds
+// (up to the year 5138), below 1e14 milliseconds, below 1e17 microseconds and
+// anything larger nanoseconds.
+func parseEpoch(s string) (time.Time, bool) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || strings.Trim(whole, "0123456789") != "" || strings.Trim(frac, "0123456789") != "" {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	switch {
+	case n < 1e11:
+		return time.Unix(n, fractionNanos(frac, 9)).UTC(), true
+	case n < 1e14:
+		return time.UnixMilli(n).Add(time.Duration(fractionNanos(frac, 6))).UTC(), true
+	case n < 1e17:
+		return time.UnixMicro(n).Add(time.Duration(fractionNanos(frac, 3))).UTC(), true
+	default:
+		return time.Unix(0, n).UTC(), true
+	}
+}
+
+// fractionNanos converts the digits after a decimal point into nanoseconds,
+// given how many digits make up a nanosecond count in the value's unit
+func fractionNanos(frac string, digits int) int64 {
+	if len(frac) > digits {
+		frac = frac[:digits]
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+	n, _ := strconv.ParseInt(frac, 10, 64)
+	return n
+}
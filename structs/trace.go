@@ -0,0 +1,94 @@
+package structs
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// ParseTraceID reads a trace ID given as a UUID, as 32 hex characters (W3C
+// and OpenTelemetry) or as 16 hex characters (64-bit IDs, left-padded with
+// zeros). It returns the lowercase hyphenated UUID form events store, so the
+// same trace matches whichever form producers send.
+func ParseTraceID(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch len(s) {
+	case 36:
+		if !uuidRegex.MatchString(s) {
+			return "", false
+		}
+		return s, true
+	case 16:
+		s = "0000000000000000" + s
+	case 32:
+	default:
+		return "", false
+	}
+	if !isHexID(s) {
+		return "", false
+	}
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32], true
+}
+
+// ParseSpanID reads a span ID: 16 hex characters, not all zero. It returns
+// the ID lowercased.
+func ParseSpanID(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != 16 || !isHexID(s) {
+		return "", false
+	}
+	return s, true
+}
+
+// ParseTraceparent reads a W3C traceparent header
+// (version-traceid-parentid-flags), returning the trace ID in the form
+// ParseTraceID does and the caller's span ID. Headers of later versions may
+// carry more fields, which are ignored.
+func ParseTraceparent(header string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 {
+		return "", "", false
+	}
+	version, flags := parts[0], parts[3]
+	if len(version) != 2 || version == "ff" || !isHex(version) || len(flags) != 2 || !isHex(flags) {
+		return "", "", false
+	}
+	if version == "00" && len(parts) != 4 {
+		return "", "", false
+	}
+	if len(parts[1]) != 32 {
+		return "", "", false
+	}
+	if traceID, ok = ParseTraceID(parts[1]); !ok {
+		return "", "", false
+	}
+	if spanID, ok = ParseSpanID(parts[2]); !ok {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// NormalizeTraceContext rewrites the event's trace and span IDs into the
+// forms ParseTraceID and ParseSpanID return. IDs that do not parse are left
+// as they are.
+func (e *Event) NormalizeTraceContext() {
+	if id, ok := ParseTraceID(e.TraceID); ok {
+		e.TraceID = id
+	}
+	if id, ok := ParseSpanID(e.SpanID); ok {
+		e.SpanID = id
+	}
+	if id, ok := ParseSpanID(e.ParentSpanID); ok {
+		e.ParentSpanID = id
+	}
+}
+
+// isHexID reports whether s is hex and not all zeros, which W3C reserves for
+// invalid IDs
+func isHexID(s string) bool {
+	return isHex(s) && strings.Trim(s, "0") != ""
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}